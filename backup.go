@@ -15,7 +15,12 @@ package sqlite3
 */
 import "C"
 import (
+	"context"
+	"fmt"
+	"net/url"
 	"runtime"
+	"strings"
+	"time"
 	"unsafe"
 )
 
@@ -83,3 +88,165 @@ func (b *SQLiteBackup) Close() error {
 	}
 	return nil
 }
+
+// BackupOptions configures BackupTo and BackupFrom.
+type BackupOptions struct {
+	// Schema is the database of the connection that is backed up or
+	// restored, "main" if empty.
+	Schema string
+	// PagesPerStep is the number of pages copied by each step. If it is
+	// zero or negative, all pages are copied in a single step.
+	PagesPerStep int
+	// Sleep is the pause between two steps, which leaves the source
+	// database to other connections. It is also the pause before a step
+	// is retried when the database is busy, 10ms if Sleep is zero.
+	Sleep time.Duration
+	// Progress, if not nil, is called after each step with the number of
+	// pages left to copy and the number of pages of the source database.
+	Progress func(remaining, total int)
+	// Busy, if not nil, is called when a step fails because the source or
+	// the destination is busy or locked, with the number of consecutive
+	// retries so far.
+	Busy func(retries int)
+}
+
+// BackupError is returned by BackupTo and BackupFrom when the backup fails
+// or its context is done.
+type BackupError struct {
+	// Remaining and PageCount are the number of pages left to copy and
+	// the number of pages of the source database when the backup stopped.
+	Remaining int
+	PageCount int
+	Err       error
+}
+
+func (e *BackupError) Error() string {
+	return fmt.Sprintf("sqlite3: backup failed with %d of %d pages left: %v", e.Remaining, e.PageCount, e.Err)
+}
+
+func (e *BackupError) Unwrap() error {
+	return e.Err
+}
+
+// BackupTo copies the database of the connection to the database file at
+// destPath, which is opened like a data source name of the driver and
+// overwritten. See BackupOptions for the copy loop.
+//
+// Other connections may keep using the source database during the copy. If
+// one of them changes it, the backup starts over from the first page, so
+// that the copy is always consistent; an ongoing backup is only stopped by
+// an error or ctx.
+func (c *SQLiteConn) BackupTo(ctx context.Context, destPath string, opts BackupOptions) error {
+	dest, err := openBackupConn(destPath)
+	if err != nil {
+		return &BackupError{Err: err}
+	}
+	defer dest.Close()
+	return runBackup(ctx, dest, "main", c, opts.schema(), opts)
+}
+
+// BackupFrom replaces the database of the connection with a copy of the
+// database file at srcPath, which is opened like a data source name of the
+// driver, but read-only: it is an error if the file does not exist. It
+// works like BackupTo the other way around.
+func (c *SQLiteConn) BackupFrom(ctx context.Context, srcPath string, opts BackupOptions) error {
+	src, err := openBackupConn(readOnlyDSN(srcPath))
+	if err != nil {
+		return &BackupError{Err: err}
+	}
+	defer src.Close()
+	return runBackup(ctx, c, opts.schema(), src, "main", opts)
+}
+
+func (o *BackupOptions) schema() string {
+	if o.Schema == "" {
+		return "main"
+	}
+	return o.Schema
+}
+
+func openBackupConn(dsn string) (*SQLiteConn, error) {
+	conn, err := (&SQLiteDriver{}).Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*SQLiteConn), nil
+}
+
+// readOnlyDSN returns dsn as a file: URI with mode=ro, which SQLite opens
+// read-only and without creating the file.
+func readOnlyDSN(dsn string) string {
+	name, query := dsn, ""
+	if pos := strings.IndexRune(dsn, '?'); pos >= 1 {
+		name, query = dsn[:pos], dsn[pos+1:]
+	}
+	if strings.HasPrefix(name, "file:") {
+		name = strings.TrimPrefix(name, "file:")
+	} else {
+		name = (&url.URL{Path: name}).EscapedPath()
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		// Leave the error to the driver.
+		return dsn
+	}
+	params.Set("mode", "ro")
+	return "file:" + name + "?" + params.Encode()
+}
+
+func runBackup(ctx context.Context, dest *SQLiteConn, destSchema string, src *SQLiteConn, srcSchema string, opts BackupOptions) error {
+	b, err := dest.Backup(destSchema, src, srcSchema)
+	if err != nil {
+		return &BackupError{Err: err}
+	}
+	pages := C.int(opts.PagesPerStep)
+	if pages <= 0 {
+		pages = -1
+	}
+	retries := 0
+	fail := func(err error) error {
+		e := &BackupError{Remaining: b.Remaining(), PageCount: b.PageCount(), Err: err}
+		b.Close()
+		return e
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		pause := opts.Sleep
+		switch rv := C.sqlite3_backup_step(b.b, pages); rv {
+		case C.SQLITE_DONE:
+			if opts.Progress != nil {
+				opts.Progress(b.Remaining(), b.PageCount())
+			}
+			if err := b.Close(); err != nil {
+				return &BackupError{Err: err}
+			}
+			return nil
+		case C.SQLITE_OK:
+			retries = 0
+			if opts.Progress != nil {
+				opts.Progress(b.Remaining(), b.PageCount())
+			}
+		case C.SQLITE_BUSY, C.SQLITE_LOCKED:
+			retries++
+			if opts.Busy != nil {
+				opts.Busy(retries)
+			}
+			if pause <= 0 {
+				pause = 10 * time.Millisecond
+			}
+		default:
+			return fail(Error{Code: ErrNo(rv & ErrNoMask), ExtendedCode: ErrNoExtended(rv)})
+		}
+		if pause > 0 {
+			t := time.NewTimer(pause)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return fail(ctx.Err())
+			case <-t.C:
+			}
+		}
+	}
+}
@@ -9,9 +9,13 @@
 package sqlite3
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -293,3 +297,175 @@ func TestBackupError(t *testing.T) {
 		t.Fatal("Failed to get the expected nil backup result.")
 	}
 }
+
+func TestBackupTo(t *testing.T) {
+	srcFilename := TempFilename(t)
+	defer os.Remove(srcFilename)
+	db, err := sql.Open("sqlite3", srcFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (v BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 200) INSERT INTO t SELECT randomblob(1000) FROM n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another connection changes the source during the backup.
+	other, err := sql.Open("sqlite3", srcFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	destFilename := TempFilename(t)
+	defer os.Remove(destFilename)
+	count := func(db *sql.DB) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM t").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	err = conn.Raw(func(dc any) error {
+		c := dc.(*SQLiteConn)
+		ctx := context.Background()
+
+		var steps, restarts int
+		last := -1
+		opts := BackupOptions{
+			PagesPerStep: 10,
+			Progress: func(remaining, total int) {
+				steps++
+				if last >= 0 && remaining > last {
+					restarts++
+				}
+				last = remaining
+				if steps == 2 {
+					if _, err := other.Exec("INSERT INTO t VALUES (randomblob(1000))"); err != nil {
+						t.Error(err)
+					}
+				}
+			},
+		}
+		if err := c.BackupTo(ctx, destFilename, opts); err != nil {
+			return err
+		}
+		if steps < 5 || last != 0 || restarts != 1 {
+			t.Errorf("unexpected progress: %d steps, %d restarts, %d left", steps, restarts, last)
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := c.BackupTo(canceled, destFilename, BackupOptions{})
+		var berr *BackupError
+		if !errors.As(err, &berr) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a canceled backup, got %v", err)
+		}
+
+		err = c.BackupTo(ctx, filepath.Join(t.TempDir(), "missing", "db"), BackupOptions{})
+		if !errors.As(err, &berr) {
+			t.Errorf("expected a backup error, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := sql.Open("sqlite3", destFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dest.Close()
+	if n := count(dest); n != 201 {
+		t.Errorf("expected 201 rows in the copy, got %d", n)
+	}
+
+	// A locked destination is retried until the context is done.
+	lock, err := dest.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.ExecContext(context.Background(), "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Raw(func(dc any) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		var busy int
+		err := dc.(*SQLiteConn).BackupTo(ctx, destFilename+"?_busy_timeout=0", BackupOptions{
+			Sleep: time.Millisecond,
+			Busy:  func(retries int) { busy = retries },
+		})
+		if !errors.Is(err, context.DeadlineExceeded) || busy < 2 {
+			t.Errorf("expected busy retries until the deadline, got %v after %d retries", err, busy)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.ExecContext(context.Background(), "ROLLBACK")
+	lock.Close()
+
+	// Restore the copy into an in-memory database.
+	mem, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mem.Close()
+	mem.SetMaxOpenConns(1)
+	memConn, err := mem.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = memConn.Raw(func(dc any) error {
+		return dc.(*SQLiteConn).BackupFrom(context.Background(), destFilename, BackupOptions{PagesPerStep: 50})
+	})
+	memConn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(mem); n != 201 {
+		t.Errorf("expected 201 restored rows, got %d", n)
+	}
+
+	// The source is opened read-only, so a missing one is an error rather
+	// than an empty database, even when the data source name asks for
+	// creating it.
+	memConn, err = mem.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, missing := range []string{
+		filepath.Join(t.TempDir(), "missing.db"),
+		"file:" + filepath.Join(t.TempDir(), "missing.db") + "?mode=rwc",
+	} {
+		err = memConn.Raw(func(dc any) error {
+			return dc.(*SQLiteConn).BackupFrom(context.Background(), missing, BackupOptions{})
+		})
+		var berr *BackupError
+		if !errors.As(err, &berr) {
+			t.Errorf("%s: expected a backup error, got %v", missing, err)
+		}
+		name := strings.TrimPrefix(strings.TrimSuffix(missing, "?mode=rwc"), "file:")
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the source not to be created, got %v", missing, err)
+		}
+	}
+	memConn.Close()
+	if n := count(mem); n != 201 {
+		t.Errorf("expected the failed restores to leave 201 rows, got %d", n)
+	}
+}
@@ -13,7 +13,11 @@ package sqlite3
 #endif
 */
 import "C"
-import "syscall"
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
 
 // ErrNo inherit errno.
 type ErrNo int
@@ -121,6 +125,7 @@ var (
 	ErrIoErrMMap              = ErrIoErr.Extend(24)
 	ErrIoErrGetTempPath       = ErrIoErr.Extend(25)
 	ErrIoErrConvPath          = ErrIoErr.Extend(26)
+	ErrIoErrData              = ErrIoErr.Extend(32)
 	ErrLockedSharedCache      = ErrLocked.Extend(1)
 	ErrBusyRecovery           = ErrBusy.Extend(1)
 	ErrBusySnapshot           = ErrBusy.Extend(2)
@@ -148,3 +153,36 @@ var (
 	ErrNoticeRecoverRollback  = ErrNotice.Extend(2)
 	ErrWarningAutoIndex       = ErrWarning.Extend(1)
 )
+
+// errorCode returns the result code carried by err, which wraps an Error,
+// an ErrNo or an ErrNoExtended, so that callbacks can report a specific
+// code to SQLite. It returns def if err carries no code.
+func errorCode(err error, def int) int {
+	var e Error
+	var en ErrNo
+	var ex ErrNoExtended
+	switch {
+	case errors.As(err, &e) && e.ExtendedCode != 0:
+		return int(e.ExtendedCode)
+	case errors.As(err, &e) && e.Code != 0:
+		return int(e.Code)
+	case errors.As(err, &ex):
+		return int(ex)
+	case errors.As(err, &en):
+		return int(en)
+	}
+	return def
+}
+
+// ChecksumError is returned by VerifyChecksums for a database whose pages
+// do not match their checksums.
+type ChecksumError struct {
+	Pages []int64 // the numbers of the bad pages, in increasing order
+}
+
+func (e *ChecksumError) Error() string {
+	if len(e.Pages) == 1 {
+		return fmt.Sprintf("sqlite3: bad checksum on page %d", e.Pages[0])
+	}
+	return fmt.Sprintf("sqlite3: bad checksums on %d pages, the first of them %d", len(e.Pages), e.Pages[0])
+}
@@ -247,9 +247,6 @@ void stepTrampoline(sqlite3_context*, int, sqlite3_value**);
 void doneTrampoline(sqlite3_context*);
 
 int compareTrampoline(void*, int, char*, int, char*);
-int commitHookTrampoline(void*);
-void rollbackHookTrampoline(void*);
-void updateHookTrampoline(void*, int, char*, char*, sqlite3_int64);
 
 int authorizerTrampoline(void*, int, char*, char*, char*, char*);
 
@@ -437,20 +434,43 @@ const (
 	SQLITE_FCNTL_CKSM_FILE             = int(41)
 )
 
+const (
+	// CksumVFSName is the name of the checksum VFS, which the
+	// sqlite_cksumvfs build tag compiles in.
+	CksumVFSName = "cksmvfs"
+	// CksumVFSReserveBytes is the number of bytes the checksum VFS
+	// reserves at the end of each page for its checksum.
+	CksumVFSReserveBytes = 8
+)
+
 // SQLiteDriver implements driver.Driver.
 type SQLiteDriver struct {
 	Extensions  []string
 	ConnectHook func(*SQLiteConn) error
+	// Interceptors are installed on every connection opened by the
+	// driver. See Interceptor.
+	Interceptors []Interceptor
+	// TimeParseFormats are the layouts tried in order when reading TEXT
+	// values from DATE, DATETIME and TIMESTAMP columns. If nil,
+	// SQLiteTimestampFormats is used. The _time_parse DSN parameter
+	// overrides them for a connection.
+	TimeParseFormats []string
 }
 
 // SQLiteConn implements driver.Conn.
 type SQLiteConn struct {
-	mu          sync.Mutex
-	db          *C.sqlite3
-	loc         *time.Location
-	txlock      string
-	funcs       []*functionInfo
-	aggregators []*aggInfo
+	mu           sync.Mutex
+	db           *C.sqlite3
+	loc          *time.Location
+	timeFormat   timeFormat
+	timeEpoch    timeEpoch
+	timeParse    []string
+	columnTypes  map[string]*columnType
+	reuseBuffers bool
+	txlock       string
+	interceptors []Interceptor
+	funcs        []*functionInfo
+	aggregators  []*aggInfo
 	// Prepared-statement cache. The slice is allocated at Open with a
 	// fixed capacity equal to the configured cache size; cap bounds the
 	// cache, len is the live count, and entries are ordered LRU-first
@@ -459,11 +479,13 @@ type SQLiteConn struct {
 	// only field safe to read without the lock.
 	stmtCache        []*SQLiteStmt
 	stmtCacheEnabled bool
+	hooks            connHooks
 }
 
 // SQLiteTx implements driver.Tx.
 type SQLiteTx struct {
-	c *SQLiteConn
+	c  *SQLiteConn
+	ic *interceptorChain // nil unless the connection has interceptors
 }
 
 // SQLiteStmt implements driver.Stmt.
@@ -497,9 +519,16 @@ type SQLiteRows struct {
 	cls      bool  // True if we need to close the parent statement in Close
 	cols     []string
 	decltype []string
+	coltypes []*columnType // registered column types, nil if there are none
 	colvals  *C.sqlite3_go_col
+	buf      []byte          // TEXT and BLOB values of the current row, see _reuse_buffers
 	ctx      context.Context // no better alternative to pass context into Next() method
 	closemu  sync.Mutex
+	// The statements following s in a multi-statement query, and the
+	// arguments they are bound from, see NextResultSet.
+	tail     string
+	args     []driver.NamedValue
+	argStart int
 }
 
 type functionInfo struct {
@@ -605,6 +634,16 @@ func (ai *aggInfo) Done(ctx *C.sqlite3_context) {
 
 // Commit transaction.
 func (tx *SQLiteTx) Commit() error {
+	if tx.ic == nil {
+		return tx.commit()
+	}
+	start := time.Now()
+	err := tx.commit()
+	tx.ic.afterCommit(InterceptorEvent{Duration: time.Since(start), Err: err})
+	return err
+}
+
+func (tx *SQLiteTx) commit() error {
 	_, err := tx.c.exec(context.Background(), "COMMIT", nil)
 	if err != nil {
 		// sqlite3 may leave the transaction open in this scenario.
@@ -619,7 +658,11 @@ func (tx *SQLiteTx) Commit() error {
 
 // Rollback transaction.
 func (tx *SQLiteTx) Rollback() error {
+	start := time.Now()
 	_, err := tx.c.exec(context.Background(), "ROLLBACK", nil)
+	if tx.ic != nil {
+		tx.ic.afterRollback(InterceptorEvent{Duration: time.Since(start), Err: err})
+	}
 	return err
 }
 
@@ -652,26 +695,34 @@ func (c *SQLiteConn) RegisterCollation(name string, cmp func(string, string) int
 //
 // If there is an existing commit hook for this connection, it will be
 // removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
+// without creating a new one. Hooks added with AddCommitHook are not
+// affected.
 func (c *SQLiteConn) RegisterCommitHook(callback func() int) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
 	if callback == nil {
-		C.sqlite3_commit_hook(c.db, nil, nil)
+		c.hooks.commit.setPrimary(nil)
 	} else {
-		C.sqlite3_commit_hook(c.db, (*[0]byte)(C.commitHookTrampoline), newHandle(c, callback))
+		c.hooks.commit.setPrimary(&callback)
 	}
+	c.installCommitHookLocked()
 }
 
 // RegisterRollbackHook sets the rollback hook for a connection.
 //
 // If there is an existing rollback hook for this connection, it will be
 // removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
+// without creating a new one. Hooks added with AddRollbackHook are not
+// affected.
 func (c *SQLiteConn) RegisterRollbackHook(callback func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
 	if callback == nil {
-		C.sqlite3_rollback_hook(c.db, nil, nil)
+		c.hooks.rollback.setPrimary(nil)
 	} else {
-		C.sqlite3_rollback_hook(c.db, (*[0]byte)(C.rollbackHookTrampoline), newHandle(c, callback))
+		c.hooks.rollback.setPrimary(&callback)
 	}
+	c.installRollbackHookLocked()
 }
 
 // RegisterUpdateHook sets the update hook for a connection.
@@ -682,13 +733,17 @@ func (c *SQLiteConn) RegisterRollbackHook(callback func()) {
 //
 // If there is an existing update hook for this connection, it will be
 // removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
+// without creating a new one. Hooks added with AddUpdateHook are not
+// affected.
 func (c *SQLiteConn) RegisterUpdateHook(callback func(int, string, string, int64)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
 	if callback == nil {
-		C.sqlite3_update_hook(c.db, nil, nil)
+		c.hooks.update.setPrimary(nil)
 	} else {
-		C.sqlite3_update_hook(c.db, (*[0]byte)(C.updateHookTrampoline), newHandle(c, callback))
+		c.hooks.update.setPrimary(&callback)
 	}
+	c.installUpdateHookLocked()
 }
 
 // RegisterAuthorizer sets the authorizer for connection.
@@ -721,17 +776,46 @@ func (c *SQLiteConn) RegisterAuthorizer(callback func(int, string, string, strin
 //
 // See _example/go_custom_funcs for a detailed example.
 func (c *SQLiteConn) RegisterFunc(name string, impl any, pure bool) error {
+	fi, numArgs, err := newFunctionInfo(impl)
+	if err != nil {
+		return err
+	}
+
+	// fi must outlast the database connection, or we'll have dangling pointers.
+	c.funcs = append(c.funcs, fi)
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	opts := C.SQLITE_UTF8
+	if pure {
+		opts |= C.SQLITE_DETERMINISTIC
+	}
+	rv := sqlite3CreateFunction(c.db, cname, C.int(numArgs), C.int(opts), newHandle(c, fi), C.callbackTrampoline, nil, nil)
+	if rv != C.SQLITE_OK {
+		return c.lastError()
+	}
+	return nil
+}
+
+func sqlite3CreateFunction(db *C.sqlite3, zFunctionName *C.char, nArg C.int, eTextRep C.int, pApp unsafe.Pointer, xFunc unsafe.Pointer, xStep unsafe.Pointer, xFinal unsafe.Pointer) C.int {
+	return C._sqlite3_create_function(db, zFunctionName, nArg, eTextRep, C.uintptr_t(uintptr(pApp)), (*[0]byte)(xFunc), (*[0]byte)(xStep), (*[0]byte)(xFinal))
+}
+
+// newFunctionInfo prepares the Go function impl to be called from SQLite,
+// following the rules of RegisterFunc. It also returns the number of
+// arguments to register the function with, -1 for a variadic function.
+func newFunctionInfo(impl any) (*functionInfo, int, error) {
 	var fi functionInfo
 	fi.f = reflect.ValueOf(impl)
 	t := fi.f.Type()
 	if t.Kind() != reflect.Func {
-		return errors.New("Non-function passed to RegisterFunc")
+		return nil, 0, errors.New("Non-function passed to RegisterFunc")
 	}
 	if t.NumOut() != 1 && t.NumOut() != 2 {
-		return errors.New("SQLite functions must return 1 or 2 values")
+		return nil, 0, errors.New("SQLite functions must return 1 or 2 values")
 	}
 	if t.NumOut() == 2 && !t.Out(1).Implements(reflect.TypeOf((*error)(nil)).Elem()) {
-		return errors.New("Second return value of SQLite function must be error")
+		return nil, 0, errors.New("Second return value of SQLite function must be error")
 	}
 
 	numArgs := t.NumIn()
@@ -742,7 +826,7 @@ func (c *SQLiteConn) RegisterFunc(name string, impl any, pure bool) error {
 	for i := 0; i < numArgs; i++ {
 		conv, err := callbackArg(t.In(i))
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
 		fi.argConverters = append(fi.argConverters, conv)
 	}
@@ -750,7 +834,7 @@ func (c *SQLiteConn) RegisterFunc(name string, impl any, pure bool) error {
 	if t.IsVariadic() {
 		conv, err := callbackArg(t.In(numArgs).Elem())
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
 		fi.variadicConverter = conv
 		// Pass -1 to sqlite so that it allows any number of
@@ -761,28 +845,11 @@ func (c *SQLiteConn) RegisterFunc(name string, impl any, pure bool) error {
 
 	conv, err := callbackRet(t.Out(0))
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	fi.retConverter = conv
 
-	// fi must outlast the database connection, or we'll have dangling pointers.
-	c.funcs = append(c.funcs, &fi)
-
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-	opts := C.SQLITE_UTF8
-	if pure {
-		opts |= C.SQLITE_DETERMINISTIC
-	}
-	rv := sqlite3CreateFunction(c.db, cname, C.int(numArgs), C.int(opts), newHandle(c, &fi), C.callbackTrampoline, nil, nil)
-	if rv != C.SQLITE_OK {
-		return c.lastError()
-	}
-	return nil
-}
-
-func sqlite3CreateFunction(db *C.sqlite3, zFunctionName *C.char, nArg C.int, eTextRep C.int, pApp unsafe.Pointer, xFunc unsafe.Pointer, xStep unsafe.Pointer, xFinal unsafe.Pointer) C.int {
-	return C._sqlite3_create_function(db, zFunctionName, nArg, eTextRep, C.uintptr_t(uintptr(pApp)), (*[0]byte)(xFunc), (*[0]byte)(xStep), (*[0]byte)(xFinal))
+	return &fi, numArgs, nil
 }
 
 // RegisterAggregator makes a Go type available as a SQLite aggregation function.
@@ -948,12 +1015,13 @@ func lastError(db *C.sqlite3) error {
 
 // Exec implements Execer.
 func (c *SQLiteConn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	return c.exec(context.Background(), query, valueToNamedValue(args))
+	return c.ExecContext(context.Background(), query, valueToNamedValue(args))
 }
 
 func (c *SQLiteConn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	// Fast path: no args, no context cancellation → single CGO call per statement
-	if len(args) == 0 && ctx.Done() == nil {
+	// Fast path: no args, no context cancellation → single CGO call per
+	// statement. Step hooks need the statements, which it finalizes.
+	if len(args) == 0 && ctx.Done() == nil && !c.hooks.watchingSteps() {
 		return c.execNoArgs(query)
 	}
 
@@ -1005,7 +1073,8 @@ func (c *SQLiteConn) execNoArgs(query string) (driver.Result, error) {
 			query = ""
 		}
 		C.free(unsafe.Pointer(pquery))
-		if rv != C.SQLITE_ROW && rv != C.SQLITE_OK && rv != C.SQLITE_DONE {
+		ok := rv == C.SQLITE_ROW || rv == C.SQLITE_OK || rv == C.SQLITE_DONE
+		if !ok {
 			return nil, c.lastError()
 		}
 		res = &SQLiteResult{id: int64(rowid), changes: int64(changes)}
@@ -1018,11 +1087,26 @@ func (c *SQLiteConn) execNoArgs(query string) (driver.Result, error) {
 
 // Query implements Queryer.
 func (c *SQLiteConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	return c.query(context.Background(), query, valueToNamedValue(args))
+	return c.QueryContext(context.Background(), query, valueToNamedValue(args))
 }
 
+// query runs the statements of query up to the first one that returns
+// columns, or the last one, and returns its rows. Statements before it that
+// return no columns are executed to completion. The statements after it are
+// left for SQLiteRows.NextResultSet, and executed when the rows are closed.
 func (c *SQLiteConn) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	start := 0
+	rows, err := c.queryFrom(ctx, query, args, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// queryFrom is query with the first start arguments already consumed by
+// earlier statements. If all is set, the last statement is also executed
+// when it returns no columns and queryFrom returns nil rows if no statement
+// returns columns.
+func (c *SQLiteConn) queryFrom(ctx context.Context, query string, args []driver.NamedValue, start int, all bool) (*SQLiteRows, error) {
 	for {
 		s, err := c.prepareWithCache(ctx, query)
 		if err != nil {
@@ -1036,6 +1120,9 @@ func (c *SQLiteConn) query(ctx context.Context, query string, args []driver.Name
 			tail := ss.t
 			ss.Close()
 			if tail == "" {
+				if all {
+					return nil, nil
+				}
 				return &SQLiteRows{cls: true, ctx: ctx}, nil
 			}
 			query = tail
@@ -1047,32 +1134,43 @@ func (c *SQLiteConn) query(ctx context.Context, query string, args []driver.Name
 			return nil, fmt.Errorf("not enough args to execute query: want %d got %d", na, len(args)-start)
 		}
 		stmtArgs := stmtArgs(args, start, na)
-		rows, err := ss.query(ctx, stmtArgs)
-		if err != nil && err != driver.ErrSkip {
-			ss.Close()
-			return rows, err
-		}
 		start += na
 		tail := ss.t
-		if tail == "" {
-			return rows, nil
+		if (tail != "" || all) && C.sqlite3_column_count(ss.s) == 0 {
+			_, err := ss.exec(ctx, stmtArgs)
+			ss.Close()
+			if err != nil {
+				return nil, err
+			}
+			if tail == "" {
+				return nil, nil
+			}
+			query = tail
+			continue
 		}
-		rows.Close()
-		ss.Close()
-		query = tail
+		r, err := ss.query(ctx, stmtArgs)
+		if err != nil {
+			ss.Close()
+			return nil, err
+		}
+		rows := r.(*SQLiteRows)
+		rows.tail = tail
+		rows.args = args
+		rows.argStart = start
+		return rows, nil
 	}
 }
 
 // Begin transaction.
 func (c *SQLiteConn) Begin() (driver.Tx, error) {
-	return c.begin(context.Background())
+	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
 func (c *SQLiteConn) begin(ctx context.Context) (driver.Tx, error) {
 	if _, err := c.exec(ctx, c.txlock, nil); err != nil {
 		return nil, err
 	}
-	return &SQLiteTx{c}, nil
+	return &SQLiteTx{c: c}, nil
 }
 
 // Open database and return a new connection.
@@ -1122,6 +1220,26 @@ func (c *SQLiteConn) begin(ctx context.Context) (driver.Tx, error) {
 //	_loc=XXX
 //	  Specify location of time format. It's possible to specify "auto".
 //
+//	_time_format=XXX
+//	  Specify how time.Time values are stored. XXX can be "default"
+//	  (the first of SQLiteTimestampFormats), "rfc3339nano" (text),
+//	  "unix", "unixmilli", "unixnano" (INTEGER) or "julian" (REAL Julian
+//	  day number, as returned by julianday()). REAL values read from DATE,
+//	  DATETIME and TIMESTAMP columns are only decoded as Julian day
+//	  numbers with "julian"; otherwise they are returned as float64.
+//
+//	_time_epoch=XXX
+//	  Specify the unit of INTEGER values read from DATE, DATETIME and
+//	  TIMESTAMP columns. XXX can be "s", "ms", "us", "ns" or "auto", which
+//	  treats values of 13 digits or more as milliseconds and smaller ones
+//	  as seconds. Defaults to the unit of _time_format, or "auto".
+//
+//	_time_parse=XXX
+//	  Specify a time.Parse layout tried when reading TEXT values from
+//	  DATE, DATETIME and TIMESTAMP columns. Repeat the parameter to try
+//	  several layouts in order. Replaces SQLiteDriver.TimeParseFormats and
+//	  SQLiteTimestampFormats for the connection.
+//
 //	_mutex=XXX
 //	  Specify mutex mode. XXX can be "no", "full".
 //
@@ -1129,6 +1247,19 @@ func (c *SQLiteConn) begin(ctx context.Context) (driver.Tx, error) {
 //	  Specify locking behavior for transactions.  XXX can be "immediate",
 //	  "deferred", "exclusive".
 //
+//	_reuse_buffers=Boolean
+//	  Return TEXT and BLOB values as []byte slices of a buffer that is
+//	  reused for every row, instead of allocating a new string or []byte
+//	  for each value. The slices are only valid until the next call to
+//	  Next, which is the contract of sql.RawBytes; Scan into any other
+//	  type copies them as usual.
+//
+//	_cksumvfs=Boolean
+//	  Open the database with the checksum VFS, which the sqlite_cksumvfs
+//	  build tag compiles in. A new database reserves 8 bytes at the end of
+//	  each page for a checksum, verified whenever the page is read.
+//	  SQLiteConn.VerifyChecksums checks all the pages.
+//
 //	_auto_vacuum=X | _vacuum=X
 //	  0 | none - Auto Vacuum disabled
 //	  1 | full - Auto Vacuum FULL
@@ -1188,6 +1319,10 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 
 	// Options
 	var loc *time.Location
+	timeFmt := timeFormatDefault
+	var timeEp *timeEpoch
+	timeParse := d.TimeParseFormats
+	reuseBuffers := false
 	authCreate := false
 	authUser := ""
 	authPass := ""
@@ -1251,6 +1386,36 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 			}
 		}
 
+		// _time_format
+		if val := params.Get("_time_format"); val != "" {
+			timeFmt, err = parseTimeFormat(val)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// _time_epoch
+		if val := params.Get("_time_epoch"); val != "" {
+			ep, err := parseTimeEpoch(val)
+			if err != nil {
+				return nil, err
+			}
+			timeEp = &ep
+		}
+
+		// _time_parse
+		if vals := params["_time_parse"]; len(vals) > 0 {
+			timeParse = nil
+			for _, val := range vals {
+				if val != "" {
+					timeParse = append(timeParse, val)
+				}
+			}
+			if timeParse == nil {
+				timeParse = d.TimeParseFormats
+			}
+		}
+
 		// _mutex
 		if val := params.Get("_mutex"); val != "" {
 			switch strings.ToLower(val) {
@@ -1548,6 +1713,18 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 			cacheSize = &iv
 		}
 
+		// _reuse_buffers
+		if val := params.Get("_reuse_buffers"); val != "" {
+			switch strings.ToLower(val) {
+			case "0", "no", "false", "off":
+				reuseBuffers = false
+			case "1", "yes", "true", "on":
+				reuseBuffers = true
+			default:
+				return nil, fmt.Errorf("Invalid _reuse_buffers: %v, expecting boolean value of '0 1 false true no yes off on'", val)
+			}
+		}
+
 		// _stmt_cache_size sets the maximum number of prepared statements
 		// cached per connection. Note that sql.DB is a connection pool, so
 		// each connection maintains its own independent cache.
@@ -1566,11 +1743,32 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 			vfsName = val
 		}
 
+		// _cksumvfs opens the database with the checksum VFS of the
+		// sqlite_cksumvfs build tag.
+		if val := params.Get("_cksumvfs"); val != "" {
+			switch strings.ToLower(val) {
+			case "0", "no", "false", "off":
+			case "1", "yes", "true", "on":
+				if vfsName != "" && vfsName != CksumVFSName {
+					return nil, fmt.Errorf("Invalid _cksumvfs: %v, the vfs is %v", val, vfsName)
+				}
+				vfsName = CksumVFSName
+			default:
+				return nil, fmt.Errorf("Invalid _cksumvfs: %v, expecting boolean value of '0 1 false true no yes off on'", val)
+			}
+		}
+
 		if !strings.HasPrefix(dsn, "file:") {
 			dsn = dsn[:pos]
 		}
 	}
 
+	if vfsName == CksumVFSName {
+		if err := registerCksumVFS(); err != nil {
+			return nil, err
+		}
+	}
+
 	var db *C.sqlite3
 	name := C.CString(dsn)
 	defer C.free(unsafe.Pointer(name))
@@ -1596,7 +1794,19 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 	}
 
 	// Create connection to SQLite
-	conn := &SQLiteConn{db: db, loc: loc, txlock: txlock}
+	conn := &SQLiteConn{
+		db:           db,
+		loc:          loc,
+		timeFormat:   timeFmt,
+		timeEpoch:    timeFmt.epoch(),
+		timeParse:    timeParse,
+		reuseBuffers: reuseBuffers,
+		txlock:       txlock,
+		interceptors: d.Interceptors,
+	}
+	if timeEp != nil {
+		conn.timeEpoch = *timeEp
+	}
 	if stmtCacheSize > 0 {
 		conn.stmtCache = make([]*SQLiteStmt, 0, stmtCacheSize)
 		conn.stmtCacheEnabled = true
@@ -1624,6 +1834,13 @@ func (d *SQLiteDriver) Open(dsn string) (driver.Conn, error) {
 		return fail(err)
 	}
 
+	// Reserved bytes, for VFSes that store data at the end of the pages.
+	if vfsName != "" {
+		if err := conn.reserveVFSBytes(vfsName); err != nil {
+			return fail(err)
+		}
+	}
+
 	// USER AUTHENTICATION
 	//
 	// User Authentication is always performed even when
@@ -2009,7 +2226,7 @@ func finalizeCachedStmt(s *SQLiteStmt) {
 
 // Prepare the query string. Return a new statement.
 func (c *SQLiteConn) Prepare(query string) (driver.Stmt, error) {
-	return c.prepare(context.Background(), query)
+	return c.PrepareContext(context.Background(), query)
 }
 
 func (c *SQLiteConn) prepare(ctx context.Context, query string) (driver.Stmt, error) {
@@ -2296,6 +2513,15 @@ func (s *SQLiteStmt) bindError(v driver.Value) error {
 	return fmt.Errorf("sqlite3: unsupported bind type %T", v)
 }
 
+// timeValue converts time.Time values to the storage format selected with
+// _time_format. Other values are returned unchanged.
+func (c *SQLiteConn) timeValue(v driver.Value) driver.Value {
+	if t, ok := v.(time.Time); ok && c.timeFormat != timeFormatDefault {
+		return c.timeFormat.encode(t)
+	}
+	return v
+}
+
 func (s *SQLiteStmt) bind(args []driver.NamedValue) error {
 	rv := C._sqlite3_reset_clear(s.s)
 	if rv != C.SQLITE_ROW && rv != C.SQLITE_OK && rv != C.SQLITE_DONE {
@@ -2313,7 +2539,7 @@ func (s *SQLiteStmt) bind(args []driver.NamedValue) error {
 	if !hasNamed {
 		for _, arg := range args {
 			n := C.int(arg.Ordinal)
-			rv = bindValue(s.s, n, arg.Value)
+			rv = bindValue(s.s, n, s.c.timeValue(arg.Value))
 			if rv != C.SQLITE_OK {
 				return s.bindError(arg.Value)
 			}
@@ -2323,18 +2549,19 @@ func (s *SQLiteStmt) bind(args []driver.NamedValue) error {
 
 	for _, arg := range args {
 		if arg.Name == "" {
-			rv = bindValue(s.s, C.int(arg.Ordinal), arg.Value)
+			rv = bindValue(s.s, C.int(arg.Ordinal), s.c.timeValue(arg.Value))
 			if rv != C.SQLITE_OK {
 				return s.bindError(arg.Value)
 			}
 			continue
 		}
+		value := s.c.timeValue(arg.Value)
 		indices := s.bindNamedIndices(arg.Name)
 		for _, idx := range indices {
 			if idx == 0 {
 				continue
 			}
-			rv = bindValue(s.s, C.int(idx), arg.Value)
+			rv = bindValue(s.s, C.int(idx), value)
 			if rv != C.SQLITE_OK {
 				return s.bindError(arg.Value)
 			}
@@ -2345,7 +2572,7 @@ func (s *SQLiteStmt) bind(args []driver.NamedValue) error {
 
 // Query the statement with arguments. Return records.
 func (s *SQLiteStmt) Query(args []driver.Value) (driver.Rows, error) {
-	return s.query(context.Background(), valueToNamedValue(args))
+	return s.QueryContext(context.Background(), valueToNamedValue(args))
 }
 
 func (s *SQLiteStmt) query(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
@@ -2384,7 +2611,7 @@ func (r *SQLiteResult) RowsAffected() (int64, error) {
 
 // Exec execute the statement with arguments. Return result object.
 func (s *SQLiteStmt) Exec(args []driver.Value) (driver.Result, error) {
-	return s.exec(context.Background(), valueToNamedValue(args))
+	return s.ExecContext(context.Background(), valueToNamedValue(args))
 }
 
 func valueToNamedValue(args []driver.Value) []driver.NamedValue {
@@ -2448,13 +2675,24 @@ func (s *SQLiteStmt) execSync(args []driver.NamedValue) (driver.Result, error) {
 	rv := C._sqlite3_step_row_internal(s.s, &rowid, &changes)
 	if rv != C.SQLITE_ROW && rv != C.SQLITE_OK && rv != C.SQLITE_DONE {
 		err := s.c.lastError()
+		if s.c.hooks.watchingSteps() {
+			s.c.hooks.afterStep(s.s, false)
+		}
 		C._sqlite3_reset_clear(s.s)
 		return nil, err
 	}
+	if s.c.hooks.watchingSteps() {
+		s.c.hooks.afterStep(s.s, true)
+	}
 
 	return &SQLiteResult{id: int64(rowid), changes: int64(changes)}, nil
 }
 
+// sql returns the text of the statement as it was prepared.
+func (s *SQLiteStmt) sql() string {
+	return C.GoString(C.sqlite3_sql(s.s))
+}
+
 // Readonly reports if this statement is considered readonly by SQLite.
 //
 // See: https://sqlite.org/c3ref/stmt_readonly.html
@@ -2462,8 +2700,22 @@ func (s *SQLiteStmt) Readonly() bool {
 	return C.sqlite3_stmt_readonly(s.s) == 1
 }
 
-// Close the rows.
+// Close the rows. The statements of a multi-statement query that
+// NextResultSet has not reached yet are executed to completion first.
 func (rc *SQLiteRows) Close() error {
+	if rc.tail == "" || rc.s == nil {
+		return rc.close()
+	}
+	c := rc.s.c
+	tail, args, start := rc.tail, rc.args, rc.argStart
+	rc.tail = ""
+	if err := rc.close(); err != nil {
+		return err
+	}
+	return c.execRest(rc.ctx, tail, args, start)
+}
+
+func (rc *SQLiteRows) close() error {
 	rc.closemu.Lock()
 	defer rc.closemu.Unlock()
 	s := rc.s
@@ -2484,6 +2736,11 @@ func (rc *SQLiteRows) Close() error {
 		s.mu.Unlock()
 		return nil
 	}
+	// Resetting or finalizing a statement that was not stepped to
+	// completion may end an implicit transaction.
+	if c := s.c; c.hooks.watchingSteps() {
+		defer c.hooks.afterStep(nil, true)
+	}
 	if rc.cls {
 		s.mu.Unlock()
 		return s.Close()
@@ -2557,6 +2814,7 @@ func (rc *SQLiteRows) declTypes() []string {
 				rc.decltype[i] = strings.ToLower(C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i))))
 			}
 		}
+		rc.coltypes = rc.s.c.columnTypesFor(rc.decltype)
 	}
 	return rc.decltype
 }
@@ -2610,6 +2868,9 @@ func (rc *SQLiteRows) Next(dest []driver.Value) error {
 // nextSyncLocked moves cursor to next; must be called with locked mutex.
 func (rc *SQLiteRows) nextSyncLocked(dest []driver.Value) error {
 	rv := C._sqlite3_step_internal(rc.s.s)
+	if rv != C.SQLITE_ROW && rc.s.c.hooks.watchingSteps() {
+		defer rc.s.c.hooks.afterStep(rc.s.s, rv == C.SQLITE_DONE)
+	}
 	if rv == C.SQLITE_DONE {
 		return io.EOF
 	}
@@ -2628,75 +2889,60 @@ func (rc *SQLiteRows) nextSyncLocked(dest []driver.Value) error {
 	C._sqlite3_column_values(rc.s.s, C.int(len(dest)), rc.colvals)
 	colvals := (*[(math.MaxInt32 - 1) / unsafe.Sizeof(C.sqlite3_go_col{})]C.sqlite3_go_col)(unsafe.Pointer(rc.colvals))[:len(dest):len(dest)]
 
-	decltype := rc.decltype
-	_ = decltype[len(dest)-1]
+	reuse := rc.s.c.reuseBuffers
+	if reuse {
+		rc.buf = rc.buf[:0]
+	}
+	coltypes := rc.coltypes
 	for i := range dest {
 		col := &colvals[i]
+		var ct *columnType
+		if coltypes != nil {
+			ct = coltypes[i]
+		}
+		var val any
 		switch col.typ {
 		case C.SQLITE_INTEGER:
-			val := int64(col.i64)
-			switch decltype[i] {
-			case columnTimestamp, columnDatetime, columnDate:
-				var t time.Time
-				// Assume a millisecond unix timestamp if it's 13 digits -- too
-				// large to be a reasonable timestamp in seconds.
-				if val > 1e12 || val < -1e12 {
-					val *= int64(time.Millisecond) // convert ms to nsec
-					t = time.Unix(0, val)
-				} else {
-					t = time.Unix(val, 0)
-				}
-				t = t.UTC()
-				if rc.s.c.loc != nil {
-					t = t.In(rc.s.c.loc)
-				}
-				dest[i] = t
-			case "boolean":
-				dest[i] = val > 0
-			default:
-				dest[i] = val
-			}
+			val = int64(col.i64)
 		case C.SQLITE_FLOAT:
-			dest[i] = float64(col.f64)
+			val = float64(col.f64)
 		case C.SQLITE_BLOB:
 			p := col.ptr
-			if p == nil {
-				dest[i] = []byte{}
-				continue
+			switch {
+			case p == nil:
+				val = []byte{}
+			case reuse && ct == nil:
+				val = rc.appendBuf(p, col.n)
+			default:
+				val = C.GoBytes(p, col.n)
 			}
-			n := col.n
-			dest[i] = C.GoBytes(p, n)
 		case C.SQLITE_NULL:
 			dest[i] = nil
+			continue
 		case C.SQLITE_TEXT:
-			var err error
-			var timeVal time.Time
-
-			n := int(col.n)
-			s := C.GoStringN((*C.char)(unsafe.Pointer(col.ptr)), C.int(n))
-
-			switch decltype[i] {
-			case columnTimestamp, columnDatetime, columnDate:
-				var t time.Time
-				s = strings.TrimSuffix(s, "Z")
-				for _, format := range SQLiteTimestampFormats {
-					if timeVal, err = time.ParseInLocation(format, s, time.UTC); err == nil {
-						t = timeVal
-						break
-					}
-				}
-				if err != nil {
-					// The column is a time value, so return the zero time on parse failure.
-					t = time.Time{}
-				}
-				if rc.s.c.loc != nil {
-					t = t.In(rc.s.c.loc)
-				}
-				dest[i] = t
+			switch {
+			case reuse && ct == nil:
+				val = rc.appendBuf(unsafe.Pointer(col.ptr), col.n)
 			default:
-				dest[i] = s
+				val = C.GoStringN((*C.char)(unsafe.Pointer(col.ptr)), col.n)
 			}
 		}
+		if ct != nil {
+			var err error
+			if val, err = ct.decode(rc.s.c, val); err != nil {
+				return fmt.Errorf("sqlite3: decoding column %d: %w", i, err)
+			}
+		}
+		dest[i] = val
 	}
 	return nil
 }
+
+// appendBuf copies n bytes at p to rc.buf and returns them. Growing rc.buf
+// leaves the slices returned for earlier columns pointing at the old array,
+// which stays valid.
+func (rc *SQLiteRows) appendBuf(p unsafe.Pointer, n C.int) []byte {
+	start := len(rc.buf)
+	rc.buf = append(rc.buf, unsafe.Slice((*byte)(p), int(n))...)
+	return rc.buf[start:len(rc.buf):len(rc.buf)]
+}
@@ -0,0 +1,296 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+#include <stdint.h>
+
+#ifdef SQLITE_ENABLE_UNLOCK_NOTIFY
+extern int _sqlite3_step_blocking(sqlite3_stmt *stmt);
+#define _sqlite3_batch_step _sqlite3_step_blocking
+#else
+#define _sqlite3_batch_step sqlite3_step
+#endif
+
+// One bound parameter. TEXT and BLOB values are stored in a separate data
+// buffer at off, so that the argument array holds no pointers.
+typedef struct {
+  int typ;
+  sqlite3_int64 i64;
+  double f64;
+  sqlite3_int64 off;
+  sqlite3_int64 n;
+} sqlite3_go_arg;
+
+// Binds and steps nrow argument sets of nparam values each. On return
+// *done is the number of rows that completed; on error the row at *done
+// failed. The bindings are cleared before returning, so the statement no
+// longer refers to data.
+static int
+_sqlite3_exec_batch(sqlite3_stmt *stmt, int nparam, int nrow, sqlite3_go_arg *args, const char *data, long long *rowid, long long *changes, int *done)
+{
+  sqlite3 *db = sqlite3_db_handle(stmt);
+  int rv = SQLITE_OK;
+  int r;
+  for (r = 0; r < nrow; r++) {
+    sqlite3_go_arg *row = &args[(size_t)r * nparam];
+    int i;
+    sqlite3_reset(stmt);
+    for (i = 0; i < nparam && rv == SQLITE_OK; i++) {
+      sqlite3_go_arg *a = &row[i];
+      switch (a->typ) {
+      case SQLITE_INTEGER:
+        rv = sqlite3_bind_int64(stmt, i + 1, a->i64);
+        break;
+      case SQLITE_FLOAT:
+        rv = sqlite3_bind_double(stmt, i + 1, a->f64);
+        break;
+      case SQLITE_TEXT:
+        rv = sqlite3_bind_text64(stmt, i + 1, a->n ? data + a->off : "", a->n, SQLITE_STATIC, SQLITE_UTF8);
+        break;
+      case SQLITE_BLOB:
+        if (a->n) {
+          rv = sqlite3_bind_blob64(stmt, i + 1, data + a->off, a->n, SQLITE_STATIC);
+        } else {
+          rv = sqlite3_bind_zeroblob(stmt, i + 1, 0);
+        }
+        break;
+      default:
+        rv = sqlite3_bind_null(stmt, i + 1);
+        break;
+      }
+    }
+    if (rv != SQLITE_OK) {
+      break;
+    }
+    rv = _sqlite3_batch_step(stmt);
+    if (rv != SQLITE_DONE && rv != SQLITE_ROW) {
+      break;
+    }
+    rv = SQLITE_OK;
+    *rowid = (long long) sqlite3_last_insert_rowid(db);
+    *changes += (long long) sqlite3_changes(db);
+  }
+  *done = r;
+  sqlite3_reset(stmt);
+  sqlite3_clear_bindings(stmt);
+  return rv;
+}
+*/
+import "C"
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// batchChunkRows is the number of argument sets passed to SQLite per cgo
+// call by ExecBatch. The context is checked between chunks.
+const batchChunkRows = 1024
+
+// BatchError is returned by ExecBatch when one of the argument sets fails.
+type BatchError struct {
+	// Row is the index of the argument set that failed.
+	Row int
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("sqlite3: batch row %d: %v", e.Row, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ExecBatch executes query once for each argument set in rows. The query is
+// prepared once and the argument sets are bound and stepped in chunks inside
+// SQLite, so a large batch costs a few cgo calls rather than several per row.
+//
+// The batch runs inside a savepoint: it is committed on its own when the
+// connection is not in a transaction, and on error every row of the batch is
+// rolled back while an enclosing transaction stays open, unless the error
+// itself rolled that back, as OR ROLLBACK does. A failing row is reported as
+// a *BatchError carrying its index.
+//
+// Each argument set must have exactly one value per parameter of query.
+// Values are converted like the arguments of Exec. The returned result
+// reports the total number of changed rows and the rowid of the last insert.
+//
+// The context is checked between chunks of rows.
+func (c *SQLiteConn) ExecBatch(ctx context.Context, query string, rows [][]driver.Value) (driver.Result, error) {
+	if len(c.interceptors) > 0 {
+		ch := newInterceptorChain(c.interceptors)
+		ictx, q, err := ch.beforeExec(ctx, query, nil)
+		if err != nil {
+			ch.afterExec(execEvent(query, nil, 0, nil, err))
+			return nil, err
+		}
+		start := time.Now()
+		res, err := c.execBatch(ictx, q, rows)
+		ch.afterExec(execEvent(q, nil, time.Since(start), res, err))
+		return res, err
+	}
+	return c.execBatch(ctx, query, rows)
+}
+
+func (c *SQLiteConn) execBatch(ctx context.Context, query string, rows [][]driver.Value) (driver.Result, error) {
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s := stmt.(*SQLiteStmt)
+	defer s.Close()
+	if s.s == nil {
+		return nil, fmt.Errorf("sqlite3: empty batch query")
+	}
+	if s.t != "" {
+		return nil, fmt.Errorf("sqlite3: batch query must be a single statement")
+	}
+
+	if _, err := c.exec(ctx, "SAVEPOINT go_sqlite3_batch", nil); err != nil {
+		return nil, err
+	}
+	res, err := c.execBatchRows(ctx, s, rows)
+	// The savepoint keeps a transaction open, so autocommit means that the
+	// error, like an OR ROLLBACK conflict or SQLITE_FULL, already rolled
+	// back the transaction and the savepoint with it.
+	if c.AutoCommit() {
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	if err != nil {
+		if _, rerr := c.exec(context.Background(), "ROLLBACK TO go_sqlite3_batch", nil); rerr != nil {
+			err = joinBatchError(err, rerr)
+		}
+	}
+	if _, rerr := c.exec(context.Background(), "RELEASE go_sqlite3_batch", nil); rerr != nil {
+		err = joinBatchError(err, rerr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// joinBatchError adds rerr, an error ending the savepoint of a batch, to
+// err, keeping err a *BatchError if it is one.
+func joinBatchError(err, rerr error) error {
+	if be, ok := err.(*BatchError); ok {
+		return &BatchError{Row: be.Row, Err: errors.Join(be.Err, rerr)}
+	}
+	return errors.Join(err, rerr)
+}
+
+func (c *SQLiteConn) execBatchRows(ctx context.Context, s *SQLiteStmt, rows [][]driver.Value) (*SQLiteResult, error) {
+	nparam := int(C.sqlite3_bind_parameter_count(s.s))
+	var rowid, changes C.longlong
+	var args []C.sqlite3_go_arg
+	var data []byte
+	for base := 0; base < len(rows); base += batchChunkRows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		chunk := rows[base:min(base+batchChunkRows, len(rows))]
+
+		args = args[:0]
+		data = data[:0]
+		for i, row := range chunk {
+			if len(row) != nparam {
+				return nil, &BatchError{Row: base + i, Err: fmt.Errorf("expected %d arguments, got %d", nparam, len(row))}
+			}
+			for _, v := range row {
+				var a C.sqlite3_go_arg
+				var err error
+				if a, data, err = c.batchArg(v, data); err != nil {
+					return nil, &BatchError{Row: base + i, Err: err}
+				}
+				args = append(args, a)
+			}
+		}
+		if nparam == 0 || len(chunk) == 0 {
+			// Keep the argument pointer valid for parameterless queries.
+			args = append(args, C.sqlite3_go_arg{})
+		}
+		if len(data) == 0 {
+			data = append(data, 0)
+		}
+
+		var done C.int
+		rv := C._sqlite3_exec_batch(s.s, C.int(nparam), C.int(len(chunk)), &args[0],
+			(*C.char)(unsafe.Pointer(&data[0])), &rowid, &changes, &done)
+		ok := rv == C.SQLITE_OK
+		if c.hooks.watchingSteps() {
+			c.hooks.afterStep(s.s, ok)
+		}
+		if !ok {
+			return nil, &BatchError{Row: base + int(done), Err: c.lastError()}
+		}
+	}
+	return &SQLiteResult{id: int64(rowid), changes: int64(changes)}, nil
+}
+
+// batchArg encodes one argument for _sqlite3_exec_batch, appending TEXT and
+// BLOB contents to data.
+func (c *SQLiteConn) batchArg(v driver.Value, data []byte) (C.sqlite3_go_arg, []byte, error) {
+	var a C.sqlite3_go_arg
+	if !driver.IsValue(v) {
+		var err error
+		if v, err = driver.DefaultParameterConverter.ConvertValue(v); err != nil {
+			return a, data, err
+		}
+	}
+	switch v := c.timeValue(v).(type) {
+	case nil:
+		a.typ = C.SQLITE_NULL
+	case int64:
+		a.typ = C.SQLITE_INTEGER
+		a.i64 = C.sqlite3_int64(v)
+	case bool:
+		a.typ = C.SQLITE_INTEGER
+		if v {
+			a.i64 = 1
+		}
+	case float64:
+		a.typ = C.SQLITE_FLOAT
+		a.f64 = C.double(v)
+	case string:
+		a.typ = C.SQLITE_TEXT
+		a.off = C.sqlite3_int64(len(data))
+		a.n = C.sqlite3_int64(len(v))
+		data = append(data, v...)
+	case []byte:
+		if v == nil {
+			a.typ = C.SQLITE_NULL
+			break
+		}
+		a.typ = C.SQLITE_BLOB
+		a.off = C.sqlite3_int64(len(data))
+		a.n = C.sqlite3_int64(len(v))
+		data = append(data, v...)
+	case time.Time:
+		a.typ = C.SQLITE_TEXT
+		a.off = C.sqlite3_int64(len(data))
+		data = v.AppendFormat(data, SQLiteTimestampFormats[0])
+		a.n = C.sqlite3_int64(len(data)) - a.off
+	default:
+		return a, data, fmt.Errorf("unsupported type %T", v)
+	}
+	return a, data, nil
+}
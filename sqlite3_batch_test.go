@@ -0,0 +1,198 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExecBatch(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+	ctx := context.Background()
+
+	if _, err := c.exec(ctx, "create table foo (id integer primary key, s text, b blob, f real, ts datetime)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC)
+	rows := make([][]driver.Value, 2500)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i + 1), fmt.Sprint("row ", i), []byte{byte(i)}, float64(i) / 2, ts}
+	}
+	rows[1][1] = ""
+	rows[1][2] = []byte{}
+	rows[2][1] = nil
+	rows[2][2] = []byte(nil)
+	rows[3][3] = 7 // converted with driver.DefaultParameterConverter
+
+	res, err := c.ExecBatch(ctx, "insert into foo values (?, ?, ?, ?, ?)", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != int64(len(rows)) {
+		t.Errorf("expected %d rows affected, got %d", len(rows), n)
+	}
+	if id, _ := res.LastInsertId(); id != int64(len(rows)) {
+		t.Errorf("expected last insert id %d, got %d", len(rows), id)
+	}
+	if !c.AutoCommit() {
+		t.Error("expected the batch to be committed")
+	}
+
+	check := func(query string, expected ...any) {
+		t.Helper()
+		r, err := c.query(ctx, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		dest := make([]driver.Value, len(expected))
+		if err := r.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		for i := range expected {
+			if fmt.Sprintf("%#v", dest[i]) != fmt.Sprintf("%#v", expected[i]) {
+				t.Errorf("%s: column %d: expected %#v, got %#v", query, i, expected[i], dest[i])
+			}
+		}
+	}
+	check("select count(*), sum(f) from foo", int64(2500), float64(2499*2500/2)/2+7-1.5)
+	check("select s, typeof(b), length(b) from foo where id = 2", "", "blob", int64(0))
+	check("select typeof(s), typeof(b) from foo where id = 3", "null", "null")
+	check("select ts from foo where id = 1", ts)
+
+	// A failing row rolls back the whole batch and reports its index.
+	rows = [][]driver.Value{
+		{int64(3000), "a", nil, nil, nil},
+		{int64(3001), "b", nil, nil, nil},
+		{int64(1), "duplicate", nil, nil, nil},
+	}
+	_, err = c.ExecBatch(ctx, "insert into foo values (?, ?, ?, ?, ?)", rows)
+	var berr *BatchError
+	if !errors.As(err, &berr) || berr.Row != 2 {
+		t.Fatalf("expected BatchError for row 2, got %v", err)
+	}
+	var serr Error
+	if !errors.As(err, &serr) || serr.Code != ErrConstraint {
+		t.Errorf("expected constraint error, got %v", err)
+	}
+	check("select count(*) from foo", int64(2500))
+
+	// Argument count mismatches are reported before anything runs.
+	_, err = c.ExecBatch(ctx, "delete from foo where id = ?", [][]driver.Value{{int64(1)}, {}})
+	if !errors.As(err, &berr) || berr.Row != 1 {
+		t.Fatalf("expected BatchError for row 1, got %v", err)
+	}
+
+	// Inside a transaction the batch is rolled back on its own.
+	if _, err := c.exec(ctx, "begin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecBatch(ctx, "delete from foo where id = ?", [][]driver.Value{{int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecBatch(ctx, "insert into foo (id) values (?)", [][]driver.Value{{int64(5000)}, {int64(2)}}); err == nil {
+		t.Fatal("expected error")
+	}
+	if c.AutoCommit() {
+		t.Fatal("expected the transaction to stay open")
+	}
+	if _, err := c.exec(ctx, "commit", nil); err != nil {
+		t.Fatal(err)
+	}
+	check("select count(*), count(nullif(id, 5000)) from foo", int64(2499), int64(2499))
+
+	// OR ROLLBACK ends the transaction and the savepoint with it; the error
+	// still names the row and no savepoint is left open.
+	if _, err := c.exec(ctx, "begin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.exec(ctx, "insert into foo (id) values (6000)", nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.ExecBatch(ctx, "insert or rollback into foo (id) values (?)", [][]driver.Value{{int64(7000)}, {int64(2)}})
+	if !errors.As(err, &berr) || berr.Row != 1 {
+		t.Fatalf("expected BatchError for row 1, got %v", err)
+	}
+	if !c.AutoCommit() {
+		t.Fatal("expected the transaction to be rolled back")
+	}
+	if _, err := c.ExecBatch(ctx, "insert into foo (id) values (?)", [][]driver.Value{{int64(8000)}}); err != nil {
+		t.Fatal(err)
+	}
+	if !c.AutoCommit() {
+		t.Error("expected the batch to be committed")
+	}
+	check("select count(*), count(nullif(id, 8000)) from foo", int64(2500), int64(2499))
+
+	// Cancelled contexts are honored.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.ExecBatch(cctx, "delete from foo where id = ?", [][]driver.Value{{int64(2)}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func BenchmarkExecBatch(b *testing.B) {
+	const n = 10000
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i), "some text value", float64(i)}
+	}
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+	ctx := context.Background()
+	if _, err := c.exec(ctx, "create table foo (a integer, b text, c real)", nil); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.ExecBatch(ctx, "insert into foo values (?, ?, ?)", rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stmt", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.exec(ctx, "begin", nil); err != nil {
+				b.Fatal(err)
+			}
+			s, err := c.prepare(ctx, "insert into foo values (?, ?, ?)")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, row := range rows {
+				if _, err := s.(*SQLiteStmt).exec(ctx, valueToNamedValue(row)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			s.Close()
+			if _, err := c.exec(ctx, "commit", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,280 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+*/
+import "C"
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Change describes a single row change made by a committed transaction.
+type Change struct {
+	// Op is one of SQLITE_INSERT, SQLITE_UPDATE or SQLITE_DELETE.
+	Op           int
+	DatabaseName string
+	TableName    string
+	// OldRowID is the rowid of the row before an UPDATE or DELETE and
+	// NewRowID the rowid after an INSERT or UPDATE.
+	OldRowID int64
+	NewRowID int64
+	// Old and New hold the column values before and after the change, as
+	// int64, float64, string, []byte or nil. They are only populated when
+	// built with the sqlite_preupdate_hook tag; Old is nil for INSERT and
+	// New is nil for DELETE.
+	Old []any
+	New []any
+}
+
+// ChangeFeed collects the row changes made on a connection and delivers
+// them per transaction, once the transaction has been committed.
+//
+// Changes are buffered while a transaction is open. They are discarded when
+// the transaction rolls back and trimmed back when a savepoint is rolled
+// back with ROLLBACK TO or a statement inside the transaction fails. A
+// statement that fails under ON CONFLICT FAIL inside an explicit
+// transaction keeps its earlier changes in SQLite but not in the feed.
+//
+// As with the update hook, changes made to WITHOUT ROWID tables (unless
+// built with sqlite_preupdate_hook) and rows removed by the truncate
+// optimization are not reported.
+type ChangeFeed struct {
+	c        *SQLiteConn
+	callback func([]Change)
+
+	mu         sync.Mutex
+	pending    []Change
+	ready      []Change
+	stmtMark   int
+	savepoints []feedSavepoint
+	removes    []func()
+}
+
+type feedSavepoint struct {
+	name string
+	mark int
+}
+
+// NewChangeFeed starts collecting row changes on the connection. callback is
+// called with the changes of each committed transaction that modified at
+// least one row, in the order they were made.
+//
+// The callback runs on the goroutine that executed the COMMIT (or the
+// statement that committed implicitly), after the commit succeeded and
+// before control returns to the caller. It must not use the connection.
+//
+// The feed is built on the Add*Hook methods and does not interfere with
+// other hooks registered on the connection.
+func (c *SQLiteConn) NewChangeFeed(callback func([]Change)) (*ChangeFeed, error) {
+	if callback == nil {
+		return nil, errors.New("sqlite3: NewChangeFeed requires a callback")
+	}
+	f := &ChangeFeed{c: c, callback: callback}
+	f.removes = []func(){
+		c.AddCommitHook(f.commit),
+		c.AddRollbackHook(f.rollback),
+		f.subscribe(),
+		c.addStepHook(f.afterStep),
+	}
+	return f, nil
+}
+
+// Close stops the feed. Changes of transactions that have not been
+// committed yet are dropped.
+func (f *ChangeFeed) Close() {
+	for _, remove := range f.removes {
+		remove()
+	}
+	f.mu.Lock()
+	f.reset()
+	f.mu.Unlock()
+}
+
+func (f *ChangeFeed) record(ch Change) {
+	f.mu.Lock()
+	f.pending = append(f.pending, ch)
+	f.mu.Unlock()
+}
+
+func (f *ChangeFeed) reset() {
+	f.pending = nil
+	f.ready = nil
+	f.stmtMark = 0
+	f.savepoints = nil
+}
+
+// commit is a commit hook. The commit may still fail after the hook has
+// run, so the pending changes are only set aside here and delivered by
+// afterStep once the connection is back in autocommit mode. If the commit
+// fails, SQLite either calls the rollback hook or leaves the transaction
+// open, in which case the next commit hook replaces ready.
+func (f *ChangeFeed) commit() int {
+	f.mu.Lock()
+	f.ready = make([]Change, len(f.pending))
+	copy(f.ready, f.pending)
+	f.mu.Unlock()
+	return 0
+}
+
+func (f *ChangeFeed) rollback() {
+	f.mu.Lock()
+	f.reset()
+	f.mu.Unlock()
+}
+
+func (f *ChangeFeed) afterStep(stmt *C.sqlite3_stmt, ok bool) {
+	f.mu.Lock()
+	if !ok {
+		f.pending = f.pending[:f.stmtMark]
+	} else if stmt != nil {
+		f.savepoint(stmt)
+	}
+	f.stmtMark = len(f.pending)
+
+	var batch []Change
+	if f.ready != nil && C.sqlite3_get_autocommit(f.c.db) != 0 {
+		batch = f.ready
+		f.reset()
+	}
+	f.mu.Unlock()
+
+	if len(batch) > 0 {
+		f.callback(batch)
+	}
+}
+
+// savepoint updates the savepoint stack for stmt, if it is a SAVEPOINT,
+// RELEASE or ROLLBACK TO statement that completed successfully. Those are
+// read-only statements without columns, told apart by their leading
+// keywords.
+func (f *ChangeFeed) savepoint(stmt *C.sqlite3_stmt) {
+	if C.sqlite3_stmt_readonly(stmt) == 0 || C.sqlite3_column_count(stmt) != 0 || C.sqlite3_stmt_isexplain(stmt) != 0 {
+		return
+	}
+	words := leadingWords(C.GoString(C.sqlite3_sql(stmt)), 5)
+	if len(words) < 2 {
+		return
+	}
+	switch strings.ToUpper(words[0]) {
+	case "SAVEPOINT":
+		f.savepoints = append(f.savepoints, feedSavepoint{name: words[1], mark: len(f.pending)})
+	case "RELEASE":
+		if i := f.findSavepoint(savepointName(words[1:])); i >= 0 {
+			f.savepoints = f.savepoints[:i]
+		}
+	case "ROLLBACK":
+		words = words[1:]
+		if strings.EqualFold(words[0], "TRANSACTION") {
+			words = words[1:]
+		}
+		if len(words) < 2 || !strings.EqualFold(words[0], "TO") {
+			return
+		}
+		if i := f.findSavepoint(savepointName(words[1:])); i >= 0 {
+			// ROLLBACK TO keeps the savepoint itself on the stack.
+			f.pending = f.pending[:f.savepoints[i].mark]
+			f.savepoints = f.savepoints[:i+1]
+		}
+	}
+}
+
+// savepointName returns the name in the words following RELEASE or
+// ROLLBACK TO, which may start with the optional SAVEPOINT keyword.
+func savepointName(words []string) string {
+	if len(words) > 1 && strings.EqualFold(words[0], "SAVEPOINT") {
+		return words[1]
+	}
+	return words[0]
+}
+
+// findSavepoint returns the index of the innermost savepoint called name,
+// compared as SQLite does, or -1.
+func (f *ChangeFeed) findSavepoint(name string) int {
+	for i := len(f.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(f.savepoints[i].name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// leadingWords returns up to n words from the start of sql, skipping
+// comments and unquoting identifiers. It stops at the end of the first
+// statement.
+func leadingWords(sql string, n int) []string {
+	var words []string
+	for len(words) < n {
+		sql = strings.TrimLeft(sql, " \t\r\n\f")
+		switch {
+		case sql == "" || sql[0] == ';':
+			return words
+		case strings.HasPrefix(sql, "--"):
+			if i := strings.IndexByte(sql, '\n'); i >= 0 {
+				sql = sql[i+1:]
+			} else {
+				sql = ""
+			}
+			continue
+		case strings.HasPrefix(sql, "/*"):
+			if i := strings.Index(sql[2:], "*/"); i >= 0 {
+				sql = sql[i+4:]
+			} else {
+				sql = ""
+			}
+			continue
+		}
+		var word string
+		switch q := sql[0]; q {
+		case '"', '`', '\'':
+			// A quote inside the identifier is doubled.
+			var b strings.Builder
+			i := 1
+			for {
+				j := strings.IndexByte(sql[i:], q)
+				if j < 0 {
+					return words
+				}
+				b.WriteString(sql[i : i+j])
+				i += j + 1
+				if i < len(sql) && sql[i] == q {
+					b.WriteByte(q)
+					i++
+					continue
+				}
+				break
+			}
+			word, sql = b.String(), sql[i:]
+		case '[':
+			i := strings.IndexByte(sql, ']')
+			if i < 0 {
+				return words
+			}
+			word, sql = sql[1:i], sql[i+1:]
+		default:
+			i := strings.IndexAny(sql, " \t\r\n\f;-/\"`'[")
+			if i < 0 {
+				i = len(sql)
+			}
+			if i == 0 {
+				return words
+			}
+			word, sql = sql[:i], sql[i:]
+		}
+		words = append(words, word)
+	}
+	return words
+}
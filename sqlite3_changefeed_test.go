@@ -0,0 +1,189 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestChangeFeed(t *testing.T) {
+	var batches [][]Change
+	var feed *ChangeFeed
+
+	sql.Register("sqlite3_ChangeFeed", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			var err error
+			feed, err = conn.NewChangeFeed(func(changes []Change) {
+				batches = append(batches, changes)
+			})
+			return err
+		},
+	})
+	db, err := sql.Open("sqlite3_ChangeFeed", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mustExec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	rowids := func(batch []Change) []int64 {
+		var ids []int64
+		for _, ch := range batch {
+			if ch.Op == SQLITE_DELETE {
+				ids = append(ids, -ch.OldRowID)
+			} else {
+				ids = append(ids, ch.NewRowID)
+			}
+		}
+		return ids
+	}
+
+	mustExec("create table foo (id integer primary key, name text unique)")
+
+	// Autocommit statements are delivered one batch per statement.
+	mustExec("insert into foo values (1, 'a')")
+	mustExec("insert into foo values (?, ?)", 2, "b")
+	if len(batches) != 2 || !reflect.DeepEqual(rowids(batches[0]), []int64{1}) || !reflect.DeepEqual(rowids(batches[1]), []int64{2}) {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	if ch := batches[0][0]; ch.Op != SQLITE_INSERT || ch.DatabaseName != "main" || ch.TableName != "foo" {
+		t.Errorf("unexpected change %+v", ch)
+	}
+
+	// Nothing is delivered until the transaction commits.
+	batches = nil
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("insert into foo values (3, 'c')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("delete from foo where id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	// A failing statement does not leave its changes behind.
+	if _, err := tx.Exec("insert into foo values (4, 'd'), (5, 'c')"); err == nil {
+		t.Fatal("expected unique constraint violation")
+	}
+	if len(batches) != 0 {
+		t.Fatalf("changes delivered before commit: %v", batches)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 1 || !reflect.DeepEqual(rowids(batches[0]), []int64{3, -1}) {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+
+	// Rolled back transactions are discarded.
+	batches = nil
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("insert into foo values (6, 'f')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	mustExec("update foo set name = 'bb' where id = 2")
+	if len(batches) != 1 || !reflect.DeepEqual(rowids(batches[0]), []int64{2}) || batches[0][0].Op != SQLITE_UPDATE {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+
+	// Savepoints rolled back with ROLLBACK TO drop their changes only.
+	batches = nil
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"savepoint outer_sp",
+		"insert into foo values (7, 'g')",
+		"/* inner */ savepoint \"Inner Point\"",
+		"insert into foo values (8, 'h')",
+		"rollback transaction to savepoint [inner point]",
+		"insert into foo values (9, 'i')",
+		"release \"Inner Point\"",
+		"savepoint other; insert into foo values (10, 'j'); -- undone\nrollback to other",
+		`savepoint "q""uote"`,
+		"insert into foo values (13, 'm')",
+		`rollback to 'q"uote'`,
+		"release outer_sp",
+	} {
+		if _, err := conn.ExecContext(context.Background(), query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	if len(batches) != 1 || !reflect.DeepEqual(rowids(batches[0]), []int64{7, 9}) {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+
+	// So do the rows of ExecBatch when one of them fails.
+	batches = nil
+	for _, query := range []string{"begin", "insert into foo values (12, 'l')"} {
+		if _, err := conn.ExecContext(context.Background(), query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	// The first chunk of rows succeeds, and only the savepoint of
+	// ExecBatch undoes it.
+	var rows [][]driver.Value
+	for i := 0; i < batchChunkRows; i++ {
+		rows = append(rows, []driver.Value{100 + i, fmt.Sprint("row", i)})
+	}
+	rows = append(rows, []driver.Value{nil, "l"})
+	err = conn.Raw(func(dc any) error {
+		_, err := dc.(*SQLiteConn).ExecBatch(context.Background(), "insert into foo values (?, ?)", rows)
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected unique constraint violation")
+	}
+	if _, err := conn.ExecContext(context.Background(), "commit"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(batches) != 1 || !reflect.DeepEqual(rowids(batches[0]), []int64{12}) {
+		t.Fatalf("expected one batch of row 12, got %d batches", len(batches))
+	}
+
+	// A closed feed no longer delivers anything.
+	batches = nil
+	feed.Close()
+	mustExec("insert into foo values (11, 'k')")
+	if len(batches) != 0 {
+		t.Fatalf("closed feed delivered %v", batches)
+	}
+}
+
+func TestChangeFeedNilCallback(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.(*SQLiteConn).NewChangeFeed(nil); err == nil {
+		t.Error("expected an error for a nil callback")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ColumnDecoder converts a value read from a column into the value returned
+// by SQLiteRows.Next. value is an int64, float64, string or []byte,
+// depending on the storage class of the value; NULL is never passed to a
+// decoder and is always returned as nil.
+type ColumnDecoder func(value any) (any, error)
+
+// columnType is a registered declared column type.
+type columnType struct {
+	decode   func(c *SQLiteConn, value any) (any, error)
+	scanType reflect.Type
+}
+
+// defaultColumnTypes implement the built-in handling of time and boolean
+// columns. They can be overridden per connection with RegisterColumnType.
+var defaultColumnTypes = map[string]*columnType{
+	columnDate:      {decodeTime, reflect.TypeOf(sql.NullTime{})},
+	columnDatetime:  {decodeTime, reflect.TypeOf(sql.NullTime{})},
+	columnTimestamp: {decodeTime, reflect.TypeOf(sql.NullTime{})},
+	"boolean":       {decodeBool, reflect.TypeOf(sql.NullBool{})},
+}
+
+// RegisterColumnType makes columns declared with type decltype decode through
+// decoder, and ColumnTypeScanType report scanType for them. Declared types
+// are matched case-insensitively, first in full and then by the name before
+// any parenthesized arguments, so registering "decimal" also covers
+// DECIMAL(10,2).
+//
+// A registration replaces the built-in handling of DATE, DATETIME, TIMESTAMP
+// and BOOLEAN columns for the same name. Passing a nil decoder removes the
+// registration and restores the built-in handling, if any.
+//
+// RegisterColumnType is typically called from SQLiteDriver.ConnectHook; it
+// must not be called while the connection is in use.
+func (c *SQLiteConn) RegisterColumnType(decltype string, decoder ColumnDecoder, scanType reflect.Type) {
+	decltype = strings.ToLower(strings.TrimSpace(decltype))
+	if decoder == nil {
+		delete(c.columnTypes, decltype)
+		return
+	}
+	if c.columnTypes == nil {
+		c.columnTypes = make(map[string]*columnType)
+	}
+	c.columnTypes[decltype] = &columnType{
+		decode: func(_ *SQLiteConn, value any) (any, error) {
+			return decoder(value)
+		},
+		scanType: scanType,
+	}
+}
+
+// lookupColumnType returns the registration for a lower-cased declared
+// type, or nil.
+func (c *SQLiteConn) lookupColumnType(decltype string) *columnType {
+	if decltype == "" {
+		return nil
+	}
+	if ct := c.lookupColumnTypeName(decltype); ct != nil {
+		return ct
+	}
+	if i := strings.IndexByte(decltype, '('); i > 0 {
+		return c.lookupColumnTypeName(strings.TrimSpace(decltype[:i]))
+	}
+	return nil
+}
+
+func (c *SQLiteConn) lookupColumnTypeName(name string) *columnType {
+	if ct, ok := c.columnTypes[name]; ok {
+		return ct
+	}
+	return defaultColumnTypes[name]
+}
+
+// columnTypesFor resolves the registrations for a list of lower-cased
+// declared types. It returns nil if none of the columns has one.
+func (c *SQLiteConn) columnTypesFor(decltype []string) []*columnType {
+	var cts []*columnType
+	for i, dt := range decltype {
+		ct := c.lookupColumnType(dt)
+		if ct == nil {
+			continue
+		}
+		if cts == nil {
+			cts = make([]*columnType, len(decltype))
+		}
+		cts[i] = ct
+	}
+	return cts
+}
+
+func decodeTime(c *SQLiteConn, value any) (any, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case int64:
+		t = c.timeEpoch.decode(v)
+	case float64:
+		if c.timeFormat != timeFormatJulian {
+			return value, nil
+		}
+		t = julianToTime(v)
+	case string:
+		return decodeTimeText(c, v)
+	default:
+		return value, nil
+	}
+	if c.loc != nil {
+		t = t.In(c.loc)
+	}
+	return t, nil
+}
+
+func decodeTimeText(c *SQLiteConn, s string) (any, error) {
+	formats := c.timeParse
+	if formats == nil {
+		formats = SQLiteTimestampFormats
+	}
+	// The column is a time value, so parseTime returns the zero time on
+	// parse failure.
+	t := parseTime(s, formats)
+	if c.loc != nil {
+		t = t.In(c.loc)
+	}
+	return t, nil
+}
+
+func decodeBool(c *SQLiteConn, value any) (any, error) {
+	if v, ok := value.(int64); ok {
+		return v > 0, nil
+	}
+	return value, nil
+}
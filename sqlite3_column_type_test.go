@@ -0,0 +1,138 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testDecimal struct {
+	units int64 // hundredths
+}
+
+func TestRegisterColumnType(t *testing.T) {
+	sql.Register("sqlite3_RegisterColumnType", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			conn.RegisterColumnType("JSON", func(value any) (any, error) {
+				s, ok := value.(string)
+				if !ok {
+					return nil, errors.New("json column is not text")
+				}
+				var v map[string]any
+				err := json.Unmarshal([]byte(s), &v)
+				return v, err
+			}, reflect.TypeOf(map[string]any(nil)))
+			conn.RegisterColumnType("decimal", func(value any) (any, error) {
+				switch v := value.(type) {
+				case int64:
+					return testDecimal{v * 100}, nil
+				case float64:
+					return testDecimal{int64(v*100 + 0.5)}, nil
+				case string:
+					f, err := strconv.ParseFloat(v, 64)
+					return testDecimal{int64(f*100 + 0.5)}, err
+				}
+				return value, nil
+			}, reflect.TypeOf(testDecimal{}))
+			// Override the built-in boolean handling.
+			conn.RegisterColumnType("boolean", func(value any) (any, error) {
+				return value == int64(1), nil
+			}, nil)
+			return nil
+		},
+	})
+	db, err := sql.Open("sqlite3_RegisterColumnType", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		create table foo (doc json, price decimal(10, 2), flag boolean, ts datetime, n integer);
+		insert into foo values ('{"a": 1}', 12.5, 2, '2024-02-29 10:00:00', 7);
+		insert into foo values (null, null, null, null, null);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select * from foo order by rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTypes := []reflect.Type{
+		reflect.TypeOf(map[string]any(nil)),
+		reflect.TypeOf(testDecimal{}),
+		reflect.TypeOf(sql.NullBool{}),
+		reflect.TypeOf(sql.NullTime{}),
+		reflect.TypeOf(sql.NullInt64{}),
+	}
+	for i, ct := range types {
+		if got := ct.ScanType(); got != expectedTypes[i] {
+			t.Errorf("column %s: expected scan type %v, got %v", ct.Name(), expectedTypes[i], got)
+		}
+	}
+
+	var doc, price, flag, ts, n any
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	if err := rows.Scan(&doc, &price, &flag, &ts, &n); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc, map[string]any{"a": float64(1)}) {
+		t.Errorf("unexpected json value %#v", doc)
+	}
+	if price != (testDecimal{1250}) {
+		t.Errorf("unexpected decimal value %#v", price)
+	}
+	if flag != false {
+		t.Errorf("expected overridden boolean decoder to return false, got %#v", flag)
+	}
+	if expected := time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC); ts != expected {
+		t.Errorf("expected %v, got %#v", expected, ts)
+	}
+	if n != int64(7) {
+		t.Errorf("unexpected integer value %#v", n)
+	}
+
+	// NULL is not passed to the decoders.
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	if err := rows.Scan(&doc, &price, &flag, &ts, &n); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []any{doc, price, flag, ts, n} {
+		if v != nil {
+			t.Errorf("column %d: expected nil, got %#v", i, v)
+		}
+	}
+	rows.Close()
+
+	// Decoder errors are returned from Next.
+	if _, err := db.Exec("insert into foo (doc) values (x'00')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("select doc from foo where typeof(doc) = 'blob'").Scan(&doc); err == nil {
+		t.Error("expected decoder error")
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+
+int commitHookTrampoline(void*);
+void rollbackHookTrampoline(void*);
+void updateHookTrampoline(void*, int, char*, char*, sqlite3_int64);
+*/
+import "C"
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// hookEntry is a single subscriber added through one of the Add*Hook methods.
+type hookEntry[F any] struct {
+	id uint64
+	fn F
+}
+
+// hookList is the ordered set of Go callbacks behind one SQLite hook. SQLite
+// only keeps a single callback per hook and connection, so one dispatcher is
+// registered with SQLite and fans out to every callback in the list.
+//
+// The callback set through the matching Register*Hook method occupies the
+// primary slot and always runs first; callbacks added through the Add*Hook
+// methods follow in the order they were added. The fns slice is rebuilt on
+// every change and published atomically, so dispatchers read it without
+// taking connHooks.mu: they run while SQLite holds the database mutex, which
+// the Add*Hook methods take under connHooks.mu to install the dispatcher.
+// Callbacks may add or remove hooks.
+type hookList[F any] struct {
+	primary *F
+	entries []hookEntry[F]
+	fns     atomic.Pointer[[]F]
+	handle  unsafe.Pointer
+}
+
+func (l *hookList[F]) rebuild() {
+	fns := make([]F, 0, len(l.entries)+1)
+	if l.primary != nil {
+		fns = append(fns, *l.primary)
+	}
+	for _, e := range l.entries {
+		fns = append(fns, e.fn)
+	}
+	l.fns.Store(&fns)
+}
+
+// load returns the callbacks to dispatch to.
+func (l *hookList[F]) load() []F {
+	if fns := l.fns.Load(); fns != nil {
+		return *fns
+	}
+	return nil
+}
+
+func (l *hookList[F]) setPrimary(fn *F) {
+	l.primary = fn
+	l.rebuild()
+}
+
+func (l *hookList[F]) add(id uint64, fn F) {
+	l.entries = append(l.entries, hookEntry[F]{id: id, fn: fn})
+	l.rebuild()
+}
+
+func (l *hookList[F]) remove(id uint64) {
+	for i, e := range l.entries {
+		if e.id == id {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+			l.rebuild()
+			return
+		}
+	}
+}
+
+// install registers (or, when the list is empty, unregisters) the dispatcher
+// with SQLite through set. The handle for dispatch is created once and reused
+// for the lifetime of the connection.
+func (l *hookList[F]) install(c *SQLiteConn, dispatch any, set func(handle unsafe.Pointer)) {
+	if c.db == nil {
+		return
+	}
+	if len(l.load()) == 0 {
+		set(nil)
+		return
+	}
+	if l.handle == nil {
+		l.handle = newHandle(c, dispatch)
+	}
+	set(l.handle)
+}
+
+// connHooks holds the commit, rollback, update and pre-update callbacks of a
+// connection.
+type connHooks struct {
+	mu        sync.Mutex
+	nextID    uint64
+	commit    hookList[func() int]
+	rollback  hookList[func()]
+	update    hookList[func(int, string, string, int64)]
+	preUpdate hookList[func(SQLitePreUpdateData)]
+
+	// step hooks are not registered with SQLite; they run in Go after a
+	// statement has been stepped to completion (or failed) and are used to
+	// observe transaction boundaries that SQLite has no hook for. nstep
+	// mirrors len(step.fns) so the hot paths can skip them without locking.
+	step  hookList[func(stmt *C.sqlite3_stmt, ok bool)]
+	nstep atomic.Int32
+}
+
+func (h *connHooks) newID() uint64 {
+	h.nextID++
+	return h.nextID
+}
+
+func (h *connHooks) watchingSteps() bool {
+	return h.nstep.Load() != 0
+}
+
+// afterStep runs the step hooks. stmt is the statement that finished, not
+// yet reset, or nil when a statement was reset before it finished, and ok
+// reports whether the statement succeeded.
+func (h *connHooks) afterStep(stmt *C.sqlite3_stmt, ok bool) {
+	for _, fn := range h.step.load() {
+		fn(stmt, ok)
+	}
+}
+
+// removeFunc wraps remove so that calling it more than once is harmless.
+func removeFunc(remove func()) func() {
+	var once sync.Once
+	return func() { once.Do(remove) }
+}
+
+func (c *SQLiteConn) installCommitHookLocked() {
+	c.hooks.commit.install(c, c.dispatchCommitHook, func(handle unsafe.Pointer) {
+		if handle == nil {
+			C.sqlite3_commit_hook(c.db, nil, nil)
+		} else {
+			C.sqlite3_commit_hook(c.db, (*[0]byte)(C.commitHookTrampoline), handle)
+		}
+	})
+}
+
+func (c *SQLiteConn) installRollbackHookLocked() {
+	c.hooks.rollback.install(c, c.dispatchRollbackHook, func(handle unsafe.Pointer) {
+		if handle == nil {
+			C.sqlite3_rollback_hook(c.db, nil, nil)
+		} else {
+			C.sqlite3_rollback_hook(c.db, (*[0]byte)(C.rollbackHookTrampoline), handle)
+		}
+	})
+}
+
+func (c *SQLiteConn) installUpdateHookLocked() {
+	c.hooks.update.install(c, c.dispatchUpdateHook, func(handle unsafe.Pointer) {
+		if handle == nil {
+			C.sqlite3_update_hook(c.db, nil, nil)
+		} else {
+			C.sqlite3_update_hook(c.db, (*[0]byte)(C.updateHookTrampoline), handle)
+		}
+	})
+}
+
+func (c *SQLiteConn) installPreUpdateHookLocked() {
+	c.hooks.preUpdate.install(c, c.dispatchPreUpdateHook, c.setPreUpdateHook)
+}
+
+func (c *SQLiteConn) dispatchCommitHook() int {
+	for _, fn := range c.hooks.commit.load() {
+		if rv := fn(); rv != 0 {
+			return rv
+		}
+	}
+	return 0
+}
+
+func (c *SQLiteConn) dispatchRollbackHook() {
+	for _, fn := range c.hooks.rollback.load() {
+		fn()
+	}
+}
+
+func (c *SQLiteConn) dispatchUpdateHook(op int, db string, table string, rowid int64) {
+	for _, fn := range c.hooks.update.load() {
+		fn(op, db, table, rowid)
+	}
+}
+
+func (c *SQLiteConn) dispatchPreUpdateHook(data SQLitePreUpdateData) {
+	for _, fn := range c.hooks.preUpdate.load() {
+		fn(data)
+	}
+}
+
+// AddCommitHook adds a commit hook to the connection without replacing the
+// hook set by RegisterCommitHook or any other hook added by AddCommitHook.
+//
+// Hooks run in a deterministic order: the hook set by RegisterCommitHook
+// first, followed by added hooks in the order they were added. As soon as
+// a hook returns non-zero the remaining hooks are skipped and the
+// transaction becomes a rollback.
+//
+// The returned function removes the hook; it is safe to call more than once.
+func (c *SQLiteConn) AddCommitHook(callback func() int) (remove func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	id := c.hooks.newID()
+	c.hooks.commit.add(id, callback)
+	c.installCommitHookLocked()
+	return removeFunc(func() {
+		c.hooks.mu.Lock()
+		defer c.hooks.mu.Unlock()
+		c.hooks.commit.remove(id)
+		c.installCommitHookLocked()
+	})
+}
+
+// AddRollbackHook adds a rollback hook to the connection without replacing
+// the hook set by RegisterRollbackHook or any other hook added by
+// AddRollbackHook. Hooks are called in the same order as commit hooks.
+//
+// The returned function removes the hook; it is safe to call more than once.
+func (c *SQLiteConn) AddRollbackHook(callback func()) (remove func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	id := c.hooks.newID()
+	c.hooks.rollback.add(id, callback)
+	c.installRollbackHookLocked()
+	return removeFunc(func() {
+		c.hooks.mu.Lock()
+		defer c.hooks.mu.Unlock()
+		c.hooks.rollback.remove(id)
+		c.installRollbackHookLocked()
+	})
+}
+
+// AddUpdateHook adds an update hook to the connection without replacing the
+// hook set by RegisterUpdateHook or any other hook added by AddUpdateHook.
+// Hooks are called in the same order as commit hooks.
+//
+// The returned function removes the hook; it is safe to call more than once.
+func (c *SQLiteConn) AddUpdateHook(callback func(int, string, string, int64)) (remove func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	id := c.hooks.newID()
+	c.hooks.update.add(id, callback)
+	c.installUpdateHookLocked()
+	return removeFunc(func() {
+		c.hooks.mu.Lock()
+		defer c.hooks.mu.Unlock()
+		c.hooks.update.remove(id)
+		c.installUpdateHookLocked()
+	})
+}
+
+func (c *SQLiteConn) addPreUpdateHook(callback func(SQLitePreUpdateData)) (remove func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	id := c.hooks.newID()
+	c.hooks.preUpdate.add(id, callback)
+	c.installPreUpdateHookLocked()
+	return removeFunc(func() {
+		c.hooks.mu.Lock()
+		defer c.hooks.mu.Unlock()
+		c.hooks.preUpdate.remove(id)
+		c.installPreUpdateHookLocked()
+	})
+}
+
+func (c *SQLiteConn) addStepHook(callback func(stmt *C.sqlite3_stmt, ok bool)) (remove func()) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	id := c.hooks.newID()
+	c.hooks.step.add(id, callback)
+	c.hooks.nstep.Store(int32(len(c.hooks.step.load())))
+	return removeFunc(func() {
+		c.hooks.mu.Lock()
+		defer c.hooks.mu.Unlock()
+		c.hooks.step.remove(id)
+		c.hooks.nstep.Store(int32(len(c.hooks.step.load())))
+	})
+}
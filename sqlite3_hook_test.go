@@ -0,0 +1,177 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddHooks(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+
+	var events []string
+	commitReturn := 0
+	c.RegisterCommitHook(func() int {
+		events = append(events, "commit(registered)")
+		return 0
+	})
+	removeCommitA := c.AddCommitHook(func() int {
+		events = append(events, "commit(a)")
+		return commitReturn
+	})
+	c.AddCommitHook(func() int {
+		events = append(events, "commit(b)")
+		return 0
+	})
+	c.AddRollbackHook(func() {
+		events = append(events, "rollback(a)")
+	})
+	removeUpdateA := c.AddUpdateHook(func(op int, db string, table string, rowid int64) {
+		events = append(events, fmt.Sprintf("update(a) rowid=%d", rowid))
+	})
+	c.AddUpdateHook(func(op int, db string, table string, rowid int64) {
+		events = append(events, fmt.Sprintf("update(b) rowid=%d", rowid))
+	})
+
+	mustExec := func(query string) {
+		t.Helper()
+		if _, err := c.Exec(query, nil); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+
+	mustExec("create table foo (id integer primary key)")
+	events = nil
+	mustExec("insert into foo values (1)")
+	expected := []string{
+		"update(a) rowid=1",
+		"update(b) rowid=1",
+		"commit(registered)",
+		"commit(a)",
+		"commit(b)",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	// A veto from any subscriber turns the commit into a rollback and skips
+	// the remaining commit hooks.
+	events = nil
+	commitReturn = 1
+	if _, err := c.Exec("insert into foo values (2)", nil); err == nil {
+		t.Fatal("expected commit hook to roll back the transaction")
+	}
+	expected = []string{
+		"update(a) rowid=2",
+		"update(b) rowid=2",
+		"commit(registered)",
+		"commit(a)",
+		"rollback(a)",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	// Removed hooks no longer fire; removing twice is harmless and replacing
+	// the registered hook does not touch the added ones.
+	removeCommitA()
+	removeCommitA()
+	removeUpdateA()
+	c.RegisterCommitHook(nil)
+	events = nil
+	mustExec("insert into foo values (3)")
+	expected = []string{
+		"update(b) rowid=3",
+		"commit(b)",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
+
+func TestAddHooksRemoveDuringCallback(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+
+	if _, err := c.Exec("create table foo (id integer primary key)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	var remove func()
+	remove = c.AddUpdateHook(func(int, string, string, int64) {
+		calls++
+		remove()
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := c.Exec("insert into foo values (null)", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected hook to run once, ran %d times", calls)
+	}
+}
+
+func TestAddHookDuringStep(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+
+	if _, err := c.Exec("create table foo (id integer primary key)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the statement holds the database mutex, another goroutine adds
+	// a hook, which waits for that mutex. The update hooks of the following
+	// rows must still run.
+	added := make(chan func())
+	calls := 0
+	c.AddUpdateHook(func(int, string, string, int64) {
+		if calls++; calls == 1 {
+			go func() { added <- c.AddRollbackHook(func() {}) }()
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	done := make(chan error)
+	go func() {
+		_, err := c.Exec("insert into foo values (1), (2), (3)", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("deadlock adding a hook during a step")
+	}
+	(<-added)()
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
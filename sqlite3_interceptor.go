@@ -0,0 +1,197 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Interceptor observes and can alter the statements and transactions of the
+// connections opened by a SQLiteDriver. Register interceptors through
+// SQLiteDriver.Interceptors.
+//
+// The Before methods are called in registration order, each receiving the
+// context and query returned by the previous one, so an interceptor can
+// attach values such as tracing spans to the context or rewrite the query.
+// If a Before method returns an error the operation is not performed and the
+// error is returned to the caller. The After methods are called in reverse
+// order for every interceptor whose Before method ran, with the context that
+// interceptor returned.
+//
+// Embed NopInterceptor to implement only some of the methods.
+type Interceptor interface {
+	// BeforePrepare is called before a statement is prepared.
+	BeforePrepare(ctx context.Context, query string) (string, error)
+
+	// BeforeExec and AfterExec surround the execution of a statement that
+	// does not return rows. The query of a prepared statement cannot be
+	// rewritten; returning a different query is an error.
+	BeforeExec(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error)
+	AfterExec(ctx context.Context, event InterceptorEvent)
+
+	// BeforeQuery and AfterQuery surround the execution of a query.
+	// AfterQuery is called once the rows are available, before they are
+	// read. The query of a prepared statement cannot be rewritten.
+	BeforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error)
+	AfterQuery(ctx context.Context, event InterceptorEvent)
+
+	// BeforeBegin is called before a transaction is started. The context
+	// it returns is passed to AfterCommit or AfterRollback when the
+	// transaction ends.
+	BeforeBegin(ctx context.Context, opts driver.TxOptions) (context.Context, error)
+	AfterCommit(ctx context.Context, event InterceptorEvent)
+	AfterRollback(ctx context.Context, event InterceptorEvent)
+}
+
+// InterceptorEvent describes an operation passed to the After methods of an
+// Interceptor.
+type InterceptorEvent struct {
+	// Query and Args are the statement and arguments that were executed,
+	// after any rewriting. They are empty for commits and rollbacks.
+	Query string
+	Args  []driver.NamedValue
+	// Duration is the time spent in SQLite.
+	Duration time.Duration
+	// RowsAffected and LastInsertID are only set by AfterExec.
+	RowsAffected int64
+	LastInsertID int64
+	// Err is the error returned to the caller, if any.
+	Err error
+}
+
+// NopInterceptor implements Interceptor without doing anything. Embed it in
+// an interceptor that only needs some of the methods.
+type NopInterceptor struct{}
+
+// BeforePrepare implements Interceptor.
+func (NopInterceptor) BeforePrepare(ctx context.Context, query string) (string, error) {
+	return query, nil
+}
+
+// BeforeExec implements Interceptor.
+func (NopInterceptor) BeforeExec(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	return ctx, query, nil
+}
+
+// AfterExec implements Interceptor.
+func (NopInterceptor) AfterExec(ctx context.Context, event InterceptorEvent) {}
+
+// BeforeQuery implements Interceptor.
+func (NopInterceptor) BeforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	return ctx, query, nil
+}
+
+// AfterQuery implements Interceptor.
+func (NopInterceptor) AfterQuery(ctx context.Context, event InterceptorEvent) {}
+
+// BeforeBegin implements Interceptor.
+func (NopInterceptor) BeforeBegin(ctx context.Context, opts driver.TxOptions) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterCommit implements Interceptor.
+func (NopInterceptor) AfterCommit(ctx context.Context, event InterceptorEvent) {}
+
+// AfterRollback implements Interceptor.
+func (NopInterceptor) AfterRollback(ctx context.Context, event InterceptorEvent) {}
+
+// execEvent builds the InterceptorEvent of a finished exec.
+func execEvent(query string, args []driver.NamedValue, d time.Duration, res driver.Result, err error) InterceptorEvent {
+	event := InterceptorEvent{Query: query, Args: args, Duration: d, Err: err}
+	if res != nil {
+		event.RowsAffected, _ = res.RowsAffected()
+		event.LastInsertID, _ = res.LastInsertId()
+	}
+	return event
+}
+
+// interceptorChain runs the Before and After methods of a list of
+// interceptors for one operation.
+type interceptorChain struct {
+	interceptors []Interceptor
+	ctxs         []context.Context
+}
+
+func newInterceptorChain(interceptors []Interceptor) *interceptorChain {
+	return &interceptorChain{
+		interceptors: interceptors,
+		ctxs:         make([]context.Context, 0, len(interceptors)),
+	}
+}
+
+// before calls fn for each interceptor in order, stopping at the first error.
+func (ch *interceptorChain) before(ctx context.Context, fn func(ic Interceptor, ctx context.Context) (context.Context, error)) (context.Context, error) {
+	for _, ic := range ch.interceptors {
+		next, err := fn(ic, ctx)
+		if next != nil {
+			ctx = next
+		}
+		ch.ctxs = append(ch.ctxs, ctx)
+		if err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+// after calls fn in reverse order for each interceptor whose Before method
+// ran.
+func (ch *interceptorChain) after(fn func(ic Interceptor, ctx context.Context)) {
+	for i := len(ch.ctxs) - 1; i >= 0; i-- {
+		fn(ch.interceptors[i], ch.ctxs[i])
+	}
+}
+
+func (ch *interceptorChain) beforeExec(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	ctx, err := ch.before(ctx, func(ic Interceptor, ctx context.Context) (context.Context, error) {
+		var err error
+		ctx, query, err = ic.BeforeExec(ctx, query, args)
+		return ctx, err
+	})
+	return ctx, query, err
+}
+
+func (ch *interceptorChain) afterExec(event InterceptorEvent) {
+	ch.after(func(ic Interceptor, ctx context.Context) { ic.AfterExec(ctx, event) })
+}
+
+func (ch *interceptorChain) beforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	ctx, err := ch.before(ctx, func(ic Interceptor, ctx context.Context) (context.Context, error) {
+		var err error
+		ctx, query, err = ic.BeforeQuery(ctx, query, args)
+		return ctx, err
+	})
+	return ctx, query, err
+}
+
+func (ch *interceptorChain) afterQuery(event InterceptorEvent) {
+	ch.after(func(ic Interceptor, ctx context.Context) { ic.AfterQuery(ctx, event) })
+}
+
+func (ch *interceptorChain) beforePrepare(ctx context.Context, query string) (string, error) {
+	_, err := ch.before(ctx, func(ic Interceptor, ctx context.Context) (context.Context, error) {
+		var err error
+		query, err = ic.BeforePrepare(ctx, query)
+		return ctx, err
+	})
+	return query, err
+}
+
+func (ch *interceptorChain) beforeBegin(ctx context.Context, opts driver.TxOptions) (context.Context, error) {
+	return ch.before(ctx, func(ic Interceptor, ctx context.Context) (context.Context, error) {
+		return ic.BeforeBegin(ctx, opts)
+	})
+}
+
+func (ch *interceptorChain) afterCommit(event InterceptorEvent) {
+	ch.after(func(ic Interceptor, ctx context.Context) { ic.AfterCommit(ctx, event) })
+}
+
+func (ch *interceptorChain) afterRollback(event InterceptorEvent) {
+	ch.after(func(ic Interceptor, ctx context.Context) { ic.AfterRollback(ctx, event) })
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+type recordingInterceptor struct {
+	NopInterceptor
+	name   string
+	events *[]string
+}
+
+func (r recordingInterceptor) BeforePrepare(ctx context.Context, query string) (string, error) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:prepare %s", r.name, query))
+	return query, nil
+}
+
+func (r recordingInterceptor) BeforeExec(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:before-exec %s", r.name, query))
+	if strings.Contains(query, "forbidden") {
+		return ctx, query, errors.New("forbidden")
+	}
+	return context.WithValue(ctx, ctxKey{}, r.name), query, nil
+}
+
+func (r recordingInterceptor) AfterExec(ctx context.Context, event InterceptorEvent) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:after-exec ctx=%v rows=%d err=%v", r.name, ctx.Value(ctxKey{}), event.RowsAffected, event.Err))
+}
+
+func (r recordingInterceptor) BeforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:before-query %s", r.name, query))
+	return ctx, strings.Replace(query, "$TABLE", "foo", 1), nil
+}
+
+func (r recordingInterceptor) AfterQuery(ctx context.Context, event InterceptorEvent) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:after-query %s err=%v", r.name, event.Query, event.Err))
+}
+
+func (r recordingInterceptor) BeforeBegin(ctx context.Context, opts driver.TxOptions) (context.Context, error) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:begin", r.name))
+	return context.WithValue(ctx, ctxKey{}, r.name+"-tx"), nil
+}
+
+func (r recordingInterceptor) AfterCommit(ctx context.Context, event InterceptorEvent) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:commit ctx=%v err=%v", r.name, ctx.Value(ctxKey{}), event.Err))
+}
+
+func (r recordingInterceptor) AfterRollback(ctx context.Context, event InterceptorEvent) {
+	*r.events = append(*r.events, fmt.Sprintf("%s:rollback ctx=%v err=%v", r.name, ctx.Value(ctxKey{}), event.Err))
+}
+
+func TestInterceptors(t *testing.T) {
+	var events []string
+	sql.Register("sqlite3_Interceptors", &SQLiteDriver{
+		Interceptors: []Interceptor{
+			recordingInterceptor{name: "a", events: &events},
+			recordingInterceptor{name: "b", events: &events},
+		},
+	})
+	db, err := sql.Open("sqlite3_Interceptors", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("create table foo (id integer primary key)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("insert into foo values (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"a:before-exec create table foo (id integer primary key)",
+		"b:before-exec create table foo (id integer primary key)",
+		"b:after-exec ctx=b rows=0 err=<nil>",
+		"a:after-exec ctx=a rows=0 err=<nil>",
+		"a:before-exec insert into foo values (1), (2)",
+		"b:before-exec insert into foo values (1), (2)",
+		"b:after-exec ctx=b rows=2 err=<nil>",
+		"a:after-exec ctx=a rows=2 err=<nil>",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q, got %q", expected, events)
+	}
+
+	// Short-circuit: the statement never reaches SQLite and later
+	// interceptors are skipped.
+	events = nil
+	if _, err := db.Exec("insert into foo values (3) -- forbidden"); err == nil || err.Error() != "forbidden" {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+	expected = []string{
+		"a:before-exec insert into foo values (3) -- forbidden",
+		"a:after-exec ctx=<nil> rows=0 err=forbidden",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q, got %q", expected, events)
+	}
+
+	// Rewriting.
+	events = nil
+	var n int
+	if err := db.QueryRow("select count(*) from $TABLE").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+	expected = []string{
+		"a:before-query select count(*) from $TABLE",
+		"b:before-query select count(*) from foo",
+		"b:after-query select count(*) from foo err=<nil>",
+		"a:after-query select count(*) from foo err=<nil>",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q, got %q", expected, events)
+	}
+
+	// Prepared statements cannot be rewritten.
+	stmt, err := db.Prepare("select id from foo where id > ? -- $TABLE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Query(0); err != errInterceptorRewrite {
+		t.Errorf("expected %v, got %v", errInterceptorRewrite, err)
+	}
+	stmt.Close()
+
+	// Transactions.
+	events = nil
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"a:begin",
+		"b:begin",
+		"b:commit ctx=b-tx err=<nil>",
+		"a:commit ctx=a-tx err=<nil>",
+		"a:begin",
+		"b:begin",
+		"b:rollback ctx=b-tx err=<nil>",
+		"a:rollback ctx=a-tx err=<nil>",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q, got %q", expected, events)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_cksumvfs && cgo
+// +build sqlite_cksumvfs,cgo
+
+package sqlite3
+
+/*
+#cgo CFLAGS: -DSQLITE_CKSUMVFS_STATIC
+
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+#include <stdlib.h>
+
+int sqlite3_register_cksumvfs(const char*);
+
+// cksumvfs.c makes cksmvfs the default VFS; only connections that ask for
+// it by name use it here.
+static int _sqlite3_register_cksumvfs(void) {
+	sqlite3_vfs *pDefault = sqlite3_vfs_find(0);
+	int rc = sqlite3_register_cksumvfs(0);
+	if (rc == SQLITE_OK && pDefault != 0) {
+		rc = sqlite3_vfs_register(pDefault, 1);
+	}
+	return rc;
+}
+
+static int _sqlite3_cksum_read(sqlite3_file *pFile, void *buf, int n, sqlite3_int64 off) {
+	return pFile->pMethods->xRead(pFile, buf, n, off);
+}
+
+static int _sqlite3_cksum_size(sqlite3_file *pFile, sqlite3_int64 *pSize) {
+	return pFile->pMethods->xFileSize(pFile, pSize);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+var (
+	cksumVFSOnce sync.Once
+	cksumVFSErr  error
+)
+
+// registerCksumVFS registers the cksmvfs VFS of sqlite3_opt_cksumvfs.c the
+// first time a connection uses it, leaving the default VFS unchanged.
+func registerCksumVFS() error {
+	cksumVFSOnce.Do(func() {
+		if rv := C._sqlite3_register_cksumvfs(); rv != C.SQLITE_OK {
+			cksumVFSErr = fmt.Errorf("sqlite3: cannot register the %s VFS: %w", CksumVFSName, Error{Code: ErrNo(rv)})
+		}
+	})
+	return cksumVFSErr
+}
+
+// VerifyChecksums reads every page of the main database file of the
+// connection, which must use the checksum VFS, and returns a
+// *ChecksumError with the numbers of the pages whose checksums are wrong.
+// It reads the file within the transaction of the connection, or a read
+// transaction of its own. The frames of a WAL, which are not checkpointed
+// yet, are verified when SQLite reads them.
+func (c *SQLiteConn) VerifyChecksums(ctx context.Context) error {
+	if err := registerCksumVFS(); err != nil {
+		return err
+	}
+	if c.AutoCommit() {
+		if _, err := c.exec(ctx, "BEGIN", nil); err != nil {
+			return err
+		}
+		defer c.exec(context.Background(), "ROLLBACK", nil)
+	}
+	// Only the checksum VFS answers the pragma.
+	verify, err := c.queryString(ctx, "PRAGMA checksum_verification")
+	if err != nil {
+		return err
+	}
+	if verify == "" {
+		return fmt.Errorf("sqlite3: database does not use the %s VFS", CksumVFSName)
+	}
+	// Start the read transaction, which locks the file.
+	if _, err := c.queryString(ctx, "SELECT count(*) FROM sqlite_master"); err != nil {
+		return err
+	}
+
+	zName := C.CString("main")
+	defer C.free(unsafe.Pointer(zName))
+	var pFile *C.sqlite3_file
+	rv := C.sqlite3_file_control(c.db, zName, C.SQLITE_FCNTL_FILE_POINTER, unsafe.Pointer(&pFile))
+	if rv != C.SQLITE_OK {
+		return c.lastError()
+	}
+	var header [100]byte
+	rv = C._sqlite3_cksum_read(pFile, unsafe.Pointer(&header[0]), C.int(len(header)), 0)
+	if rv != C.SQLITE_OK {
+		return Error{Code: ErrNo(rv & ErrNoMask), ExtendedCode: ErrNoExtended(rv)}
+	}
+	if header[20] != CksumVFSReserveBytes {
+		return errors.New("sqlite3: database has no checksums")
+	}
+	// The checksum VFS verifies each page it reads, unless the pragma
+	// turned that off.
+	if verify == "0" {
+		if _, err := c.exec(ctx, "PRAGMA checksum_verification = ON", nil); err != nil {
+			return err
+		}
+		defer c.exec(context.Background(), "PRAGMA checksum_verification = OFF", nil)
+	}
+
+	pageSize := int64(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	var size C.sqlite3_int64
+	if rv := C._sqlite3_cksum_size(pFile, &size); rv != C.SQLITE_OK {
+		return Error{Code: ErrNo(rv & ErrNoMask), ExtendedCode: ErrNoExtended(rv)}
+	}
+	var bad []int64
+	page := make([]byte, pageSize)
+	for pgno := int64(1); pgno*pageSize <= int64(size); pgno++ {
+		if pgno%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		rv := C._sqlite3_cksum_read(pFile, unsafe.Pointer(&page[0]), C.int(pageSize), C.sqlite3_int64((pgno-1)*pageSize))
+		switch rv {
+		case C.SQLITE_OK:
+		case C.SQLITE_IOERR_DATA:
+			bad = append(bad, pgno)
+		default:
+			return Error{Code: ErrNo(rv & ErrNoMask), ExtendedCode: ErrNoExtended(rv)}
+		}
+	}
+	if bad != nil {
+		return &ChecksumError{Pages: bad}
+	}
+	return nil
+}
+
+// queryString returns the first column of the first row of query, or ""
+// if there is no row.
+func (c *SQLiteConn) queryString(ctx context.Context, query string) (string, error) {
+	rows, err := c.query(ctx, query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", err
+	}
+	if b, ok := dest[0].([]byte); ok {
+		return string(b), nil
+	}
+	return fmt.Sprint(dest[0]), nil
+}
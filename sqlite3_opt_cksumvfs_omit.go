@@ -0,0 +1,25 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !sqlite_cksumvfs && cgo
+// +build !sqlite_cksumvfs,cgo
+
+package sqlite3
+
+import (
+	"context"
+	"errors"
+)
+
+// registerCksumVFS leaves the cksmvfs VFS to an extension, if any, without
+// the sqlite_cksumvfs build tag.
+func registerCksumVFS() error {
+	return nil
+}
+
+// VerifyChecksums verifies the checksums of the pages of the database.
+func (c *SQLiteConn) VerifyChecksums(ctx context.Context) error {
+	return errors.New("sqlite3: VerifyChecksums requires the sqlite_cksumvfs build tag")
+}
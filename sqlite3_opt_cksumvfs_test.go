@@ -0,0 +1,151 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_cksumvfs && cgo
+// +build sqlite_cksumvfs,cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCksumVFS(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	open := func(name, params string) *sql.DB {
+		t.Helper()
+		db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, name)+"?"+params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	fill := func(db *sql.DB) {
+		t.Helper()
+		_, err := db.Exec(`CREATE TABLE t (v TEXT);
+			WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 500)
+			INSERT INTO t SELECT printf('row %d %.100c', n, 'x') FROM s`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(db *sql.DB) (int, error) {
+		var n int
+		err := db.QueryRow("SELECT count(*) FROM t WHERE v LIKE 'row %'").Scan(&n)
+		return n, err
+	}
+	verify := func(db *sql.DB) error {
+		t.Helper()
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.Raw(func(dc any) error {
+			return dc.(*SQLiteConn).VerifyChecksums(ctx)
+		})
+	}
+	pragma := func(db *sql.DB, q string) string {
+		t.Helper()
+		var v string
+		if err := db.QueryRow(q).Scan(&v); err != nil {
+			t.Fatal(q, err)
+		}
+		return v
+	}
+
+	db := open("new.db", "_cksumvfs=1")
+	fill(db)
+	if err := verify(db); err != nil {
+		t.Fatal(err)
+	}
+	if v := pragma(db, "PRAGMA checksum_verification"); v != "1" {
+		t.Errorf("expected verification to be on, got %s", v)
+	}
+	db.Close()
+	b, err := os.ReadFile(filepath.Join(dir, "new.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[20] != CksumVFSReserveBytes {
+		t.Fatalf("expected %d reserved bytes, got %d", CksumVFSReserveBytes, b[20])
+	}
+
+	// Damage the middle of the last page, and then of the one before it.
+	pageSize := int(binary.BigEndian.Uint16(b[16:]))
+	last := len(b)/pageSize - 1
+	b[last*pageSize+pageSize/2] ^= 1
+	b[(last-1)*pageSize+pageSize/2] ^= 1
+	if err := os.WriteFile(filepath.Join(dir, "damaged.db"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db = open("damaged.db", "vfs="+CksumVFSName)
+	var cerr *ChecksumError
+	if err := verify(db); !errors.As(err, &cerr) || !reflect.DeepEqual(cerr.Pages, []int64{int64(last), int64(last + 1)}) {
+		t.Errorf("expected bad pages %d and %d, got %v", last, last+1, err)
+	}
+	var serr Error
+	if _, err := count(db); !errors.As(err, &serr) || serr.ExtendedCode != ErrIoErrData {
+		t.Errorf("expected a data error, got %v", err)
+	}
+	if v := pragma(db, "PRAGMA checksum_verification = OFF"); v != "0" {
+		t.Errorf("expected verification to be off, got %s", v)
+	}
+	if _, err := count(db); errors.As(err, &serr) && serr.ExtendedCode == ErrIoErrData {
+		t.Errorf("expected no data error without verification, got %v", err)
+	}
+	if err := verify(db); !errors.As(err, &cerr) || len(cerr.Pages) != 2 {
+		t.Errorf("expected bad pages without verification, got %v", err)
+	}
+	if v := pragma(db, "PRAGMA checksum_verification"); v != "0" {
+		t.Errorf("expected verification to stay off, got %s", v)
+	}
+
+	// The pages of the WAL have checksums too, verified when another
+	// connection reads them and kept by a checkpoint.
+	fill(open("wal.db", "_cksumvfs=1&_journal_mode=WAL"))
+	db = open("wal.db", "_cksumvfs=1")
+	if n, err := count(db); err != nil || n != 500 {
+		t.Errorf("expected 500 rows from the WAL, got %d %v", n, err)
+	}
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(db); err != nil {
+		t.Error(err)
+	}
+
+	// A database without checksums gains them with VACUUM. Registering
+	// the checksum VFS left the default VFS, which does not answer the
+	// pragma, unchanged.
+	db = open("plain.db", "")
+	fill(db)
+	if err := db.QueryRow("PRAGMA checksum_verification").Scan(new(string)); err != sql.ErrNoRows {
+		t.Errorf("expected the default VFS, got %v", err)
+	}
+	db = open("plain.db", "_cksumvfs=1")
+	if err := verify(db); err == nil || errors.As(err, &cerr) {
+		t.Errorf("expected a database without checksums, got %v", err)
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(db); err != nil {
+		t.Error(err)
+	}
+	if n, err := count(db); err != nil || n != 500 {
+		t.Errorf("expected 500 rows, got %d %v", n, err)
+	}
+}
@@ -20,3 +20,29 @@ import "C"
 func (s *SQLiteStmt) ColumnTableName(n int) string {
 	return C.GoString(C.sqlite3_column_table_name(s.s, C.int(n)))
 }
+
+func (s *SQLiteStmt) columnOrigin(i int) (origin ColumnOrigin, ok bool) {
+	zDb := C.sqlite3_column_database_name(s.s, C.int(i))
+	zTable := C.sqlite3_column_table_name(s.s, C.int(i))
+	zColumn := C.sqlite3_column_origin_name(s.s, C.int(i))
+	if zDb == nil || zTable == nil || zColumn == nil {
+		return origin, false
+	}
+	origin.Database = C.GoString(zDb)
+	origin.Table = C.GoString(zTable)
+	origin.Column = C.GoString(zColumn)
+
+	var zDeclType, zCollSeq *C.char
+	var notNull, primaryKey, autoinc C.int
+	rv := C.sqlite3_table_column_metadata(s.c.db, zDb, zTable, zColumn,
+		&zDeclType, &zCollSeq, &notNull, &primaryKey, &autoinc)
+	if rv != C.SQLITE_OK {
+		return origin, false
+	}
+	origin.DeclType = C.GoString(zDeclType)
+	origin.Collation = C.GoString(zCollSeq)
+	origin.NotNull = notNull != 0
+	origin.PrimaryKey = primaryKey != 0
+	origin.AutoIncrement = autoinc != 0
+	return origin, true
+}
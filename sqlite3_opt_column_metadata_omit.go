@@ -0,0 +1,10 @@
+//go:build !sqlite_column_metadata && cgo
+// +build !sqlite_column_metadata,cgo
+
+package sqlite3
+
+// columnOrigin needs SQLITE_ENABLE_COLUMN_METADATA; without the
+// sqlite_column_metadata tag no result column has a known origin.
+func (s *SQLiteStmt) columnOrigin(i int) (origin ColumnOrigin, ok bool) {
+	return origin, false
+}
@@ -1,9 +1,18 @@
-//go:build sqlite_column_metadata
-// +build sqlite_column_metadata
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_column_metadata && cgo
+// +build sqlite_column_metadata,cgo
 
 package sqlite3
 
-import "testing"
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
 
 func TestColumnTableName(t *testing.T) {
 	d := SQLiteDriver{}
@@ -38,3 +47,74 @@ func TestColumnTableName(t *testing.T) {
 		t.Fatalf("Incorrect table name returned expected: %s, got: %s", exp, got)
 	}
 }
+
+func TestColumnOrigin(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal("failed to get database connection:", err)
+	}
+	defer conn.Close()
+	sqlite3conn := conn.(*SQLiteConn)
+
+	_, err = sqlite3conn.Exec(`CREATE TABLE foo (id integer primary key autoincrement, name text not null collate nocase)`, nil)
+	if err != nil {
+		t.Fatal("Failed to create table:", err)
+	}
+	rows, err := sqlite3conn.Query(`SELECT f.name AS n, f.id, 1 FROM foo AS f`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	rc := rows.(*SQLiteRows)
+
+	origin, ok := rc.ColumnOrigin(0)
+	expected := ColumnOrigin{
+		Database:  "main",
+		Table:     "foo",
+		Column:    "name",
+		DeclType:  "TEXT",
+		Collation: "nocase",
+		NotNull:   true,
+	}
+	if !ok || !reflect.DeepEqual(origin, expected) {
+		t.Errorf("expected %+v, got %+v (%v)", expected, origin, ok)
+	}
+	origin, ok = rc.ColumnOrigin(1)
+	if !ok || !origin.PrimaryKey || !origin.AutoIncrement || origin.NotNull {
+		t.Errorf("unexpected origin %+v (%v)", origin, ok)
+	}
+	if _, ok := rc.ColumnOrigin(2); ok {
+		t.Error("expected no origin for an expression column")
+	}
+}
+
+func TestColumnTypeNullable(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE foo (id integer primary key, name text not null, body text)`)
+	if err != nil {
+		t.Fatal("Failed to create table:", err)
+	}
+	rows, err := db.Query(`SELECT id, name, body, id + 1 FROM foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][2]bool{{false, true}, {false, true}, {true, true}, {true, true}}
+	for i, ct := range types {
+		nullable, ok := ct.Nullable()
+		if got := [2]bool{nullable, ok}; got != expected[i] {
+			t.Errorf("column %s: expected %v, got %v", ct.Name(), expected[i], got)
+		}
+	}
+}
@@ -36,12 +36,33 @@ import (
 //
 // If there is an existing preupdate hook for this connection, it will be
 // removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
+// without creating a new one. Hooks added with AddPreUpdateHook are not
+// affected.
 func (c *SQLiteConn) RegisterPreUpdateHook(callback func(SQLitePreUpdateData)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
 	if callback == nil {
+		c.hooks.preUpdate.setPrimary(nil)
+	} else {
+		c.hooks.preUpdate.setPrimary(&callback)
+	}
+	c.installPreUpdateHookLocked()
+}
+
+// AddPreUpdateHook adds a pre-update hook to the connection without
+// replacing the hook set by RegisterPreUpdateHook or any other hook added by
+// AddPreUpdateHook. Hooks are called in the same order as commit hooks.
+//
+// The returned function removes the hook; it is safe to call more than once.
+func (c *SQLiteConn) AddPreUpdateHook(callback func(SQLitePreUpdateData)) (remove func()) {
+	return c.addPreUpdateHook(callback)
+}
+
+func (c *SQLiteConn) setPreUpdateHook(handle unsafe.Pointer) {
+	if handle == nil {
 		C.sqlite3_preupdate_hook(c.db, nil, nil)
 	} else {
-		C.sqlite3_preupdate_hook(c.db, (*[0]byte)(unsafe.Pointer(C.preUpdateHookTrampoline)), unsafe.Pointer(newHandle(c, callback)))
+		C.sqlite3_preupdate_hook(c.db, (*[0]byte)(unsafe.Pointer(C.preUpdateHookTrampoline)), handle)
 	}
 }
 
@@ -115,3 +136,53 @@ func (d *SQLitePreUpdateData) New(dest ...any) error {
 	}
 	return d.row(dest, true)
 }
+
+// values returns copies of the old or new column values of the row.
+func (d *SQLitePreUpdateData) values(new bool) []any {
+	n := d.Count()
+	vals := make([]any, n)
+	for i := 0; i < n; i++ {
+		var val *C.sqlite3_value
+		var rc C.int
+		if new {
+			rc = C.sqlite3_preupdate_new(d.Conn.db, C.int(i), &val)
+		} else {
+			rc = C.sqlite3_preupdate_old(d.Conn.db, C.int(i), &val)
+		}
+		if rc != C.SQLITE_OK {
+			continue
+		}
+		switch C.sqlite3_value_type(val) {
+		case C.SQLITE_INTEGER:
+			vals[i] = int64(C.sqlite3_value_int64(val))
+		case C.SQLITE_FLOAT:
+			vals[i] = float64(C.sqlite3_value_double(val))
+		case C.SQLITE_BLOB:
+			vals[i] = C.GoBytes(C.sqlite3_value_blob(val), C.sqlite3_value_bytes(val))
+		case C.SQLITE_TEXT:
+			vals[i] = C.GoStringN((*C.char)(unsafe.Pointer(C.sqlite3_value_text(val))), C.sqlite3_value_bytes(val))
+		}
+	}
+	return vals
+}
+
+// subscribe feeds the changes reported by the pre-update hook, including the
+// old and new column values, into f.
+func (f *ChangeFeed) subscribe() (remove func()) {
+	return f.c.AddPreUpdateHook(func(d SQLitePreUpdateData) {
+		ch := Change{
+			Op:           d.Op,
+			DatabaseName: d.DatabaseName,
+			TableName:    d.TableName,
+			OldRowID:     d.OldRowID,
+			NewRowID:     d.NewRowID,
+		}
+		if d.Op != SQLITE_INSERT {
+			ch.Old = d.values(false)
+		}
+		if d.Op != SQLITE_DELETE {
+			ch.New = d.values(true)
+		}
+		f.record(ch)
+	})
+}
@@ -11,6 +11,7 @@ package sqlite3
 
 import (
 	"database/sql"
+	"reflect"
 	"testing"
 )
 
@@ -127,3 +128,81 @@ func TestPreUpdateHook(t *testing.T) {
 		t.Errorf("Expected event row 1 new column 0 to be == 99, got: %v", oldRow_2_0)
 	}
 }
+
+func TestAddPreUpdateHook(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+
+	var events []string
+	c.RegisterPreUpdateHook(func(data SQLitePreUpdateData) {
+		events = append(events, "registered")
+	})
+	remove := c.AddPreUpdateHook(func(data SQLitePreUpdateData) {
+		events = append(events, "added")
+	})
+
+	if _, err := c.Exec("create table foo (id integer primary key)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Exec("insert into foo values (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if _, err := c.Exec("insert into foo values (2)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"registered", "added", "registered"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+	}
+}
+
+func TestChangeFeedValues(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+
+	var changes []Change
+	feed, err := c.NewChangeFeed(func(batch []Change) {
+		changes = append(changes, batch...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+
+	for _, query := range []string{
+		"create table foo (id integer primary key, name text, data blob)",
+		"insert into foo values (1, 'a', x'01')",
+		"update foo set name = 'b' where id = 1",
+		"delete from foo",
+	} {
+		if _, err := c.Exec(query, nil); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+
+	expected := []Change{
+		{Op: SQLITE_INSERT, DatabaseName: "main", TableName: "foo", OldRowID: 1, NewRowID: 1, New: []any{int64(1), "a", []byte{1}}},
+		{Op: SQLITE_UPDATE, DatabaseName: "main", TableName: "foo", OldRowID: 1, NewRowID: 1, Old: []any{int64(1), "a", []byte{1}}, New: []any{int64(1), "b", []byte{1}}},
+		{Op: SQLITE_DELETE, DatabaseName: "main", TableName: "foo", OldRowID: 1, NewRowID: 1, Old: []any{int64(1), "b", []byte{1}}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
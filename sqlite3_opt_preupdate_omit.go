@@ -9,6 +9,8 @@
 
 package sqlite3
 
+import "unsafe"
+
 // RegisterPreUpdateHook sets the pre-update hook for a connection.
 //
 // The callback is passed a SQLitePreUpdateData struct with the data for
@@ -20,3 +22,32 @@ package sqlite3
 func (c *SQLiteConn) RegisterPreUpdateHook(callback func(SQLitePreUpdateData)) {
 	// NOOP
 }
+
+// AddPreUpdateHook adds a pre-update hook to the connection without
+// replacing the hook set by RegisterPreUpdateHook or any other hook added by
+// AddPreUpdateHook. Hooks are called in the same order as commit hooks.
+//
+// The returned function removes the hook; it is safe to call more than once.
+func (c *SQLiteConn) AddPreUpdateHook(callback func(SQLitePreUpdateData)) (remove func()) {
+	// NOOP
+	return func() {}
+}
+
+func (c *SQLiteConn) setPreUpdateHook(handle unsafe.Pointer) {
+	// NOOP
+}
+
+// subscribe feeds the changes reported by the update hook into f. Without
+// the pre-update hook the column values are not available.
+func (f *ChangeFeed) subscribe() (remove func()) {
+	return f.c.AddUpdateHook(func(op int, db string, table string, rowid int64) {
+		ch := Change{Op: op, DatabaseName: db, TableName: table}
+		if op != SQLITE_INSERT {
+			ch.OldRowID = rowid
+		}
+		if op != SQLITE_DELETE {
+			ch.NewRowID = rowid
+		}
+		f.record(ch)
+	})
+}
@@ -15,8 +15,10 @@ package sqlite3
 import "C"
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"strings"
 	"unsafe"
 )
 
@@ -55,20 +57,183 @@ func (c *SQLiteConn) Deserialize(b []byte, schema string) error {
 	if schema == "" {
 		schema = "main"
 	}
-	var zSchema *C.char
-	zSchema = C.CString(schema)
+	return c.deserialize(b, schema, DeserializeOptions{})
+}
+
+// SerializeOptions configures SerializeWith.
+type SerializeOptions struct {
+	// NoCopy returns the memory holding the database instead of a copy.
+	// It is only possible for an in-memory database kept in contiguous
+	// memory, such as one loaded with Deserialize. The returned slice
+	// must not be modified, and is only valid until the next change to
+	// the database or until it is closed.
+	NoCopy bool
+}
+
+// SerializeWith is like Serialize, with options.
+//
+// See https://www.sqlite.org/c3ref/serialize.html
+func (c *SQLiteConn) SerializeWith(schema string, opts SerializeOptions) ([]byte, error) {
+	if !opts.NoCopy {
+		return c.Serialize(schema)
+	}
+	if schema == "" {
+		schema = "main"
+	}
+	zSchema := C.CString(schema)
 	defer C.free(unsafe.Pointer(zSchema))
 
-	tmpBuf := (*C.uchar)(C.sqlite3_malloc64(C.sqlite3_uint64(len(b))))
-	if tmpBuf == nil && len(b) > 0 {
+	var sz C.sqlite3_int64 = -1
+	ptr := C.sqlite3_serialize(c.db, zSchema, &sz, C.SQLITE_SERIALIZE_NOCOPY)
+	if sz < 0 {
+		return nil, fmt.Errorf("serialize failed")
+	}
+	if sz > C.sqlite3_int64(math.MaxInt) {
+		return nil, fmt.Errorf("serialized database is too large (%d bytes)", sz)
+	}
+	if ptr == nil {
+		if sz == 0 {
+			return []byte{}, nil
+		}
+		return nil, fmt.Errorf("serialize failed: database %q is not held in contiguous memory", schema)
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(ptr)), int(sz)), nil
+}
+
+// DeserializeOptions configures DeserializeWith.
+type DeserializeOptions struct {
+	// ReadOnly makes the database read-only.
+	ReadOnly bool
+	// Resizeable lets the database grow beyond the size of the input,
+	// up to MaxSize.
+	Resizeable bool
+	// MaxSize, if positive, is the largest size in bytes the database may
+	// grow to. SQLite defaults it to SQLITE_MEMDB_DEFAULT_MAXSIZE.
+	MaxSize int64
+}
+
+// DeserializeWith is like Deserialize, with options. If schema is not the
+// name of a database of the connection, an in-memory database is attached
+// under that name first.
+//
+// The content of b is copied once into memory owned by SQLite, which frees
+// it when the database is closed, so b may be released as soon as
+// DeserializeWith returns. DeserializeBuffer avoids the copy.
+//
+// See https://www.sqlite.org/c3ref/deserialize.html
+func (c *SQLiteConn) DeserializeWith(b []byte, schema string, opts DeserializeOptions) error {
+	buf, err := NewSQLiteBuffer(len(b))
+	if err != nil {
 		return fmt.Errorf("deserialize failed: out of memory")
 	}
-	copy(unsafe.Slice((*byte)(unsafe.Pointer(tmpBuf)), len(b)), b)
+	copy(buf.Bytes(), b)
+	return c.DeserializeBuffer(buf, schema, opts)
+}
 
-	rc := C.sqlite3_deserialize(c.db, zSchema, tmpBuf, C.sqlite3_int64(len(b)),
-		C.sqlite3_int64(len(b)), C.SQLITE_DESERIALIZE_FREEONCLOSE)
+// SQLiteBuffer is memory allocated by SQLite, which DeserializeBuffer hands
+// over to a database without copying it.
+type SQLiteBuffer struct {
+	p *C.uchar
+	n int
+}
+
+// NewSQLiteBuffer allocates a buffer of n bytes with sqlite3_malloc64. Fill
+// it through Bytes, and then pass it to DeserializeBuffer or Free it.
+func NewSQLiteBuffer(n int) (*SQLiteBuffer, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("sqlite3: negative buffer size %d", n)
+	}
+	p := (*C.uchar)(C.sqlite3_malloc64(C.sqlite3_uint64(n)))
+	if p == nil && n > 0 {
+		return nil, ErrNomem
+	}
+	return &SQLiteBuffer{p: p, n: n}, nil
+}
+
+// Bytes returns the memory of the buffer. It is nil once the buffer has been
+// freed or handed over to a database.
+func (b *SQLiteBuffer) Bytes() []byte {
+	if b.p == nil {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(b.p)), b.n)
+}
+
+// Free releases the buffer if it has not been handed over to a database.
+func (b *SQLiteBuffer) Free() {
+	C.sqlite3_free(unsafe.Pointer(b.p))
+	b.p, b.n = nil, 0
+}
+
+// take returns the memory of the buffer and empties it.
+func (b *SQLiteBuffer) take() (*C.uchar, int) {
+	p, n := b.p, b.n
+	b.p, b.n = nil, 0
+	return p, n
+}
+
+// DeserializeBuffer is like DeserializeWith, but the database uses the
+// memory of buf as it is, and frees it when it is closed. buf is empty
+// afterwards, even if DeserializeBuffer fails.
+//
+// See https://www.sqlite.org/c3ref/deserialize.html
+func (c *SQLiteConn) DeserializeBuffer(buf *SQLiteBuffer, schema string, opts DeserializeOptions) error {
+	if schema == "" {
+		schema = "main"
+	}
+	zSchema := C.CString(schema)
+	attached := C.sqlite3_db_filename(c.db, zSchema) != nil
+	C.free(unsafe.Pointer(zSchema))
+	if attached {
+		return c.deserializeBuffer(buf, schema, opts)
+	}
+	name := `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+	if _, err := c.exec(context.Background(), "ATTACH ':memory:' AS "+name, nil); err != nil {
+		buf.Free()
+		return err
+	}
+	err := c.deserializeBuffer(buf, schema, opts)
+	if err != nil {
+		c.exec(context.Background(), "DETACH "+name, nil)
+	}
+	return err
+}
+
+func (c *SQLiteConn) deserialize(b []byte, schema string, opts DeserializeOptions) error {
+	buf, err := NewSQLiteBuffer(len(b))
+	if err != nil {
+		return fmt.Errorf("deserialize failed: out of memory")
+	}
+	copy(buf.Bytes(), b)
+	return c.deserializeBuffer(buf, schema, opts)
+}
+
+func (c *SQLiteConn) deserializeBuffer(buf *SQLiteBuffer, schema string, opts DeserializeOptions) error {
+	var zSchema *C.char
+	zSchema = C.CString(schema)
+	defer C.free(unsafe.Pointer(zSchema))
+
+	// SQLite frees the memory when the database is closed, or right away
+	// if sqlite3_deserialize fails.
+	p, n := buf.take()
+	flags := C.uint(C.SQLITE_DESERIALIZE_FREEONCLOSE)
+	if opts.ReadOnly {
+		flags |= C.SQLITE_DESERIALIZE_READONLY
+	}
+	if opts.Resizeable {
+		flags |= C.SQLITE_DESERIALIZE_RESIZEABLE
+	}
+	rc := C.sqlite3_deserialize(c.db, zSchema, p, C.sqlite3_int64(n),
+		C.sqlite3_int64(n), flags)
 	if rc != C.SQLITE_OK {
 		return fmt.Errorf("deserialize failed with return %v", rc)
 	}
+	if opts.MaxSize > 0 {
+		limit := C.sqlite3_int64(opts.MaxSize)
+		rc = C.sqlite3_file_control(c.db, zSchema, C.SQLITE_FCNTL_SIZE_LIMIT, unsafe.Pointer(&limit))
+		if rc != C.SQLITE_OK {
+			return fmt.Errorf("deserialize failed to set the size limit with return %v", rc)
+		}
+	}
 	return nil
 }
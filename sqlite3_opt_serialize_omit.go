@@ -19,3 +19,40 @@ func (c *SQLiteConn) Serialize(schema string) ([]byte, error) {
 func (c *SQLiteConn) Deserialize(b []byte, schema string) error {
 	return errors.New("sqlite3: Deserialize requires the sqlite_serialize build tag when using the libsqlite3 build tag")
 }
+
+// SerializeOptions configures SerializeWith.
+type SerializeOptions struct {
+	NoCopy bool
+}
+
+func (c *SQLiteConn) SerializeWith(schema string, opts SerializeOptions) ([]byte, error) {
+	return nil, errors.New("sqlite3: SerializeWith requires the sqlite_serialize build tag when using the libsqlite3 build tag")
+}
+
+// DeserializeOptions configures DeserializeWith.
+type DeserializeOptions struct {
+	ReadOnly   bool
+	Resizeable bool
+	MaxSize    int64
+}
+
+func (c *SQLiteConn) DeserializeWith(b []byte, schema string, opts DeserializeOptions) error {
+	return errors.New("sqlite3: DeserializeWith requires the sqlite_serialize build tag when using the libsqlite3 build tag")
+}
+
+// SQLiteBuffer is memory allocated by SQLite for DeserializeBuffer.
+type SQLiteBuffer struct{}
+
+func NewSQLiteBuffer(n int) (*SQLiteBuffer, error) {
+	return nil, errors.New("sqlite3: NewSQLiteBuffer requires the sqlite_serialize build tag when using the libsqlite3 build tag")
+}
+
+func (b *SQLiteBuffer) Bytes() []byte {
+	return nil
+}
+
+func (b *SQLiteBuffer) Free() {}
+
+func (c *SQLiteConn) DeserializeBuffer(buf *SQLiteBuffer, schema string, opts DeserializeOptions) error {
+	return errors.New("sqlite3: DeserializeBuffer requires the sqlite_serialize build tag when using the libsqlite3 build tag")
+}
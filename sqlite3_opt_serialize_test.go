@@ -6,7 +6,9 @@ package sqlite3
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -98,3 +100,112 @@ func TestSerializeDeserialize(t *testing.T) {
 		t.Fatalf("Destination table does not have the expected records")
 	}
 }
+
+func TestSerializeOptions(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE foo (name TEXT); INSERT INTO foo VALUES ('alice')"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(raw any) error {
+		c := raw.(*SQLiteConn)
+		data, err := c.Serialize("")
+		if err != nil {
+			return err
+		}
+
+		// A read-only database attached on the fly.
+		if err := c.DeserializeWith(data, "ref", DeserializeOptions{ReadOnly: true}); err != nil {
+			return err
+		}
+		rows, err := c.query(context.Background(), "SELECT name FROM ref.foo", nil)
+		if err != nil {
+			return err
+		}
+		dest := make([]driver.Value, 1)
+		err = rows.Next(dest)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if name, _ := dest[0].(string); name != "alice" {
+			t.Errorf("expected alice, got %v", dest[0])
+		}
+		if _, err := c.exec(context.Background(), "INSERT INTO ref.foo VALUES ('bob')", nil); err == nil {
+			t.Error("expected error writing to a read-only database")
+		}
+
+		// The serialized memory of the database without a copy.
+		view, err := c.SerializeWith("ref", SerializeOptions{NoCopy: true})
+		if err != nil {
+			return err
+		}
+		if string(view) != string(data) {
+			t.Error("expected the view to match the serialized database")
+		}
+		if _, err := c.SerializeWith("main", SerializeOptions{NoCopy: true}); err == nil {
+			t.Error("expected error for a database not held in contiguous memory")
+		}
+
+		// A resizeable database grows up to its size limit.
+		if err := c.DeserializeWith(data, "grow", DeserializeOptions{Resizeable: true, MaxSize: int64(len(data)) * 4}); err != nil {
+			return err
+		}
+		if _, err := c.exec(context.Background(), "INSERT INTO grow.foo VALUES ('bob')", nil); err != nil {
+			return err
+		}
+		_, err = c.exec(context.Background(), "INSERT INTO grow.foo SELECT randomblob(100000)", nil)
+		if err == nil || !strings.Contains(err.Error(), "full") {
+			t.Errorf("expected a full database error, got %v", err)
+		}
+		if err := c.DeserializeWith(data, "fixed", DeserializeOptions{}); err != nil {
+			return err
+		}
+		if _, err := c.exec(context.Background(), "INSERT INTO fixed.foo SELECT randomblob(100000)", nil); err == nil {
+			t.Error("expected error growing a database that is not resizeable")
+		}
+
+		// A buffer allocated by SQLite is used without a copy.
+		buf, err := NewSQLiteBuffer(len(data))
+		if err != nil {
+			return err
+		}
+		copy(buf.Bytes(), data)
+		mem := &buf.Bytes()[0]
+		if err := c.DeserializeBuffer(buf, "owned", DeserializeOptions{ReadOnly: true}); err != nil {
+			return err
+		}
+		if buf.Bytes() != nil {
+			t.Error("expected the buffer to be handed over")
+		}
+		buf.Free()
+		view, err = c.SerializeWith("owned", SerializeOptions{NoCopy: true})
+		if err != nil {
+			return err
+		}
+		if &view[0] != mem || string(view) != string(data) {
+			t.Error("expected the database to use the memory of the buffer")
+		}
+
+		if err := c.DeserializeWith([]byte("garbage"), "bad", DeserializeOptions{MaxSize: -1}); err != nil {
+			return err
+		}
+		if _, err := c.exec(context.Background(), "SELECT * FROM bad.sqlite_master", nil); err == nil {
+			t.Error("expected error reading an invalid database")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -32,6 +32,15 @@ static inline char *_sqlite3_mprintf(char *zFormat, char *arg) {
   return sqlite3_mprintf(zFormat, arg);
 }
 
+// sqlite3_vtab_config is variadic, which cgo cannot call directly.
+static int _sqlite3_vtab_config(sqlite3 *db, int op) {
+	return sqlite3_vtab_config(db, op);
+}
+
+static int _sqlite3_vtab_config_int(sqlite3 *db, int op, int arg) {
+	return sqlite3_vtab_config(db, op, arg);
+}
+
 typedef struct goVTab goVTab;
 
 struct goVTab {
@@ -68,6 +77,53 @@ static inline int cXConnect(sqlite3 *db, void *pAux, int argc, const char *const
 
 char* goVBestIndex(void *pVTab, void *icp);
 
+// Wrappers for the sqlite3_index_info interfaces added after the oldest
+// supported SQLite release.
+static int _sqlite3_vtab_rhs_value(sqlite3_index_info *info, int i, sqlite3_value **ppVal) {
+#if SQLITE_VERSION_NUMBER >= 3038000
+	return sqlite3_vtab_rhs_value(info, i, ppVal);
+#else
+	return SQLITE_NOTFOUND;
+#endif
+}
+
+static int _sqlite3_vtab_in(sqlite3_index_info *info, int i, int bHandle) {
+#if SQLITE_VERSION_NUMBER >= 3038000
+	return sqlite3_vtab_in(info, i, bHandle);
+#else
+	return 0;
+#endif
+}
+
+static int _sqlite3_vtab_distinct(sqlite3_index_info *info) {
+#if SQLITE_VERSION_NUMBER >= 3038000
+	return sqlite3_vtab_distinct(info);
+#else
+	return 0;
+#endif
+}
+
+static int _sqlite3_vtab_in_first(sqlite3_value *pVal, sqlite3_value **ppOut) {
+#if SQLITE_VERSION_NUMBER >= 3038000
+	// SQLite passes IN lists as "ValueList" pointer values. Check for one
+	// first, as sqlite3_vtab_in_first logs a misuse error for other values.
+	if (!sqlite3_value_pointer(pVal, "ValueList")) {
+		return SQLITE_ERROR;
+	}
+	return sqlite3_vtab_in_first(pVal, ppOut);
+#else
+	return SQLITE_ERROR;
+#endif
+}
+
+static int _sqlite3_vtab_in_next(sqlite3_value *pVal, sqlite3_value **ppOut) {
+#if SQLITE_VERSION_NUMBER >= 3038000
+	return sqlite3_vtab_in_next(pVal, ppOut);
+#else
+	return SQLITE_DONE;
+#endif
+}
+
 static inline int cXBestIndex(sqlite3_vtab *pVTab, sqlite3_index_info *info) {
 	char *pzErr = goVBestIndex(((goVTab*)pVTab)->vTab, info);
 	if (pzErr) {
@@ -190,10 +246,84 @@ static int cXRowid(sqlite3_vtab_cursor *pCursor, sqlite3_int64 *pRowid) {
 	return SQLITE_OK;
 }
 
-char* goVUpdate(void *pVTab, int argc, sqlite3_value **argv, sqlite3_int64 *pRowid);
+char* goVUpdate(void *pVTab, int argc, sqlite3_value **argv, sqlite3_int64 *pRowid, int *rc);
 
 static int cXUpdate(sqlite3_vtab *pVTab, int argc, sqlite3_value **argv, sqlite3_int64 *pRowid) {
-	char *pzErr = goVUpdate(((goVTab*)pVTab)->vTab, argc, argv, pRowid);
+	int rc = SQLITE_ERROR;
+	char *pzErr = goVUpdate(((goVTab*)pVTab)->vTab, argc, argv, pRowid, &rc);
+	if (pzErr) {
+		if (pVTab->zErrMsg)
+			sqlite3_free(pVTab->zErrMsg);
+		pVTab->zErrMsg = pzErr;
+		return rc;
+	}
+	return SQLITE_OK;
+}
+
+// Operations passed to goVTransaction.
+enum {
+	goVTabBegin,
+	goVTabSync,
+	goVTabCommit,
+	goVTabRollback,
+	goVTabSavepoint,
+	goVTabRelease,
+	goVTabRollbackTo
+};
+
+char* goVTransaction(void *pVTab, int op, int n);
+
+static int cXTransaction(sqlite3_vtab *pVTab, int op, int n) {
+	char *pzErr = goVTransaction(((goVTab*)pVTab)->vTab, op, n);
+	if (pzErr) {
+		if (pVTab->zErrMsg)
+			sqlite3_free(pVTab->zErrMsg);
+		pVTab->zErrMsg = pzErr;
+		return SQLITE_ERROR;
+	}
+	return SQLITE_OK;
+}
+
+static int cXBegin(sqlite3_vtab *pVTab) {
+	return cXTransaction(pVTab, goVTabBegin, 0);
+}
+static int cXSync(sqlite3_vtab *pVTab) {
+	return cXTransaction(pVTab, goVTabSync, 0);
+}
+static int cXCommit(sqlite3_vtab *pVTab) {
+	return cXTransaction(pVTab, goVTabCommit, 0);
+}
+static int cXRollback(sqlite3_vtab *pVTab) {
+	return cXTransaction(pVTab, goVTabRollback, 0);
+}
+static int cXSavepoint(sqlite3_vtab *pVTab, int n) {
+	return cXTransaction(pVTab, goVTabSavepoint, n);
+}
+static int cXReleaseSavepoint(sqlite3_vtab *pVTab, int n) {
+	return cXTransaction(pVTab, goVTabRelease, n);
+}
+static int cXRollbackTo(sqlite3_vtab *pVTab, int n) {
+	return cXTransaction(pVTab, goVTabRollbackTo, n);
+}
+
+void callbackTrampoline(sqlite3_context*, int, sqlite3_value**);
+uintptr_t goVFindFunction(void *pVTab, int nArg, char *zName, int *pOp);
+
+static int cXFindFunction(sqlite3_vtab *pVTab, int nArg, const char *zName, void (**pxFunc)(sqlite3_context*,int,sqlite3_value**), void **ppArg) {
+	int op = 0;
+	void *arg = (void *)goVFindFunction(((goVTab*)pVTab)->vTab, nArg, (char*)zName, &op);
+	if (!arg) {
+		return 0;
+	}
+	*pxFunc = callbackTrampoline;
+	*ppArg = arg;
+	return op;
+}
+
+char* goVRename(void *pVTab, char *zNew);
+
+static int cXRename(sqlite3_vtab *pVTab, const char *zNew) {
+	char *pzErr = goVRename(((goVTab*)pVTab)->vTab, (char*)zNew);
 	if (pzErr) {
 		if (pVTab->zErrMsg)
 			sqlite3_free(pVTab->zErrMsg);
@@ -203,8 +333,41 @@ static int cXUpdate(sqlite3_vtab *pVTab, int argc, sqlite3_value **argv, sqlite3
 	return SQLITE_OK;
 }
 
+// xShadowName is only given the suffix, not the sqlite3_vtab or the
+// client data of the module, so there is nowhere to look up the Go module
+// from. Instead the copy of goModule of each module that implements
+// ShadowNameModule points to one of a fixed set of functions, which pass
+// their slot number to Go.
+int goMShadowName(int slot, char *zName);
+
+#define GO_SHADOW_NAME(i) \
+	static int cXShadowName##i(const char *zName) { return goMShadowName(i, (char*)zName); }
+GO_SHADOW_NAME(0) GO_SHADOW_NAME(1) GO_SHADOW_NAME(2) GO_SHADOW_NAME(3)
+GO_SHADOW_NAME(4) GO_SHADOW_NAME(5) GO_SHADOW_NAME(6) GO_SHADOW_NAME(7)
+GO_SHADOW_NAME(8) GO_SHADOW_NAME(9) GO_SHADOW_NAME(10) GO_SHADOW_NAME(11)
+GO_SHADOW_NAME(12) GO_SHADOW_NAME(13) GO_SHADOW_NAME(14) GO_SHADOW_NAME(15)
+
+static int (*const cXShadowNames[])(const char*) = {
+	cXShadowName0, cXShadowName1, cXShadowName2, cXShadowName3,
+	cXShadowName4, cXShadowName5, cXShadowName6, cXShadowName7,
+	cXShadowName8, cXShadowName9, cXShadowName10, cXShadowName11,
+	cXShadowName12, cXShadowName13, cXShadowName14, cXShadowName15,
+};
+
+#if SQLITE_VERSION_NUMBER >= 3044000
+char* goVIntegrity(void *pVTab, char *zSchema, char *zTabName, int mFlags);
+
+static int cXIntegrity(sqlite3_vtab *pVTab, const char *zSchema, const char *zTabName, int mFlags, char **pzErr) {
+	*pzErr = goVIntegrity(((goVTab*)pVTab)->vTab, (char*)zSchema, (char*)zTabName, mFlags);
+	return SQLITE_OK;
+}
+#define GO_MODULE_VERSION 4
+#else
+#define GO_MODULE_VERSION 3
+#endif
+
 static sqlite3_module goModule = {
-	0,                       // iVersion
+	GO_MODULE_VERSION,       // iVersion
 	cXCreate,                // xCreate - create a table
 	cXConnect,               // xConnect - connect to an existing table
 	cXBestIndex,             // xBestIndex - Determine search strategy
@@ -218,21 +381,24 @@ static sqlite3_module goModule = {
 	cXColumn,                // xColumn - read data
 	cXRowid,                 // xRowid - read data
 	cXUpdate,                // xUpdate - write data
-// Not implemented
-	0,                       // xBegin - begin transaction
-	0,                       // xSync - sync transaction
-	0,                       // xCommit - commit transaction
-	0,                       // xRollback - rollback transaction
-	0,                       // xFindFunction - function overloading
-	0,                       // xRename - rename the table
-	0,                       // xSavepoint
+	0,                       // xBegin, see _sqlite3_module_transactions
+	0,                       // xSync
+	0,                       // xCommit
+	0,                       // xRollback
+	cXFindFunction,          // xFindFunction - function overloading
+	cXRename,                // xRename - rename the table
+	0,                       // xSavepoint, see _sqlite3_module_transactions
 	0,                       // xRelease
-	0	                     // xRollbackTo
+	0,                       // xRollbackTo
+	0,                       // xShadowName, see _sqlite3_module_shadow_name
+#if SQLITE_VERSION_NUMBER >= 3044000
+	cXIntegrity,             // xIntegrity
+#endif
 };
 
 // See https://sqlite.org/vtab.html#eponymous_only_virtual_tables
 static sqlite3_module goModuleEponymousOnly = {
-	0,                       // iVersion
+	GO_MODULE_VERSION,       // iVersion
 	0,                       // xCreate - create a table, which here is null
 	cXConnect,               // xConnect - connect to an existing table
 	cXBestIndex,             // xBestIndex - Determine search strategy
@@ -246,26 +412,55 @@ static sqlite3_module goModuleEponymousOnly = {
 	cXColumn,                // xColumn - read data
 	cXRowid,                 // xRowid - read data
 	cXUpdate,                // xUpdate - write data
-// Not implemented
-	0,                       // xBegin - begin transaction
-	0,                       // xSync - sync transaction
-	0,                       // xCommit - commit transaction
-	0,                       // xRollback - rollback transaction
-	0,                       // xFindFunction - function overloading
-	0,                       // xRename - rename the table
-	0,                       // xSavepoint
+	0,                       // xBegin, see _sqlite3_module_transactions
+	0,                       // xSync
+	0,                       // xCommit
+	0,                       // xRollback
+	cXFindFunction,          // xFindFunction - function overloading
+	cXRename,                // xRename - rename the table
+	0,                       // xSavepoint, see _sqlite3_module_transactions
 	0,                       // xRelease
-	0	                     // xRollbackTo
+	0,                       // xRollbackTo
+	0,                       // xShadowName, see _sqlite3_module_shadow_name
+#if SQLITE_VERSION_NUMBER >= 3044000
+	cXIntegrity,             // xIntegrity
+#endif
 };
 
 void goMDestroy(void*);
 
-static int _sqlite3_create_module(sqlite3 *db, const char *zName, uintptr_t pClientData) {
-  return sqlite3_create_module_v2(db, zName, &goModule, (void*) pClientData, goMDestroy);
+// Returns a copy of goModule, or goModuleEponymousOnly, for a single
+// module, which must be freed with sqlite3_free once the module is
+// destroyed.
+static sqlite3_module *_sqlite3_module_copy(int eponymousOnly) {
+  sqlite3_module *m = (sqlite3_module *)sqlite3_malloc(sizeof(sqlite3_module));
+  if (!m) {
+    return 0;
+  }
+  *m = eponymousOnly ? goModuleEponymousOnly : goModule;
+  return m;
+}
+
+// Installs the transaction methods, and the savepoint methods if
+// savepoints is set, so that SQLite starts calling them.
+static void _sqlite3_module_transactions(sqlite3_module *m, int savepoints) {
+  m->xBegin = cXBegin;
+  m->xSync = cXSync;
+  m->xCommit = cXCommit;
+  m->xRollback = cXRollback;
+  if (savepoints) {
+    m->xSavepoint = cXSavepoint;
+    m->xRelease = cXReleaseSavepoint;
+    m->xRollbackTo = cXRollbackTo;
+  }
 }
 
-static int _sqlite3_create_module_eponymous_only(sqlite3 *db, const char *zName, uintptr_t pClientData) {
-  return sqlite3_create_module_v2(db, zName, &goModuleEponymousOnly, (void*) pClientData, goMDestroy);
+static void _sqlite3_module_shadow_name(sqlite3_module *m, int slot) {
+  m->xShadowName = cXShadowNames[slot];
+}
+
+static int _sqlite3_create_module_with(sqlite3 *db, const char *zName, sqlite3_module *m, uintptr_t pClientData) {
+  return sqlite3_create_module_v2(db, zName, m, (void*) pClientData, goMDestroy);
 }
 */
 import "C"
@@ -273,6 +468,9 @@ import "C"
 import (
 	"fmt"
 	"math"
+	"reflect"
+	"strings"
+	"sync"
 	"unsafe"
 )
 
@@ -280,11 +478,86 @@ type sqliteModule struct {
 	c      *SQLiteConn
 	name   string
 	module Module
+	// cmod is the sqlite3_module of this module only, so that its
+	// transaction methods can be installed when a table needs them.
+	cmod *C.sqlite3_module
+	// transactions is set once the transaction methods are installed.
+	transactions bool
+	// slot is the xShadowName slot of a ShadowNameModule, or -1.
+	slot int
 }
 
 type sqliteVTab struct {
 	module *sqliteModule
 	vTab   VTab
+	// funcs caches the results of VTabFunctionFinder.
+	funcs map[string]vtabFunc
+}
+
+// vtabFunc is a function overloaded by a VTabFunctionFinder.
+type vtabFunc struct {
+	handle unsafe.Pointer
+	op     C.int
+}
+
+// shadowNameSlots is the number of xShadowName functions in the C
+// preamble, and so the number of distinct ShadowNameModules that can be
+// registered at a time.
+const shadowNameSlots = 16
+
+// shadowNameModules holds the module using each xShadowName slot, and the
+// number of connections it is registered with.
+var shadowNameModules struct {
+	sync.Mutex
+	m    [shadowNameSlots]ShadowNameModule
+	refs [shadowNameSlots]int
+}
+
+// useShadowName allocates an xShadowName slot to m and installs it in
+// m.cmod. A module registered with several connections shares its slot if
+// it is comparable.
+func (m *sqliteModule) useShadowName() error {
+	sm := m.module.(ShadowNameModule)
+	comparable := reflect.TypeOf(sm).Comparable()
+	shadowNameModules.Lock()
+	defer shadowNameModules.Unlock()
+	slot := -1
+	for i, other := range shadowNameModules.m {
+		if other == nil {
+			if slot < 0 {
+				slot = i
+			}
+		} else if comparable && other == sm {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 {
+		return fmt.Errorf("sqlite3: too many modules implementing ShadowNameModule, at most %d can be registered", shadowNameSlots)
+	}
+	C._sqlite3_module_shadow_name(m.cmod, C.int(slot))
+	shadowNameModules.m[slot] = sm
+	shadowNameModules.refs[slot]++
+	m.slot = slot
+	return nil
+}
+
+// useTransactions installs the transaction methods in m.cmod the first
+// time a table of m implements VTabTransactioner. Other tables of the
+// module then get calls for the methods they lack, which do nothing.
+func (m *sqliteModule) useTransactions(vTab VTab) {
+	if m.transactions {
+		return
+	}
+	if _, ok := vTab.(VTabTransactioner); !ok {
+		return
+	}
+	var savepoints C.int
+	if _, ok := vTab.(VTabSavepointer); ok {
+		savepoints = 1
+	}
+	C._sqlite3_module_transactions(m.cmod, savepoints)
+	m.transactions = true
 }
 
 type sqliteVTabCursor struct {
@@ -369,12 +642,98 @@ func orderBys(info *C.sqlite3_index_info) []InfoOrderBy {
 // output fields for `sqlite3_index_info`
 // See: https://www.sqlite.org/c3ref/index_info.html
 type IndexResult struct {
-	Used           []bool // aConstraintUsage
+	Used []bool // aConstraintUsage
+	// Omit tells SQLite not to check the used constraints again on the
+	// rows returned. If it is nil, every used constraint is omitted.
+	Omit           []bool
 	IdxNum         int
 	IdxStr         string
 	AlreadyOrdered bool // orderByConsumed
 	EstimatedCost  float64
 	EstimatedRows  float64
+	IdxFlags       int // IndexScanUnique
+}
+
+// IndexScanUnique is the IndexResult.IdxFlags bit telling SQLite that the
+// plan returns at most one row.
+const IndexScanUnique = 1
+
+// IndexInfo describes the query passed to VTabBestIndexer.BestIndexInfo.
+// Its methods may only be called during that call.
+// See: https://www.sqlite.org/c3ref/index_info.html
+type IndexInfo struct {
+	Constraints []InfoConstraint
+	OrderBy     []InfoOrderBy
+	// ColUsed has bit i set if column i is used by the statement; bit 63
+	// stands for every column from 63 up.
+	ColUsed uint64
+
+	info *C.sqlite3_index_info
+}
+
+// RHSValue returns the right-hand value of constraint i if it is known
+// when planning, typically because it is a literal. It requires SQLite
+// 3.38.0 or later.
+// See: https://www.sqlite.org/c3ref/vtab_rhs_value.html
+func (ii *IndexInfo) RHSValue(i int) (any, bool) {
+	var v *C.sqlite3_value
+	if ii.info == nil || C._sqlite3_vtab_rhs_value(ii.info, C.int(i), &v) != C.SQLITE_OK {
+		return nil, false
+	}
+	x, err := vtabValue(v)
+	return x, err == nil
+}
+
+// In reports whether constraint i is an IN operator that can be processed
+// all at once. If it is and handle is true, and the constraint is used,
+// Filter receives the whole list of values as a []any in a single call
+// instead of being called for each value. It requires SQLite 3.38.0 or
+// later.
+// See: https://www.sqlite.org/c3ref/vtab_in.html
+func (ii *IndexInfo) In(i int, handle bool) bool {
+	if ii.info == nil {
+		return false
+	}
+	var h C.int
+	if handle {
+		h = 1
+	}
+	return C._sqlite3_vtab_in(ii.info, C.int(i), h) != 0
+}
+
+// Distinct tells how the rows returned are used: 0 if they must all be
+// returned in order, 1 if only rows with distinct values of the ORDER BY
+// columns are needed, 2 if they are also only needed in groups of equal
+// values, and 3 if both apply. It requires SQLite 3.38.0 or later.
+// See: https://www.sqlite.org/c3ref/vtab_distinct.html
+func (ii *IndexInfo) Distinct() int {
+	if ii.info == nil {
+		return 0
+	}
+	return int(C._sqlite3_vtab_distinct(ii.info))
+}
+
+// Collation returns the name of the collating sequence of constraint i.
+// See: https://www.sqlite.org/c3ref/vtab_collation.html
+func (ii *IndexInfo) Collation(i int) string {
+	if ii.info == nil {
+		return ""
+	}
+	return C.GoString(C.sqlite3_vtab_collation(ii.info, C.int(i)))
+}
+
+// vtabValue converts a value passed to a virtual table method.
+func vtabValue(v *C.sqlite3_value) (any, error) {
+	conv, err := callbackArgGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	// work around for SQLITE_NULL
+	x := conv.Interface()
+	if z, ok := x.([]byte); ok && z == nil {
+		x = nil
+	}
+	return x, nil
 }
 
 // mPrintf is a utility wrapper around sqlite3_mprintf
@@ -409,7 +768,8 @@ func goMInit(db, pClientData unsafe.Pointer, argc C.int, argv **C.char, pzErr **
 		*pzErr = mPrintf("%s", err.Error())
 		return 0
 	}
-	vt := sqliteVTab{m, vTab}
+	m.useTransactions(vTab)
+	vt := sqliteVTab{module: m, vTab: vTab}
 	*pzErr = nil
 	return C.uintptr_t(uintptr(newHandle(m.c, &vt)))
 }
@@ -450,7 +810,15 @@ func goVBestIndex(pVTab unsafe.Pointer, icp unsafe.Pointer) *C.char {
 	vt := lookupHandle(pVTab).(*sqliteVTab)
 	info := (*C.sqlite3_index_info)(icp)
 	csts := constraints(info)
-	res, err := vt.vTab.BestIndex(csts, orderBys(info))
+	var res *IndexResult
+	var err error
+	if bi, ok := vt.vTab.(VTabBestIndexer); ok {
+		ii := &IndexInfo{Constraints: csts, OrderBy: orderBys(info), ColUsed: uint64(info.colUsed), info: info}
+		res, err = bi.BestIndexInfo(ii)
+		ii.info = nil
+	} else {
+		res, err = vt.vTab.BestIndex(csts, orderBys(info))
+	}
 	if err != nil {
 		return mPrintf("%s", err.Error())
 	}
@@ -460,6 +828,9 @@ func goVBestIndex(pVTab unsafe.Pointer, icp unsafe.Pointer) *C.char {
 	if len(res.Used) != len(csts) {
 		return mPrintf("Result.Used != expected value", "")
 	}
+	if res.Omit != nil && len(res.Omit) != len(csts) {
+		return mPrintf("Result.Omit != expected value", "")
+	}
 
 	// Get a pointer to constraint_usage struct so we can update in place.
 
@@ -472,7 +843,9 @@ func goVBestIndex(pVTab unsafe.Pointer, icp unsafe.Pointer) *C.char {
 		// invocation for a different plan.
 		if res.Used[i] && csts[i].Usable {
 			slice[i].argvIndex = C.int(index)
-			slice[i].omit = C.uchar(1)
+			if res.Omit == nil || res.Omit[i] {
+				slice[i].omit = C.uchar(1)
+			}
 			index++
 		}
 	}
@@ -492,6 +865,7 @@ func goVBestIndex(pVTab unsafe.Pointer, icp unsafe.Pointer) *C.char {
 	if res.AlreadyOrdered {
 		info.orderByConsumed = C.int(1)
 	}
+	info.idxFlags = C.int(res.IdxFlags)
 	// SQLite pre-initializes estimatedCost and estimatedRows with sensible
 	// defaults; overwriting them with the Go zero value would make every
 	// candidate plan look free and break query planning, so only pass
@@ -531,6 +905,29 @@ func goMDestroy(pClientData unsafe.Pointer) {
 	m := lookupHandle(pClientData).(*sqliteModule)
 	m.module.DestroyModule()
 	deleteHandle(pClientData)
+	C.sqlite3_free(unsafe.Pointer(m.cmod))
+	if m.slot >= 0 {
+		shadowNameModules.Lock()
+		shadowNameModules.refs[m.slot]--
+		if shadowNameModules.refs[m.slot] == 0 {
+			shadowNameModules.m[m.slot] = nil
+		}
+		shadowNameModules.Unlock()
+	}
+}
+
+//export goMShadowName
+func goMShadowName(slot C.int, zName *C.char) C.int {
+	shadowNameModules.Lock()
+	m := shadowNameModules.m[slot]
+	shadowNameModules.Unlock()
+	if m == nil {
+		return 0
+	}
+	if m.ShadowName(C.GoString(zName)) {
+		return 1
+	}
+	return 0
 }
 
 //export goVFilter
@@ -539,17 +936,18 @@ func goVFilter(pCursor unsafe.Pointer, idxNum C.int, idxName *C.char, argc C.int
 	args := (*[(math.MaxInt32 - 1) / unsafe.Sizeof((*C.sqlite3_value)(nil))]*C.sqlite3_value)(unsafe.Pointer(argv))[:argc:argc]
 	vals := make([]any, 0, argc)
 	for _, v := range args {
-		conv, err := callbackArgGeneric(v)
+		list, ok, err := vtabInList(v)
 		if err != nil {
 			return mPrintf("%s", err.Error())
 		}
-
-		// work around for SQLITE_NULL
-		x := conv.Interface()
-		if z, ok := x.([]byte); ok && z == nil {
-			x = nil
+		if ok {
+			vals = append(vals, list)
+			continue
+		}
+		x, err := vtabValue(v)
+		if err != nil {
+			return mPrintf("%s", err.Error())
 		}
-
 		vals = append(vals, x)
 	}
 	err := vtc.vTabCursor.Filter(int(idxNum), C.GoString(idxName), vals)
@@ -559,6 +957,33 @@ func goVFilter(pCursor unsafe.Pointer, idxNum C.int, idxName *C.char, argc C.int
 	return nil
 }
 
+// vtabInList returns the values of the right-hand side of an IN operator
+// processed all at once, see IndexInfo.In.
+func vtabInList(v *C.sqlite3_value) ([]any, bool, error) {
+	if C.sqlite3_value_type(v) != C.SQLITE_NULL {
+		return nil, false, nil
+	}
+	var x *C.sqlite3_value
+	rv := C._sqlite3_vtab_in_first(v, &x)
+	if rv != C.SQLITE_OK && rv != C.SQLITE_DONE {
+		// Not an IN list, but a NULL.
+		return nil, false, nil
+	}
+	list := []any{}
+	for rv == C.SQLITE_OK {
+		val, err := vtabValue(x)
+		if err != nil {
+			return nil, false, err
+		}
+		list = append(list, val)
+		rv = C._sqlite3_vtab_in_next(v, &x)
+	}
+	if rv != C.SQLITE_DONE {
+		return nil, false, Error{Code: ErrNo(rv)}
+	}
+	return list, true, nil
+}
+
 //export goVNext
 func goVNext(pCursor unsafe.Pointer) *C.char {
 	vtc := lookupHandle(pCursor).(*sqliteVTabCursor)
@@ -602,7 +1027,7 @@ func goVRowid(pCursor unsafe.Pointer, pRowid *C.sqlite3_int64) *C.char {
 }
 
 //export goVUpdate
-func goVUpdate(pVTab unsafe.Pointer, argc C.int, argv **C.sqlite3_value, pRowid *C.sqlite3_int64) *C.char {
+func goVUpdate(pVTab unsafe.Pointer, argc C.int, argv **C.sqlite3_value, pRowid *C.sqlite3_int64, rc *C.int) *C.char {
 	vt := lookupHandle(pVTab).(*sqliteVTab)
 
 	var tname string
@@ -618,6 +1043,10 @@ func goVUpdate(pVTab unsafe.Pointer, argc C.int, argv **C.sqlite3_value, pRowid
 		args := (*[(math.MaxInt32 - 1) / unsafe.Sizeof((*C.sqlite3_value)(nil))]*C.sqlite3_value)(unsafe.Pointer(argv))[:argc:argc]
 		vals := make([]any, 0, argc)
 		for _, v := range args {
+			if C.sqlite3_value_nochange(v) != 0 {
+				vals = append(vals, Unchanged{})
+				continue
+			}
 			conv, err := callbackArgGeneric(v)
 			if err != nil {
 				return mPrintf("%s", err.Error())
@@ -657,12 +1086,107 @@ func goVUpdate(pVTab unsafe.Pointer, argc C.int, argv **C.sqlite3_value, pRowid
 	}
 
 	if err != nil {
+		*rc = C.int(errorCode(err, C.SQLITE_ERROR))
 		return mPrintf("%s", err.Error())
 	}
 
 	return nil
 }
 
+//export goVTransaction
+func goVTransaction(pVTab unsafe.Pointer, op, n C.int) *C.char {
+	vt := lookupHandle(pVTab).(*sqliteVTab)
+	var err error
+	switch op {
+	case C.goVTabBegin, C.goVTabSync, C.goVTabCommit, C.goVTabRollback:
+		tx, ok := vt.vTab.(VTabTransactioner)
+		if !ok {
+			return nil
+		}
+		switch op {
+		case C.goVTabBegin:
+			err = tx.Begin()
+		case C.goVTabSync:
+			err = tx.Sync()
+		case C.goVTabCommit:
+			err = tx.Commit()
+		case C.goVTabRollback:
+			err = tx.Rollback()
+		}
+	default:
+		sp, ok := vt.vTab.(VTabSavepointer)
+		if !ok {
+			return nil
+		}
+		switch op {
+		case C.goVTabSavepoint:
+			err = sp.Savepoint(int(n))
+		case C.goVTabRelease:
+			err = sp.Release(int(n))
+		case C.goVTabRollbackTo:
+			err = sp.RollbackTo(int(n))
+		}
+	}
+	if err != nil {
+		return mPrintf("%s", err.Error())
+	}
+	return nil
+}
+
+//export goVFindFunction
+func goVFindFunction(pVTab unsafe.Pointer, nArg C.int, zName *C.char, pOp *C.int) C.uintptr_t {
+	vt := lookupHandle(pVTab).(*sqliteVTab)
+	ff, ok := vt.vTab.(VTabFunctionFinder)
+	if !ok {
+		return 0
+	}
+	name := C.GoString(zName)
+	key := fmt.Sprintf("%s/%d", strings.ToLower(name), nArg)
+	f, ok := vt.funcs[key]
+	if !ok {
+		impl, op := ff.FindFunction(int(nArg), name)
+		if impl != nil {
+			// There is no way to report an error from xFindFunction,
+			// so an unusable function is not overloaded.
+			if fi, _, err := newFunctionInfo(impl); err == nil {
+				f.handle = newHandle(vt.module.c, fi)
+				f.op = 1
+				if op >= OpFUNCTION {
+					f.op = C.int(op)
+				}
+			}
+		}
+		if vt.funcs == nil {
+			vt.funcs = make(map[string]vtabFunc)
+		}
+		vt.funcs[key] = f
+	}
+	*pOp = f.op
+	return C.uintptr_t(uintptr(f.handle))
+}
+
+//export goVRename
+func goVRename(pVTab unsafe.Pointer, zNew *C.char) *C.char {
+	vt := lookupHandle(pVTab).(*sqliteVTab)
+	if r, ok := vt.vTab.(VTabRenamer); ok {
+		if err := r.Rename(C.GoString(zNew)); err != nil {
+			return mPrintf("%s", err.Error())
+		}
+	}
+	return nil
+}
+
+//export goVIntegrity
+func goVIntegrity(pVTab unsafe.Pointer, zSchema, zTabName *C.char, mFlags C.int) *C.char {
+	vt := lookupHandle(pVTab).(*sqliteVTab)
+	if ic, ok := vt.vTab.(VTabIntegrityChecker); ok {
+		if err := ic.Integrity(C.GoString(zSchema), C.GoString(zTabName), mFlags&1 != 0); err != nil {
+			return mPrintf("%s", err.Error())
+		}
+	}
+	return nil
+}
+
 // Module is a "virtual table module", it defines the implementation of a
 // virtual tables. See: http://sqlite.org/c3ref/module.html
 type Module interface {
@@ -681,6 +1205,23 @@ type EponymousOnlyModule interface {
 	EponymousOnlyModule()
 }
 
+// ShadowNameModule is a "virtual table module" (as above) whose tables own
+// shadow tables, which store their content in the database. ShadowName
+// reports whether suffix is the suffix of the name of one of them, that is
+// whether a table named "<vtab>_<suffix>" belongs to the virtual table
+// <vtab>. With SQLITE_DBCONFIG_DEFENSIVE, shadow tables are read-only to
+// ordinary SQL.
+//
+// Since SQLite calls xShadowName without the client data of the module,
+// at most 16 distinct ShadowNameModules can be registered at a time. The
+// same module registered with several connections counts once, provided it
+// is comparable, such as a pointer.
+// See: https://sqlite.org/vtab.html#the_xshadowname_method
+type ShadowNameModule interface {
+	Module
+	ShadowName(suffix string) bool
+}
+
 // VTab describes a particular instance of the virtual table.
 // See: http://sqlite.org/c3ref/vtab.html
 type VTab interface {
@@ -694,8 +1235,21 @@ type VTab interface {
 	Open() (VTabCursor, error)
 }
 
+// VTabBestIndexer is a VTab that plans queries from the whole
+// sqlite3_index_info. If a VTab implements it, BestIndexInfo is called
+// instead of BestIndex.
+// See: http://sqlite.org/vtab.html#xbestindex
+type VTabBestIndexer interface {
+	BestIndexInfo(info *IndexInfo) (*IndexResult, error)
+}
+
 // VTabUpdater is a type that allows a VTab to be inserted, updated, or
 // deleted.
+//
+// Returning ErrConstraint, or an Error with that code, reports a constraint
+// violation to SQLite. A table that enabled SQLITE_VTAB_CONSTRAINT_SUPPORT
+// with VTabConfig can call VTabOnConflict from Insert and Update to honor
+// the conflict resolution of the statement.
 // See: https://sqlite.org/vtab.html#xupdate
 type VTabUpdater interface {
 	Delete(any) error
@@ -703,6 +1257,76 @@ type VTabUpdater interface {
 	Update(any, []any) error
 }
 
+// Unchanged is passed to VTabUpdater.Update in place of the value of a
+// column that the UPDATE does not change, when the Column method of the
+// cursor left its result unset because SQLiteContext.NoChange reported true.
+type Unchanged struct{}
+
+// VTabTransactioner is a VTab that takes part in the transactions of the
+// connection. Begin is called before the first change to the table in a
+// transaction, Sync in the first phase of the commit, before any table or
+// database is committed, and then Commit or Rollback end the transaction.
+// An error from Sync makes the whole transaction roll back.
+//
+// SQLite only calls these methods, and those of VTabSavepointer, for
+// modules whose Create or Connect has returned a VTabTransactioner.
+// See: https://sqlite.org/vtab.html#the_xbegin_method
+type VTabTransactioner interface {
+	// http://sqlite.org/vtab.html#the_xbegin_method
+	Begin() error
+	// http://sqlite.org/vtab.html#the_xsync_method
+	Sync() error
+	// http://sqlite.org/vtab.html#the_xcommit_method
+	Commit() error
+	// http://sqlite.org/vtab.html#the_xrollback_method
+	Rollback() error
+}
+
+// VTabSavepointer is a VTab that supports nested transactions. Its methods
+// are only called between Begin and Commit or Rollback. The savepoints are numbered from 0 up; Release and
+// RollbackTo act on savepoint n and every later one, and RollbackTo keeps
+// savepoint n open.
+// See: https://sqlite.org/vtab.html#the_xsavepoint_xrelease_and_xrollbackto_methods
+type VTabSavepointer interface {
+	Savepoint(n int) error
+	Release(n int) error
+	RollbackTo(n int) error
+}
+
+// VTabFunctionFinder is a VTab that overloads SQL functions taking one of
+// its columns as their first argument. FindFunction returns the
+// implementation of the function name called with nArg arguments, following
+// the rules of RegisterFunc, or nil to use the global function. It is called
+// once per name and number of arguments for each connection to the table.
+//
+// If op is OpFUNCTION or greater, a WHERE clause term calling the function
+// with a column and a value, or a MATCH, GLOB, LIKE or REGEXP operator on a
+// column, is passed to BestIndex as a constraint with that Op. Otherwise
+// the function is only overloaded.
+//
+// Only functions that exist are looked up, so a function that has no global
+// implementation must be declared with OverloadFunction.
+// See: https://sqlite.org/vtab.html#the_xfindfunction_method
+type VTabFunctionFinder interface {
+	FindFunction(nArg int, name string) (impl any, op Op)
+}
+
+// VTabRenamer is a VTab that is notified when it is renamed with ALTER
+// TABLE. An error cancels the rename.
+// See: https://sqlite.org/vtab.html#the_xrename_method
+type VTabRenamer interface {
+	Rename(newName string) error
+}
+
+// VTabIntegrityChecker is a VTab that checks its content when PRAGMA
+// integrity_check or, with quick set, PRAGMA quick_check runs. The error
+// returned, if any, is reported as a problem by the pragma. It requires
+// SQLite 3.44.0 or later.
+// See: https://sqlite.org/vtab.html#the_xintegrity_method
+type VTabIntegrityChecker interface {
+	Integrity(schema, table string, quick bool) error
+}
+
 // VTabCursor describes cursors that point into the virtual table and are used
 // to loop through the virtual table. See: http://sqlite.org/c3ref/vtab_cursor.html
 type VTabCursor interface {
@@ -735,22 +1359,105 @@ func (c *SQLiteConn) DeclareVTab(sql string) error {
 // CreateModule registers a virtual table implementation.
 // See: http://sqlite.org/c3ref/create_module.html
 func (c *SQLiteConn) CreateModule(moduleName string, module Module) error {
+	if module == nil {
+		return fmt.Errorf("sqlite3: CreateModule requires a non-nil module")
+	}
 	mname := C.CString(moduleName)
 	defer C.free(unsafe.Pointer(mname))
-	udm := sqliteModule{c, moduleName, module}
-	switch module.(type) {
-	case EponymousOnlyModule:
-		rv := C._sqlite3_create_module_eponymous_only(c.db, mname, C.uintptr_t(uintptr(newHandle(c, &udm))))
-		if rv != C.SQLITE_OK {
-			return c.lastError()
+	var eponymousOnly C.int
+	if _, ok := module.(EponymousOnlyModule); ok {
+		eponymousOnly = 1
+	}
+	udm := sqliteModule{c: c, name: moduleName, module: module, slot: -1}
+	udm.cmod = C._sqlite3_module_copy(eponymousOnly)
+	if udm.cmod == nil {
+		return ErrNomem
+	}
+	if _, ok := module.(ShadowNameModule); ok {
+		if err := udm.useShadowName(); err != nil {
+			C.sqlite3_free(unsafe.Pointer(udm.cmod))
+			return err
+		}
+	}
+	// SQLite calls goMDestroy, which frees udm.cmod, even if this fails.
+	rv := C._sqlite3_create_module_with(c.db, mname, udm.cmod, C.uintptr_t(uintptr(newHandle(c, &udm))))
+	if rv != C.SQLITE_OK {
+		return c.lastError()
+	}
+	return nil
+}
+
+// Options for VTabConfig.
+// See: https://sqlite.org/c3ref/c_vtab_constraint_support.html
+const (
+	SQLITE_VTAB_CONSTRAINT_SUPPORT = C.SQLITE_VTAB_CONSTRAINT_SUPPORT
+	SQLITE_VTAB_INNOCUOUS          = C.SQLITE_VTAB_INNOCUOUS
+	SQLITE_VTAB_DIRECTONLY         = C.SQLITE_VTAB_DIRECTONLY
+	SQLITE_VTAB_USES_ALL_SCHEMAS   = 4
+)
+
+// Conflict resolution modes returned by VTabOnConflict, along with
+// SQLITE_IGNORE.
+const (
+	SQLITE_ROLLBACK = C.SQLITE_ROLLBACK
+	SQLITE_ABORT    = C.SQLITE_ABORT
+	SQLITE_FAIL     = C.SQLITE_FAIL
+	SQLITE_REPLACE  = C.SQLITE_REPLACE
+)
+
+// VTabConfig configures the virtual table being declared. It may only be
+// called from the Create or Connect method of a Module. The
+// SQLITE_VTAB_CONSTRAINT_SUPPORT option takes a single argument, which
+// enables constraint support when non-zero; the other options take none.
+// See: https://sqlite.org/c3ref/vtab_config.html
+func (c *SQLiteConn) VTabConfig(op int, args ...int) error {
+	var rv C.int
+	switch op {
+	case SQLITE_VTAB_CONSTRAINT_SUPPORT:
+		if len(args) != 1 {
+			return fmt.Errorf("vtab config option %d takes one argument, got %d", op, len(args))
 		}
-		return nil
-	case Module:
-		rv := C._sqlite3_create_module(c.db, mname, C.uintptr_t(uintptr(newHandle(c, &udm))))
-		if rv != C.SQLITE_OK {
-			return c.lastError()
+		rv = C._sqlite3_vtab_config_int(c.db, C.int(op), C.int(args[0]))
+	default:
+		if len(args) != 0 {
+			return fmt.Errorf("vtab config option %d takes no arguments, got %d", op, len(args))
 		}
-		return nil
+		rv = C._sqlite3_vtab_config(c.db, C.int(op))
+	}
+	if rv != C.SQLITE_OK {
+		return Error{Code: ErrNo(rv)}
+	}
+	return nil
+}
+
+// VTabOnConflict returns the conflict resolution mode of the statement
+// changing a virtual table: one of SQLITE_ROLLBACK, SQLITE_ABORT,
+// SQLITE_FAIL, SQLITE_IGNORE or SQLITE_REPLACE. It may only be called from
+// the Insert and Update methods of a VTabUpdater.
+// See: https://sqlite.org/c3ref/vtab_on_conflict.html
+func (c *SQLiteConn) VTabOnConflict() int {
+	return int(C.sqlite3_vtab_on_conflict(c.db))
+}
+
+// NoChange reports whether the column being read by VTabCursor.Column is
+// fetched only for an UPDATE that does not change it. The method may then
+// return without setting a result, and the column is passed as Unchanged to
+// VTabUpdater.Update.
+// See: https://sqlite.org/c3ref/vtab_nochange.html
+func (c *SQLiteContext) NoChange() bool {
+	return C.sqlite3_vtab_nochange((*C.sqlite3_context)(c)) != 0
+}
+
+// OverloadFunction declares a function named name taking nArg arguments, so
+// that a VTabFunctionFinder can overload it. If no such function exists, one
+// that fails when called is registered.
+// See: https://sqlite.org/c3ref/overload_function.html
+func (c *SQLiteConn) OverloadFunction(name string, nArg int) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	rv := C.sqlite3_overload_function(c.db, cname, C.int(nArg))
+	if rv != C.SQLITE_OK {
+		return c.lastError()
 	}
-	return fmt.Errorf("sqlite3: CreateModule requires a non-nil module")
+	return nil
 }
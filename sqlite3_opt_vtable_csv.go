@@ -0,0 +1,531 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_vtable || vtable
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVModule is a virtual table module reading RFC 4180 CSV data, modelled
+// on SQLite's csv extension. Register it under a name of your choice,
+// typically from SQLiteDriver.ConnectHook:
+//
+//	conn.CreateModule("csv", sqlite3.CSVModule{})
+//
+// and create tables with
+//
+//	CREATE VIRTUAL TABLE t USING csv(filename='data.csv', header=yes)
+//
+// The arguments are:
+//
+//	filename=PATH  the file to read
+//	data=TEXT      the CSV content itself, instead of filename
+//	header=BOOL    whether the first row holds the column names
+//	columns=N      the number of columns, instead of the widest row
+//	schema=SQL     a CREATE TABLE statement declaring the columns
+//
+// Exactly one of filename and data must be given. Without a header, columns
+// are named c0, c1 and so on. Unless schema is given, the type of each
+// column is inferred from its values: INTEGER if all of its non-empty values
+// are integers, REAL if they are all numbers and TEXT otherwise. Empty
+// values of INTEGER and REAL columns are NULL. With a schema, every value is
+// returned as TEXT.
+//
+// The table is read-only and its rowid is the number of the data row,
+// starting at 1. Constraints on the rowid seek directly to the matching
+// rows. The file is read once when the table is connected to index its rows
+// and is kept open until the table is disconnected; it must not change in
+// the meantime.
+type CSVModule struct{}
+
+// Create implements Module.
+func (m CSVModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Connect(c, args)
+}
+
+// Connect implements Module.
+func (m CSVModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	opts, err := parseCSVArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	vt := &csvVTab{}
+	if opts.filename != "" {
+		f, err := os.Open(opts.filename)
+		if err != nil {
+			return nil, fmt.Errorf("csv: %v", err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("csv: %v", err)
+		}
+		vt.src, vt.size, vt.closer = f, fi.Size(), f
+	} else {
+		r := strings.NewReader(opts.data)
+		vt.src, vt.size = r, r.Size()
+	}
+	schema, err := vt.scan(opts)
+	if err == nil {
+		err = c.DeclareVTab(schema)
+	}
+	if err != nil {
+		vt.Disconnect()
+		return nil, err
+	}
+	return vt, nil
+}
+
+// DestroyModule implements Module.
+func (m CSVModule) DestroyModule() {}
+
+type csvOptions struct {
+	filename string
+	data     string
+	hasData  bool
+	header   bool
+	columns  int
+	schema   string
+}
+
+// parseCSVArgs parses the key=value arguments following the module,
+// database and table names.
+func parseCSVArgs(args []string) (*csvOptions, error) {
+	opts := &csvOptions{columns: -1}
+	seen := make(map[string]bool)
+	for _, arg := range args[min(3, len(args)):] {
+		key, val, ok := strings.Cut(arg, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok {
+			return nil, fmt.Errorf("csv: parameter %q is not of the form key=value", strings.TrimSpace(arg))
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("csv: more than one %q parameter", key)
+		}
+		seen[key] = true
+		val = csvDequote(strings.TrimSpace(val))
+		switch key {
+		case "filename":
+			opts.filename = val
+		case "data":
+			opts.data, opts.hasData = val, true
+		case "header":
+			switch strings.ToLower(val) {
+			case "0", "no", "false", "off":
+				opts.header = false
+			case "1", "yes", "true", "on":
+				opts.header = true
+			default:
+				return nil, fmt.Errorf("csv: invalid header: %v, expecting boolean value of '0 1 false true no yes off on'", val)
+			}
+		case "columns":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("csv: invalid columns: %v, expecting a positive integer", val)
+			}
+			opts.columns = n
+		case "schema":
+			opts.schema = val
+		default:
+			return nil, fmt.Errorf("csv: unknown parameter %q", key)
+		}
+	}
+	if (opts.filename == "") == !opts.hasData {
+		return nil, errors.New("csv: exactly one of filename and data must be given")
+	}
+	return opts, nil
+}
+
+// csvDequote removes the quotes around an SQL string literal or quoted
+// identifier.
+func csvDequote(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+	q := s[0]
+	if (q != '\'' && q != '"') || s[len(s)-1] != q {
+		return s
+	}
+	return strings.ReplaceAll(s[1:len(s)-1], string([]byte{q, q}), string(q))
+}
+
+// csvType is the inferred type of a column.
+type csvType int
+
+const (
+	csvInteger csvType = iota
+	csvReal
+	csvText
+)
+
+var csvTypeNames = [...]string{csvInteger: "INTEGER", csvReal: "REAL", csvText: "TEXT"}
+
+type csvVTab struct {
+	src    io.ReaderAt
+	size   int64
+	closer io.Closer
+	// offsets holds the offset of each data row in src, followed by the
+	// end of the last one.
+	offsets []int64
+	// types holds the inferred type of each column, or nil if the table
+	// was declared with a schema.
+	types []csvType
+	ncol  int
+}
+
+func (vt *csvVTab) newReader(offset int64) *csv.Reader {
+	r := csv.NewReader(io.NewSectionReader(vt.src, offset, vt.size-offset))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	return r
+}
+
+// scan reads the whole input once to find the offsets of the rows, the
+// number of columns and their types, and returns the schema to declare.
+func (vt *csvVTab) scan(opts *csvOptions) (string, error) {
+	r := vt.newReader(0)
+	var names []string
+	var types []csvType
+	var empty []bool
+	ncol := 0
+	for row := 0; ; row++ {
+		offset := r.InputOffset()
+		rec, err := r.Read()
+		if err == io.EOF {
+			vt.offsets = append(vt.offsets, offset)
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("csv: %v", err)
+		}
+		if row == 0 && opts.header {
+			names = append(names, rec...)
+			ncol = len(rec)
+			continue
+		}
+		vt.offsets = append(vt.offsets, offset)
+		ncol = max(ncol, len(rec))
+		if opts.schema != "" {
+			continue
+		}
+		for i, v := range rec {
+			if i >= len(types) {
+				types = append(types, csvInteger)
+				empty = append(empty, true)
+			}
+			if v == "" {
+				continue
+			}
+			empty[i] = false
+			if types[i] == csvInteger && !csvIsInteger(v) {
+				types[i] = csvReal
+			}
+			if types[i] == csvReal && !csvIsReal(v) {
+				types[i] = csvText
+			}
+		}
+	}
+	if opts.columns > 0 {
+		ncol = opts.columns
+	}
+	if ncol == 0 {
+		return "", errors.New("csv: no columns")
+	}
+	vt.ncol = ncol
+	if opts.schema != "" {
+		return opts.schema, nil
+	}
+
+	vt.types = make([]csvType, ncol)
+	var b strings.Builder
+	b.WriteString("CREATE TABLE x(")
+	for i := 0; i < ncol; i++ {
+		vt.types[i] = csvText
+		if i < len(types) && !empty[i] {
+			vt.types[i] = types[i]
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		name := fmt.Sprintf("c%d", i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		fmt.Fprintf(&b, "\"%s\" %s", strings.ReplaceAll(name, `"`, `""`), csvTypeNames[vt.types[i]])
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+func csvIsInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// csvIsReal reports whether s is a decimal number. Unlike strconv.ParseFloat
+// alone, it rejects Inf, NaN and hexadecimal notation.
+func csvIsReal(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9', c == '.', c == 'e', c == 'E', c == '+', c == '-':
+		default:
+			return false
+		}
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// rowCount returns the number of data rows.
+func (vt *csvVTab) rowCount() int64 {
+	return int64(len(vt.offsets) - 1)
+}
+
+// BestIndex implements VTab. Comparisons of the rowid with =, <, <=, > and
+// >= are passed to Filter, which only reads the rows in range. The idxStr
+// lists the operators of the passed constraints in order.
+func (vt *csvVTab) BestIndex(csts []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	used := make([]bool, len(csts))
+	var ops []byte
+	rows := float64(vt.rowCount())
+	for i, c := range csts {
+		if !c.Usable || c.Column != -1 {
+			continue
+		}
+		switch c.Op {
+		case OpEQ:
+			ops = append(ops, '=')
+			rows = 1
+		case OpGT, OpGE:
+			ops = append(ops, '>')
+			rows /= 2
+		case OpLT, OpLE:
+			ops = append(ops, '<')
+			rows /= 2
+		default:
+			continue
+		}
+		if c.Op == OpGE || c.Op == OpLE {
+			ops = append(ops, '=')
+		}
+		used[i] = true
+	}
+	rows = max(rows, 1)
+	idxNum := 0
+	if len(ops) > 0 {
+		idxNum = 1
+	}
+	return &IndexResult{
+		Used:           used,
+		IdxNum:         idxNum,
+		IdxStr:         string(ops),
+		AlreadyOrdered: len(ob) == 1 && ob[0].Column == -1 && !ob[0].Desc,
+		EstimatedCost:  rows,
+		EstimatedRows:  rows,
+	}, nil
+}
+
+// Disconnect implements VTab.
+func (vt *csvVTab) Disconnect() error {
+	if vt.closer != nil {
+		return vt.closer.Close()
+	}
+	return nil
+}
+
+// Destroy implements VTab.
+func (vt *csvVTab) Destroy() error {
+	return vt.Disconnect()
+}
+
+// Open implements VTab.
+func (vt *csvVTab) Open() (VTabCursor, error) {
+	return &csvCursor{vt: vt}, nil
+}
+
+type csvCursor struct {
+	vt  *csvVTab
+	r   *csv.Reader
+	rec []string
+	// rowid is the current row and last the final row to return.
+	rowid, last int64
+}
+
+// Close implements VTabCursor.
+func (vc *csvCursor) Close() error {
+	return nil
+}
+
+// Filter implements VTabCursor.
+func (vc *csvCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	lo, hi := int64(1), vc.vt.rowCount()
+	for _, v := range vals {
+		var op string
+		op, idxStr = csvNextOp(idxStr)
+		lo, hi = csvBound(op, v, lo, hi)
+	}
+	vc.rowid, vc.last = lo-1, hi
+	vc.r = nil
+	if lo <= hi {
+		vc.r = vc.vt.newReader(vc.vt.offsets[lo-1])
+	}
+	return vc.Next()
+}
+
+// csvBound narrows the rowid range [lo, hi] by the constraint "rowid op v".
+// The constraints are omitted from SQLite's own checks, so the comparison
+// follows SQLite's: NULL matches nothing, text that looks like a number is
+// compared as that number, and other text and blobs sort after all numbers.
+// An empty range is returned as [1, 0].
+func csvBound(op string, v any, lo, hi int64) (int64, int64) {
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			v = n
+		} else if csvIsReal(s) {
+			v, _ = strconv.ParseFloat(s, 64)
+		}
+	}
+	var n int64
+	switch v := v.(type) {
+	case int64:
+		n = v
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return 1, 0
+		case v >= math.MaxInt64:
+			if op == "<" || op == "<=" {
+				return lo, hi
+			}
+			return 1, 0
+		case v < math.MinInt64:
+			if op == ">" || op == ">=" {
+				return lo, hi
+			}
+			return 1, 0
+		}
+		fl, ce := int64(math.Floor(v)), int64(math.Ceil(v))
+		switch op {
+		case "=":
+			if fl != ce {
+				return 1, 0
+			}
+			n = fl
+		case ">":
+			n = fl
+		case ">=":
+			n = ce
+		case "<":
+			n = ce
+		case "<=":
+			n = fl
+		}
+	case nil:
+		return 1, 0
+	default:
+		// Text and blobs are greater than any rowid.
+		if op == "<" || op == "<=" {
+			return lo, hi
+		}
+		return 1, 0
+	}
+	switch op {
+	case "=":
+		return max(lo, n), min(hi, n)
+	case ">":
+		if n == math.MaxInt64 {
+			return 1, 0
+		}
+		return max(lo, n+1), hi
+	case ">=":
+		return max(lo, n), hi
+	case "<":
+		if n == math.MinInt64 {
+			return 1, 0
+		}
+		return lo, min(hi, n-1)
+	case "<=":
+		return lo, min(hi, n)
+	}
+	return lo, hi
+}
+
+// csvNextOp splits the first operator off the idxStr built by BestIndex.
+func csvNextOp(ops string) (string, string) {
+	if len(ops) > 1 && ops[1] == '=' {
+		return ops[:2], ops[2:]
+	}
+	return ops[:min(1, len(ops))], ops[min(1, len(ops)):]
+}
+
+// Next implements VTabCursor.
+func (vc *csvCursor) Next() error {
+	vc.rowid++
+	if vc.rowid > vc.last {
+		return nil
+	}
+	rec, err := vc.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("csv: row %d: %v", vc.rowid, err)
+	}
+	vc.rec = rec
+	return nil
+}
+
+// EOF implements VTabCursor.
+func (vc *csvCursor) EOF() bool {
+	return vc.rowid > vc.last
+}
+
+// Column implements VTabCursor.
+func (vc *csvCursor) Column(c *SQLiteContext, col int) error {
+	if col >= vc.vt.ncol || col >= len(vc.rec) {
+		c.ResultNull()
+		return nil
+	}
+	v := vc.rec[col]
+	if vc.vt.types == nil {
+		c.ResultText(v)
+		return nil
+	}
+	switch vc.vt.types[col] {
+	case csvInteger:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.ResultInt64(n)
+			return nil
+		}
+	case csvReal:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			c.ResultDouble(f)
+			return nil
+		}
+	default:
+		c.ResultText(v)
+		return nil
+	}
+	// Only empty values fail to parse in a numeric column.
+	c.ResultNull()
+	return nil
+}
+
+// Rowid implements VTabCursor.
+func (vc *csvCursor) Rowid() (int64, error) {
+	return vc.rowid, nil
+}
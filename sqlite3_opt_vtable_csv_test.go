@@ -0,0 +1,176 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_vtable || vtable
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVModule(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.csv")
+	var b strings.Builder
+	b.WriteString("id,name,score,note\n")
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&b, "%d,\"name, %d\",%d.5,\n", i, i, i)
+	}
+	if err := os.WriteFile(filename, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sql.Register("sqlite3_TestCSVModule", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			return conn.CreateModule("csv", CSVModule{})
+		},
+	})
+	db, err := sql.Open("sqlite3_TestCSVModule", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE f USING csv(filename='%s', header=yes)", filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info('f')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, name+" "+typ)
+	}
+	rows.Close()
+	if got := strings.Join(types, ", "); got != "id INTEGER, name TEXT, score REAL, note TEXT" {
+		t.Errorf("unexpected columns: %s", got)
+	}
+
+	var count, sum int64
+	var total float64
+	if err := db.QueryRow("SELECT count(*), sum(id), sum(score) FROM f").Scan(&count, &sum, &total); err != nil {
+		t.Fatal(err)
+	}
+	if count != 100 || sum != 5050 || total != 5100 {
+		t.Errorf("unexpected aggregates: %d %d %v", count, sum, total)
+	}
+
+	for _, tt := range []struct {
+		where string
+		count int64
+		min   int64
+	}{
+		{"rowid = 42", 1, 42},
+		{"rowid = '42'", 1, 42},
+		{"rowid = 42.5", 0, 0},
+		{"rowid = 0", 0, 0},
+		{"rowid = 101", 0, 0},
+		{"rowid = NULL", 0, 0},
+		{"rowid > 90", 10, 91},
+		{"rowid >= 90.5", 10, 91},
+		{"rowid < 3", 2, 1},
+		{"rowid <= 2.5", 2, 1},
+		{"rowid between 10 and 19", 10, 10},
+		{"rowid > 5 and rowid < 5", 0, 0},
+		{"rowid < 'abc'", 100, 1},
+		{"rowid > 'abc'", 0, 0},
+		{"rowid >= -5 and rowid <= 1e300", 100, 1},
+	} {
+		var n int64
+		var lo sql.NullInt64
+		err := db.QueryRow("SELECT count(*), min(id) FROM f WHERE "+tt.where).Scan(&n, &lo)
+		if err != nil {
+			t.Fatal(tt.where, err)
+		}
+		if n != tt.count || lo.Int64 != tt.min {
+			t.Errorf("%s: expected %d rows from %d, got %d from %d", tt.where, tt.count, tt.min, n, lo.Int64)
+		}
+	}
+
+	var name string
+	var note sql.NullString
+	if err := db.QueryRow("SELECT name, note FROM f WHERE rowid = 7").Scan(&name, &note); err != nil {
+		t.Fatal(err)
+	}
+	if name != "name, 7" || !note.Valid || note.String != "" {
+		t.Errorf("unexpected row: %q %v", name, note)
+	}
+
+	// Inline data without a header, with ragged rows and a fixed number of
+	// columns.
+	_, err = db.Exec(`CREATE VIRTUAL TABLE d USING csv(data='1,x
+2,,extra
+3', columns=2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = db.Query("SELECT rowid, c0, c1, typeof(c1) FROM d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var rowid, c0 int64
+		var c1 sql.NullString
+		var typ string
+		if err := rows.Scan(&rowid, &c0, &c1, &typ); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d:%d:%s:%s", rowid, c0, c1.String, typ))
+	}
+	rows.Close()
+	if s := strings.Join(got, " "); s != "1:1:x:text 2:2::text 3:3::null" {
+		t.Errorf("unexpected rows: %s", s)
+	}
+
+	// An explicit schema returns text values.
+	_, err = db.Exec(`CREATE VIRTUAL TABLE s USING csv(data='1,2', schema='CREATE TABLE x(a INT, b INT)')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, ta string
+	if err := db.QueryRow("SELECT a, typeof(b) FROM s").Scan(&a, &ta); err != nil {
+		t.Fatal(err)
+	}
+	if a != "1" || ta != "text" {
+		t.Errorf("unexpected values: %q %q", a, ta)
+	}
+
+	for _, args := range []string{
+		"",
+		"data='1', filename='x.csv'",
+		"data='1', data='2'",
+		"data='1', header=maybe",
+		"data='1', columns=0",
+		"data='1', bogus=1",
+		"data='1', header",
+		"data=''",
+		"filename='" + filepath.Join(dir, "missing.csv") + "'",
+	} {
+		if _, err := db.Exec("CREATE VIRTUAL TABLE bad USING csv(" + args + ")"); err == nil {
+			t.Errorf("csv(%s): expected error", args)
+			db.Exec("DROP TABLE bad")
+		}
+	}
+
+	if _, err := db.Exec("DROP TABLE f"); err != nil {
+		t.Fatal(err)
+	}
+}
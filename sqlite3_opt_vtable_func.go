@@ -0,0 +1,217 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23 && (sqlite_vtable || vtable)
+// +build go1.23
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RegisterTableFunc registers a table-valued function named name, an
+// eponymous-only virtual table whose rows are produced by fn.
+//
+// The table has the given columns, each a column definition such as
+// "value" or "value INTEGER", followed by a hidden column for each of
+// hiddenParams. The hidden columns are the arguments of the function: in
+//
+//	SELECT value FROM name(1, 10)
+//
+// or the equivalent WHERE constraints on the hidden columns, fn is called
+// with the values given for them, in order, and nil for those that are
+// missing. Reading a hidden column returns its argument.
+//
+// Each row yielded by fn holds a value for each of the columns, of a type
+// supported by SliceModule, and rows are read from the iterator only as the
+// statement steps through them. An error yielded by fn fails the statement.
+func (c *SQLiteConn) RegisterTableFunc(name string, columns, hiddenParams []string, fn func(args []any) iter.Seq2[[]any, error]) error {
+	if len(columns) == 0 {
+		return errors.New("sqlite3: a table function needs at least one column")
+	}
+	if fn == nil {
+		return errors.New("sqlite3: table function is nil")
+	}
+	return c.CreateModule(name, &tableFuncModule{
+		columns: columns,
+		params:  hiddenParams,
+		fn:      fn,
+	})
+}
+
+type tableFuncModule struct {
+	columns []string
+	params  []string
+	fn      func(args []any) iter.Seq2[[]any, error]
+}
+
+// EponymousOnlyModule implements EponymousOnlyModule.
+func (m *tableFuncModule) EponymousOnlyModule() {}
+
+// Create implements Module.
+func (m *tableFuncModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Connect(c, args)
+}
+
+// Connect implements Module.
+func (m *tableFuncModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	cols := append([]string(nil), m.columns...)
+	for _, p := range m.params {
+		cols = append(cols, p+" HIDDEN")
+	}
+	if err := c.DeclareVTab("CREATE TABLE x(" + strings.Join(cols, ", ") + ")"); err != nil {
+		return nil, err
+	}
+	return &tableFuncVTab{m}, nil
+}
+
+// DestroyModule implements Module.
+func (m *tableFuncModule) DestroyModule() {}
+
+type tableFuncVTab struct {
+	m *tableFuncModule
+}
+
+// BestIndex implements VTab. An equality constraint on a hidden column
+// passes its value to the function. The positions of the arguments in the
+// values passed to Filter are listed in IdxStr.
+func (vt *tableFuncVTab) BestIndex(cst []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	used := make([]bool, len(cst))
+	given := make([]bool, len(vt.m.params))
+	unusable := make([]bool, len(vt.m.params))
+	var idx []string
+	for i, c := range cst {
+		p := c.Column - len(vt.m.columns)
+		if p < 0 || c.Op != OpEQ || given[p] {
+			continue
+		}
+		if !c.Usable {
+			unusable[p] = true
+			continue
+		}
+		used[i] = true
+		given[p] = true
+		idx = append(idx, strconv.Itoa(p))
+	}
+	// An argument that the plan cannot pass is only known when another
+	// table is read first, so make such a plan expensive.
+	cost := 1.0
+	for p := range given {
+		if unusable[p] && !given[p] {
+			cost *= 1e6
+		}
+	}
+	return &IndexResult{
+		Used:          used,
+		IdxStr:        strings.Join(idx, ","),
+		EstimatedCost: cost,
+	}, nil
+}
+
+// Open implements VTab.
+func (vt *tableFuncVTab) Open() (VTabCursor, error) {
+	return &tableFuncCursor{vt: vt}, nil
+}
+
+// Disconnect implements VTab.
+func (vt *tableFuncVTab) Disconnect() error { return nil }
+
+// Destroy implements VTab.
+func (vt *tableFuncVTab) Destroy() error { return nil }
+
+type tableFuncCursor struct {
+	vt    *tableFuncVTab
+	args  []any
+	next  func() ([]any, error, bool)
+	stop  func()
+	row   []any
+	rowid int64
+	eof   bool
+}
+
+// Filter implements VTabCursor.
+func (vc *tableFuncCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	vc.Close()
+	vc.args = make([]any, len(vc.vt.m.params))
+	if idxStr != "" {
+		for i, s := range strings.Split(idxStr, ",") {
+			p, err := strconv.Atoi(s)
+			if err != nil || p >= len(vc.args) || i >= len(vals) {
+				return fmt.Errorf("sqlite3: invalid table function plan %q", idxStr)
+			}
+			vc.args[p] = vals[i]
+		}
+	}
+	vc.next, vc.stop = iter.Pull2(vc.vt.m.fn(vc.args))
+	vc.rowid = 0
+	vc.eof = false
+	return vc.Next()
+}
+
+// Next implements VTabCursor.
+func (vc *tableFuncCursor) Next() error {
+	row, err, ok := vc.next()
+	if !ok {
+		vc.row = nil
+		vc.eof = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(row) != len(vc.vt.m.columns) {
+		return fmt.Errorf("sqlite3: table function returned %d values for %d columns", len(row), len(vc.vt.m.columns))
+	}
+	vc.row = row
+	vc.rowid++
+	return nil
+}
+
+// EOF implements VTabCursor.
+func (vc *tableFuncCursor) EOF() bool {
+	return vc.eof
+}
+
+// Column implements VTabCursor.
+func (vc *tableFuncCursor) Column(c *SQLiteContext, col int) error {
+	var v any
+	if col < len(vc.row) {
+		v = vc.row[col]
+	} else {
+		v = vc.args[col-len(vc.vt.m.columns)]
+	}
+	if v == nil {
+		c.ResultNull()
+		return nil
+	}
+	val, err := sliceValue(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+	sliceResult(c, val)
+	return nil
+}
+
+// Rowid implements VTabCursor.
+func (vc *tableFuncCursor) Rowid() (int64, error) {
+	return vc.rowid, nil
+}
+
+// Close implements VTabCursor. It stops the iterator of the function if
+// the statement did not read all of its rows.
+func (vc *tableFuncCursor) Close() error {
+	if vc.stop != nil {
+		vc.stop()
+		vc.next, vc.stop = nil, nil
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23 && (sqlite_vtable || vtable)
+// +build go1.23
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"database/sql"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+)
+
+func TestRegisterTableFunc(t *testing.T) {
+	var pulled, stopped int
+	series := func(args []any) iter.Seq2[[]any, error] {
+		return func(yield func([]any, error) bool) {
+			defer func() { stopped++ }()
+			start, ok := args[0].(int64)
+			if !ok && args[0] != nil {
+				yield(nil, errors.New("start must be an integer"))
+				return
+			}
+			stop, bounded := args[1].(int64)
+			for i := start; !bounded || i <= stop; i++ {
+				pulled++
+				if !yield([]any{i, i%2 == 0}, nil) {
+					return
+				}
+			}
+		}
+	}
+	sql.Register("sqlite3_TestRegisterTableFunc", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			if err := conn.RegisterTableFunc("series", []string{"value INTEGER", "even"}, []string{"start", "stop"}, series); err != nil {
+				return err
+			}
+			return conn.RegisterTableFunc("bad", []string{"a", "b"}, nil, func(args []any) iter.Seq2[[]any, error] {
+				return func(yield func([]any, error) bool) {
+					yield([]any{1}, nil)
+				}
+			})
+		},
+	})
+	db, err := sql.Open("sqlite3_TestRegisterTableFunc", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, tt := range []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT group_concat(value) FROM series(1, 5)", "1,2,3,4,5"},
+		{"SELECT group_concat(value || even) FROM series(1, 3)", "10,21,30"},
+		{"SELECT group_concat(value || '/' || start || '/' || stop) FROM series WHERE stop = 4 AND start = 3", "3/3/4,4/3/4"},
+		{"SELECT group_concat(value) FROM series(2, 1)", ""},
+		{"SELECT group_concat(value) FROM (SELECT value FROM series(7) LIMIT 3)", "7,8,9"},
+		{"SELECT group_concat(value) FROM series WHERE start = 1 AND stop = 9 AND value > 7", "8,9"},
+		{"SELECT group_concat(t.x || ':' || s.value) FROM (SELECT 1 AS x UNION ALL SELECT 2) AS t, series(t.x, 2) AS s", "1:1,1:2,2:2"},
+	} {
+		var s sql.NullString
+		if err := db.QueryRow(tt.query).Scan(&s); err != nil {
+			t.Fatal(tt.query, err)
+		}
+		if s.String != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.expected, s.String)
+		}
+	}
+
+	// Rows are read lazily and the iterator is stopped when the statement
+	// ends early.
+	pulled, stopped = 0, 0
+	var v int64
+	if err := db.QueryRow("SELECT value FROM series(100) LIMIT 1").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 100 || pulled > 2 || stopped != 1 {
+		t.Errorf("expected one row to be read, got %d rows, %d pulled, %d stopped", v, pulled, stopped)
+	}
+
+	if _, err := db.Exec("SELECT * FROM series('x')"); err == nil || !strings.Contains(err.Error(), "start must be an integer") {
+		t.Errorf("expected an error from the function, got %v", err)
+	}
+	if _, err := db.Exec("SELECT * FROM bad"); err == nil || !strings.Contains(err.Error(), "1 values for 2 columns") {
+		t.Errorf("expected an error for the row, got %v", err)
+	}
+	if _, err := db.Exec("CREATE VIRTUAL TABLE s USING series"); err == nil {
+		t.Error("expected error creating a table function")
+	}
+}
@@ -0,0 +1,755 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_vtable || vtable
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SliceModule returns a read-only virtual table module over the slice
+// returned by rows, which is called each time the table is scanned. T must
+// be a struct or a pointer to a struct; each of its exported fields becomes
+// a column, including the fields of embedded structs. The struct tag
+//
+//	sqlite:"name,key"
+//
+// sets the name of the column, and the key option marks a field whose
+// equality constraints are evaluated by the module instead of SQLite. A
+// field tagged sqlite:"-" is left out.
+//
+// Fields of kind bool, int, uint, float and string, as well as []byte,
+// time.Time, pointers to any of those and the sql.Null types are
+// supported. Values are declared and returned as BOOLEAN, INTEGER, REAL,
+// TEXT, BLOB and DATETIME respectively; nil pointers are NULL. Other types
+// implementing driver.Valuer are declared without a type.
+//
+// The rowid of an element is its index in the slice plus one. Register the
+// module with CreateModule and create tables with
+//
+//	CREATE VIRTUAL TABLE t USING name
+func SliceModule[T any](rows func() []T) Module {
+	return &sliceModule[T]{rows: rows}
+}
+
+// UpdatableSliceModule returns a virtual table module like SliceModule over
+// the slice *rows, which additionally supports INSERT, UPDATE and DELETE.
+// Values are converted to the type of each field and the fields of
+// sql.Scanner types are set with Scan. Deleted elements are removed from
+// the slice preserving the order of the others. Rowids are assigned when
+// elements are inserted and stay stable as long as the slice is only
+// modified through SQL; changing its length from Go renumbers the elements
+// from one. Inserting an explicit rowid or changing one is not supported.
+//
+// The slice must not be modified from Go while a statement uses the table.
+// Connections that share the module serialize their changes. A scan of the
+// table sees the elements present when it started, including any updated
+// in place, but not elements inserted later.
+func UpdatableSliceModule[T any](rows *[]T) Module {
+	return &sliceModule[T]{rows: func() []T { return *rows }, ptr: rows}
+}
+
+type sliceModule[T any] struct {
+	rows func() []T
+	ptr  *[]T
+
+	// mu guards the slice and ids of an updatable module.
+	mu sync.Mutex
+	// ids holds the rowid of each element of *ptr, in increasing order.
+	ids  []int64
+	next int64
+}
+
+// Create implements Module.
+func (m *sliceModule[T]) Create(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Connect(c, args)
+}
+
+// Connect implements Module.
+func (m *sliceModule[T]) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	if len(args) > 3 {
+		return nil, fmt.Errorf("sqlite3: virtual table %s takes no arguments", args[0])
+	}
+	cols, err := sliceColumns(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("CREATE TABLE x(")
+	for i, col := range cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "\"%s\"", strings.ReplaceAll(col.name, `"`, `""`))
+		if col.decl != "" {
+			b.WriteString(" " + col.decl)
+		}
+	}
+	b.WriteString(")")
+	if err := c.DeclareVTab(b.String()); err != nil {
+		return nil, err
+	}
+	vt := &sliceVTab[T]{m: m, cols: cols}
+	if m.ptr != nil {
+		return &sliceUpdatableVTab[T]{vt}, nil
+	}
+	return vt, nil
+}
+
+// DestroyModule implements Module.
+func (m *sliceModule[T]) DestroyModule() {}
+
+// snapshot returns the current slice and, for an updatable module, the
+// rowids of its elements. m.mu must be held for an updatable module.
+func (m *sliceModule[T]) snapshot() ([]T, []int64) {
+	rows := m.rows()
+	if m.ptr == nil {
+		return rows, nil
+	}
+	if len(m.ids) != len(rows) {
+		m.ids = make([]int64, len(rows))
+		for i := range m.ids {
+			m.ids[i] = int64(i + 1)
+		}
+		m.next = int64(len(rows) + 1)
+	}
+	return rows, m.ids
+}
+
+// sliceColumn is a column derived from a struct field.
+type sliceColumn struct {
+	name  string
+	index []int
+	decl  string
+	key   bool
+}
+
+var sliceNullTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullBool{}):    "BOOLEAN",
+	reflect.TypeOf(sql.NullByte{}):    "INTEGER",
+	reflect.TypeOf(sql.NullInt16{}):   "INTEGER",
+	reflect.TypeOf(sql.NullInt32{}):   "INTEGER",
+	reflect.TypeOf(sql.NullInt64{}):   "INTEGER",
+	reflect.TypeOf(sql.NullFloat64{}): "REAL",
+	reflect.TypeOf(sql.NullString{}):  "TEXT",
+	reflect.TypeOf(sql.NullTime{}):    "DATETIME",
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// sliceColumns derives the columns of the struct type t, or of the struct
+// t points to.
+func sliceColumns(t reflect.Type) ([]sliceColumn, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlite3: slice module element type %v is not a struct", t)
+	}
+	var cols []sliceColumn
+	for _, f := range reflect.VisibleFields(t) {
+		if f.Anonymous || !f.IsExported() || sliceThroughPointer(t, f.Index) {
+			continue
+		}
+		tag := f.Tag.Get("sqlite")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		decl, ok := sliceDeclType(f.Type)
+		if !ok {
+			return nil, fmt.Errorf("sqlite3: unsupported type %v of field %s", f.Type, f.Name)
+		}
+		col := sliceColumn{name: name, index: f.Index, decl: decl}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "key":
+				col.key = true
+			case "":
+			default:
+				return nil, fmt.Errorf("sqlite3: unknown option %q in tag of field %s", opt, f.Name)
+			}
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("sqlite3: slice module element type %v has no exported fields", t)
+	}
+	return cols, nil
+}
+
+// sliceThroughPointer reports whether the field at index is promoted
+// through an embedded pointer, which may be nil.
+func sliceThroughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
+
+// sliceDeclType returns the declared type of a column holding values of
+// type t.
+func sliceDeclType(t reflect.Type) (string, bool) {
+	if decl, ok := sliceNullTypes[t]; ok {
+		return decl, true
+	}
+	if t == timeType {
+		return "DATETIME", true
+	}
+	if t.Kind() == reflect.Pointer && t.Elem().Kind() != reflect.Pointer {
+		return sliceDeclType(t.Elem())
+	}
+	if t.Implements(valuerType) || reflect.PointerTo(t).Implements(valuerType) {
+		return "", true
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "INTEGER", true
+	case reflect.Float32, reflect.Float64:
+		return "REAL", true
+	case reflect.String:
+		return "TEXT", true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB", true
+		}
+	}
+	return "", false
+}
+
+// sliceValue returns the SQLite value of field v: nil, int64, float64,
+// string or []byte.
+func sliceValue(v reflect.Value) (any, error) {
+	if v.Type() != timeType && v.Type().Implements(valuerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, nil
+		}
+		dv, err := v.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return nil, err
+		}
+		if dv == nil {
+			return nil, nil
+		}
+		return sliceValue(reflect.ValueOf(dv))
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(valuerType) {
+		return sliceValue(v.Addr())
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return sliceValue(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return float64(u), nil
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Bytes(), nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(SQLiteTimestampFormats[0]), nil
+	}
+	return nil, fmt.Errorf("sqlite3: unsupported value of type %v", v.Type())
+}
+
+// sliceSet stores the SQLite value val in field f of column col.
+func sliceSet(col *sliceColumn, f reflect.Value, val any) error {
+	if col.decl == "DATETIME" {
+		switch v := val.(type) {
+		case string:
+			val = parseTime(v, SQLiteTimestampFormats)
+		case int64:
+			val = timeEpochAuto.decode(v)
+		case float64:
+			val = julianToTime(v)
+		}
+	}
+	if s, ok := f.Addr().Interface().(sql.Scanner); ok {
+		return s.Scan(val)
+	}
+	if val == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	if f.Kind() == reflect.Pointer {
+		p := reflect.New(f.Type().Elem())
+		if err := sliceSet(col, p.Elem(), val); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	ok := false
+	switch v := val.(type) {
+	case int64:
+		ok = sliceSetInt(f, v)
+	case float64:
+		switch f.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f.SetFloat(v)
+			ok = true
+		case reflect.String:
+			f.SetString(strconv.FormatFloat(v, 'g', -1, 64))
+			ok = true
+		default:
+			if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+				ok = sliceSetInt(f, int64(v))
+			}
+		}
+	case string:
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(v)
+			ok = true
+		case reflect.Slice:
+			f.SetBytes([]byte(v))
+			ok = true
+		case reflect.Bool:
+			var b bool
+			if b, ok = sliceParseBool(v); ok {
+				f.SetBool(b)
+			}
+		case reflect.Float32, reflect.Float64:
+			var x float64
+			var err error
+			if x, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				f.SetFloat(x)
+				ok = true
+			}
+		default:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				ok = sliceSetInt(f, n)
+			}
+		}
+	case []byte:
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(string(v))
+			ok = true
+		case reflect.Slice:
+			f.SetBytes(append([]byte(nil), v...))
+			ok = true
+		}
+	case time.Time:
+		if f.Type() == timeType {
+			f.Set(reflect.ValueOf(v))
+			ok = true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("sqlite3: cannot store %#v in column %s of type %v", val, col.name, f.Type())
+	}
+	return nil
+}
+
+// sliceSetInt stores n in an integer, float, bool or string field, reporting
+// false if n does not fit.
+func sliceSetInt(f reflect.Value, n int64) bool {
+	switch f.Kind() {
+	case reflect.Bool:
+		f.SetBool(n != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.OverflowInt(n) {
+			return false
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n < 0 || f.OverflowUint(uint64(n)) {
+			return false
+		}
+		f.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f.SetFloat(float64(n))
+	case reflect.String:
+		f.SetString(strconv.FormatInt(n, 10))
+	default:
+		return false
+	}
+	return true
+}
+
+func sliceParseBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "0", "no", "false", "off":
+		return false, true
+	case "1", "yes", "true", "on":
+		return true, true
+	}
+	return false, false
+}
+
+// sliceEqual reports whether the column value a equals the constraint
+// value b in the sense of SQLite's = operator, applying the affinity of
+// the column to b.
+func sliceEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	switch a := a.(type) {
+	case int64, float64:
+		if s, ok := b.(string); ok {
+			s = strings.TrimSpace(s)
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				b = n
+			} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+				b = f
+			}
+		}
+		switch b := b.(type) {
+		case int64:
+			if a, ok := a.(int64); ok {
+				return a == b
+			}
+			return a.(float64) == float64(b)
+		case float64:
+			if a, ok := a.(int64); ok {
+				return float64(a) == b && b >= math.MinInt64 && b < math.MaxInt64 && a == int64(b)
+			}
+			return a.(float64) == b
+		}
+	case string:
+		switch b := b.(type) {
+		case string:
+			return a == b
+		case int64:
+			return a == strconv.FormatInt(b, 10)
+		case float64:
+			s := strconv.FormatFloat(b, 'g', 15, 64)
+			if !strings.ContainsAny(s, ".eEnN") {
+				s += ".0"
+			}
+			return a == s
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Equal(a, b)
+		}
+	}
+	return false
+}
+
+type sliceVTab[T any] struct {
+	m    *sliceModule[T]
+	cols []sliceColumn
+}
+
+// BestIndex implements VTab. Equality constraints on key columns are
+// passed to Filter; idxStr lists their column numbers.
+func (vt *sliceVTab[T]) BestIndex(csts []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	used := make([]bool, len(csts))
+	var keys []string
+	for i, c := range csts {
+		if c.Usable && c.Op == OpEQ && c.Column >= 0 && c.Column < len(vt.cols) && vt.cols[c.Column].key {
+			used[i] = true
+			keys = append(keys, strconv.Itoa(c.Column))
+		}
+	}
+	res := &IndexResult{
+		Used:           used,
+		AlreadyOrdered: len(ob) == 1 && ob[0].Column == -1 && !ob[0].Desc,
+	}
+	if len(keys) > 0 {
+		res.IdxNum = 1
+		res.IdxStr = strings.Join(keys, ",")
+		res.EstimatedCost = 10
+		res.EstimatedRows = 1
+	}
+	return res, nil
+}
+
+// Disconnect implements VTab.
+func (vt *sliceVTab[T]) Disconnect() error {
+	return nil
+}
+
+// Destroy implements VTab.
+func (vt *sliceVTab[T]) Destroy() error {
+	return nil
+}
+
+// Open implements VTab.
+func (vt *sliceVTab[T]) Open() (VTabCursor, error) {
+	return &sliceCursor[T]{vt: vt}, nil
+}
+
+// elem returns the struct value of x, or false for a nil pointer.
+func (vt *sliceVTab[T]) elem(x *T) (reflect.Value, bool) {
+	v := reflect.ValueOf(x).Elem()
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// sliceUpdatableVTab is the table of an UpdatableSliceModule.
+type sliceUpdatableVTab[T any] struct {
+	*sliceVTab[T]
+}
+
+// find returns the index of the element with the given rowid. m.mu must be
+// held.
+func (vt *sliceUpdatableVTab[T]) find(rowid any) (int, error) {
+	_, ids := vt.m.snapshot()
+	id, _ := rowid.(int64)
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i == len(ids) || ids[i] != id {
+		return 0, fmt.Errorf("sqlite3: no row with rowid %v", rowid)
+	}
+	return i, nil
+}
+
+// set stores vals in the fields of x.
+func (vt *sliceUpdatableVTab[T]) set(x *T, vals []any) error {
+	v, ok := vt.elem(x)
+	if !ok {
+		return fmt.Errorf("sqlite3: cannot update a nil element")
+	}
+	for i := range vt.cols {
+		col := &vt.cols[i]
+		if err := sliceSet(col, v.FieldByIndex(col.index), vals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert implements VTabUpdater.
+func (vt *sliceUpdatableVTab[T]) Insert(rowid any, vals []any) (int64, error) {
+	if rowid != nil {
+		return 0, fmt.Errorf("sqlite3: explicit rowids are not supported")
+	}
+	var x T
+	if t := reflect.TypeOf(x); t.Kind() == reflect.Pointer {
+		reflect.ValueOf(&x).Elem().Set(reflect.New(t.Elem()))
+	}
+	if err := vt.set(&x, vals); err != nil {
+		return 0, err
+	}
+	m := vt.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot()
+	*m.ptr = append(*m.ptr, x)
+	id := m.next
+	m.ids = append(m.ids, id)
+	m.next++
+	return id, nil
+}
+
+// Update implements VTabUpdater.
+func (vt *sliceUpdatableVTab[T]) Update(rowid any, vals []any) error {
+	m := vt.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := vt.find(rowid)
+	if err != nil {
+		return err
+	}
+	// Update a copy, so that a conversion error leaves the element as it
+	// was.
+	x := (*m.ptr)[i]
+	if v := reflect.ValueOf(&x).Elem(); v.Kind() == reflect.Pointer && !v.IsNil() {
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(v.Elem())
+		v.Set(p)
+	}
+	if err := vt.set(&x, vals); err != nil {
+		return err
+	}
+	if v := reflect.ValueOf(&(*m.ptr)[i]).Elem(); v.Kind() == reflect.Pointer {
+		v.Elem().Set(reflect.ValueOf(x).Elem())
+	} else {
+		(*m.ptr)[i] = x
+	}
+	return nil
+}
+
+// Delete implements VTabUpdater.
+func (vt *sliceUpdatableVTab[T]) Delete(rowid any) error {
+	m := vt.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := vt.find(rowid)
+	if err != nil {
+		return err
+	}
+	// Open cursors hold the old slice and ids, so copy them rather than
+	// shifting the elements in place.
+	s := *m.ptr
+	rows := make([]T, 0, len(s)-1)
+	*m.ptr = append(append(rows, s[:i]...), s[i+1:]...)
+	ids := make([]int64, 0, len(m.ids)-1)
+	m.ids = append(append(ids, m.ids[:i]...), m.ids[i+1:]...)
+	return nil
+}
+
+type sliceCursor[T any] struct {
+	vt   *sliceVTab[T]
+	rows []T
+	ids  []int64
+	pos  int
+	// keys holds the key column numbers and values to match.
+	keys []int
+	vals []any
+}
+
+// Close implements VTabCursor.
+func (vc *sliceCursor[T]) Close() error {
+	return nil
+}
+
+// Filter implements VTabCursor.
+func (vc *sliceCursor[T]) Filter(idxNum int, idxStr string, vals []any) error {
+	m := vc.vt.m
+	if m.ptr != nil {
+		m.mu.Lock()
+		vc.rows, vc.ids = m.snapshot()
+		m.mu.Unlock()
+	} else {
+		vc.rows, vc.ids = m.snapshot()
+	}
+	vc.keys, vc.vals = vc.keys[:0], vals
+	if idxNum == 1 {
+		for _, s := range strings.Split(idxStr, ",") {
+			col, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("sqlite3: invalid index %q", idxStr)
+			}
+			vc.keys = append(vc.keys, col)
+		}
+	}
+	vc.pos = -1
+	return vc.Next()
+}
+
+// Next implements VTabCursor.
+func (vc *sliceCursor[T]) Next() error {
+	for vc.pos++; vc.pos < len(vc.rows); vc.pos++ {
+		match, err := vc.match()
+		if err != nil {
+			return err
+		}
+		if match {
+			break
+		}
+	}
+	return nil
+}
+
+// match reports whether the current element satisfies the key
+// constraints.
+func (vc *sliceCursor[T]) match() (bool, error) {
+	if len(vc.keys) == 0 {
+		return true, nil
+	}
+	v, ok := vc.vt.elem(&vc.rows[vc.pos])
+	if !ok {
+		return false, nil
+	}
+	for i, col := range vc.keys {
+		fv, err := sliceValue(v.FieldByIndex(vc.vt.cols[col].index))
+		if err != nil {
+			return false, err
+		}
+		if !sliceEqual(fv, vc.vals[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// EOF implements VTabCursor.
+func (vc *sliceCursor[T]) EOF() bool {
+	return vc.pos >= len(vc.rows)
+}
+
+// Column implements VTabCursor.
+func (vc *sliceCursor[T]) Column(c *SQLiteContext, col int) error {
+	v, ok := vc.vt.elem(&vc.rows[vc.pos])
+	if !ok {
+		c.ResultNull()
+		return nil
+	}
+	val, err := sliceValue(v.FieldByIndex(vc.vt.cols[col].index))
+	if err != nil {
+		return err
+	}
+	sliceResult(c, val)
+	return nil
+}
+
+// sliceResult sets the result of c to val, a value returned by sliceValue.
+func sliceResult(c *SQLiteContext, val any) {
+	switch val := val.(type) {
+	case nil:
+		c.ResultNull()
+	case int64:
+		c.ResultInt64(val)
+	case float64:
+		c.ResultDouble(val)
+	case string:
+		c.ResultText(val)
+	case []byte:
+		c.ResultBlob(val)
+	}
+}
+
+// Rowid implements VTabCursor.
+func (vc *sliceCursor[T]) Rowid() (int64, error) {
+	if vc.ids != nil {
+		return vc.ids[vc.pos], nil
+	}
+	return int64(vc.pos + 1), nil
+}
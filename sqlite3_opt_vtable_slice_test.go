@@ -0,0 +1,308 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite_vtable || vtable
+// +build sqlite_vtable vtable
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sliceTestBase struct {
+	Created time.Time `sqlite:"created"`
+}
+
+type sliceTestItem struct {
+	ID    int64  `sqlite:"id,key"`
+	Name  string `sqlite:"name"`
+	Price float64
+	Tags  []byte
+	Stock *int
+	Note  sql.NullString
+	Ok    bool
+	skip  int
+	Skip  string `sqlite:"-"`
+	sliceTestBase
+}
+
+func TestSliceModule(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	stock := 7
+	items := []sliceTestItem{
+		{ID: 1, Name: "apple", Price: 1.5, Stock: &stock, Ok: true, sliceTestBase: sliceTestBase{created}},
+		{ID: 2, Name: "pear", Price: 2, Tags: []byte("fruit"), Note: sql.NullString{String: "ripe", Valid: true}},
+		{ID: 3, Name: "plum", Price: 0.25},
+	}
+	var scanned int
+	mutable := []*sliceTestItem{{ID: 10, Name: "ten"}, {ID: 20, Name: "twenty"}}
+
+	sql.Register("sqlite3_TestSliceModule", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			err := conn.CreateModule("items", SliceModule(func() []sliceTestItem {
+				scanned++
+				return items
+			}))
+			if err != nil {
+				return err
+			}
+			return conn.CreateModule("mutable", UpdatableSliceModule(&mutable))
+		},
+	})
+	db, err := sql.Open("sqlite3_TestSliceModule", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE VIRTUAL TABLE items USING items"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE VIRTUAL TABLE mutable USING mutable"); err != nil {
+		t.Fatal(err)
+	}
+
+	var cols []string
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info('items')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			t.Fatal(err)
+		}
+		cols = append(cols, name+" "+typ)
+	}
+	rows.Close()
+	expected := "id INTEGER, name TEXT, Price REAL, Tags BLOB, Stock INTEGER, Note TEXT, Ok BOOLEAN, created DATETIME"
+	if got := strings.Join(cols, ", "); got != expected {
+		t.Errorf("expected columns %s, got %s", expected, got)
+	}
+
+	var (
+		rowid      int64
+		name       string
+		price      float64
+		tags       []byte
+		stockCol   sql.NullInt64
+		note       sql.NullString
+		ok         bool
+		createdCol time.Time
+	)
+	err = db.QueryRow("SELECT rowid, name, price, tags, stock, note, ok, created FROM items WHERE id = 1").
+		Scan(&rowid, &name, &price, &tags, &stockCol, &note, &ok, &createdCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowid != 1 || name != "apple" || price != 1.5 || tags != nil || stockCol.Int64 != 7 || note.Valid || !ok || !createdCol.Equal(created) {
+		t.Errorf("unexpected row: %v %v %v %v %v %v %v %v", rowid, name, price, tags, stockCol, note, ok, createdCol)
+	}
+	var typ string
+	if err := db.QueryRow("SELECT typeof(tags) || typeof(stock) || typeof(note) FROM items WHERE rowid = 2").Scan(&typ); err != nil {
+		t.Fatal(err)
+	}
+	if typ != "blobnulltext" {
+		t.Errorf("unexpected types: %s", typ)
+	}
+
+	for _, tt := range []struct {
+		where string
+		names string
+	}{
+		{"id = 2", "pear"},
+		{"id = '3'", "plum"},
+		{"id = 2.0", "pear"},
+		{"id = 2.5", ""},
+		{"id = NULL", ""},
+		{"id IN (1, 3)", "apple,plum"},
+		{"price > 1", "apple,pear"},
+	} {
+		var names sql.NullString
+		if err := db.QueryRow("SELECT group_concat(name) FROM items WHERE " + tt.where).Scan(&names); err != nil {
+			t.Fatal(tt.where, err)
+		}
+		if names.String != tt.names {
+			t.Errorf("%s: expected %q, got %q", tt.where, tt.names, names.String)
+		}
+	}
+	if scanned == 0 {
+		t.Error("expected the rows function to be called")
+	}
+
+	if _, err := db.Exec("INSERT INTO items (id, name) VALUES (4, 'fig')"); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("expected read-only error, got %v", err)
+	}
+
+	// The updatable module changes the slice.
+	if _, err := db.Exec("INSERT INTO mutable (id, name, price, stock, ok, created) VALUES (30, 'thirty', '3.5', 3, 1, '2024-03-01 12:00:00')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE mutable SET name = upper(name), note = 'x' WHERE id >= 20"); err != nil {
+		t.Fatal(err)
+	}
+	first := mutable[0]
+	if _, err := db.Exec("UPDATE mutable SET price = 1 WHERE id = 10"); err != nil {
+		t.Fatal(err)
+	}
+	if first.Price != 1 {
+		t.Error("expected the element to be updated in place")
+	}
+	if _, err := db.Exec("UPDATE mutable SET id = 'abc' WHERE id = 10"); err == nil {
+		t.Error("expected conversion error")
+	}
+	if mutable[0].ID != 10 {
+		t.Error("expected a failed update to leave the element unchanged")
+	}
+	if _, err := db.Exec("INSERT INTO mutable (rowid, id) VALUES (100, 1)"); err == nil {
+		t.Error("expected error inserting an explicit rowid")
+	}
+
+	var got []string
+	for _, it := range mutable {
+		got = append(got, fmt.Sprintf("%d:%s:%v:%s:%v", it.ID, it.Name, it.Price, it.Note.String, it.Ok))
+	}
+	if s := strings.Join(got, " "); s != "10:ten:1::false 20:TWENTY:0:x:false 30:THIRTY:3.5:x:true" {
+		t.Errorf("unexpected slice: %s", s)
+	}
+	if mutable[2].Stock == nil || *mutable[2].Stock != 3 || !mutable[2].Created.Equal(created) {
+		t.Errorf("unexpected inserted element: %+v", mutable[2])
+	}
+
+	if _, err := db.Exec("DELETE FROM mutable WHERE id IN (10, 30)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mutable) != 1 || mutable[0].ID != 20 {
+		t.Fatalf("unexpected slice after delete: %v", mutable)
+	}
+	if err := db.QueryRow("SELECT rowid FROM mutable WHERE id = 20").Scan(&rowid); err != nil {
+		t.Fatal(err)
+	}
+	if rowid != 2 {
+		t.Errorf("expected rowids to stay stable, got %d", rowid)
+	}
+}
+
+func TestSliceModuleErrors(t *testing.T) {
+	type unsupported struct {
+		M map[string]int
+	}
+	type badTag struct {
+		A int `sqlite:"a,unique"`
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(dc any) error {
+		c := dc.(*SQLiteConn)
+		for name, m := range map[string]Module{
+			"ints":        SliceModule(func() []int { return nil }),
+			"unsupported": SliceModule(func() []unsupported { return nil }),
+			"badtag":      SliceModule(func() []badTag { return nil }),
+		} {
+			if err := c.CreateModule(name, m); err != nil {
+				return err
+			}
+			if _, err := c.exec(context.Background(), "CREATE VIRTUAL TABLE t USING "+name, nil); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSliceModuleDeleteMany(t *testing.T) {
+	type row struct {
+		ID  int64 `sqlite:"id"`
+		Odd bool  `sqlite:"odd"`
+	}
+	var rows []row
+	for i := int64(1); i <= 100; i++ {
+		rows = append(rows, row{ID: i, Odd: i%2 == 1})
+	}
+	d := SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			return conn.CreateModule("rows", UpdatableSliceModule(&rows))
+		},
+	}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+	if _, err := c.Exec("CREATE VIRTUAL TABLE rows USING rows", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A scan that is open while the statement deletes keeps seeing the
+	// slice as it was when it started.
+	scan, err := c.Query("SELECT id FROM rows", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scan.Close()
+	dest := make([]driver.Value, 1)
+	if err := scan.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Exec("DELETE FROM rows WHERE NOT odd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 50 {
+		t.Errorf("expected 50 deleted rows, got %d", n)
+	}
+	seen := []int64{dest[0].(int64)}
+	for scan.Next(dest) == nil {
+		seen = append(seen, dest[0].(int64))
+	}
+	if len(seen) != 100 {
+		t.Errorf("expected the open scan to see 100 rows, got %v", seen)
+	}
+	for i, id := range seen {
+		if id != int64(i+1) {
+			t.Fatalf("unexpected id %d at %d in the open scan", id, i)
+		}
+	}
+
+	if len(rows) != 50 {
+		t.Fatalf("expected 50 rows left, got %d", len(rows))
+	}
+	for i, r := range rows {
+		if r.ID != int64(2*i+1) {
+			t.Fatalf("unexpected row %d: %+v", i, r)
+		}
+	}
+	check, err := c.Query("SELECT count(*) FROM rows WHERE rowid = id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer check.Close()
+	if err := check.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[0] != int64(50) {
+		t.Errorf("expected rowids to stay stable, got %v matching", dest[0])
+	}
+}
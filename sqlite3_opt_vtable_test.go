@@ -9,11 +9,13 @@
 package sqlite3
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -620,3 +622,828 @@ func TestCreateModuleEponymousOnly(t *testing.T) {
 		t.Logf("couldn't drop virtual table: %v", err)
 	}
 }
+
+// txModule keeps a list of values that only changes when a transaction
+// commits, and logs the transaction callbacks.
+type txModule struct {
+	committed []int64
+	work      []int64
+	saved     [][]int64
+	log       []string
+	failSync  bool
+}
+
+func (m *txModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	if err := c.DeclareVTab("CREATE TABLE x(v INTEGER)"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *txModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Create(c, args)
+}
+
+func (m *txModule) DestroyModule() {}
+
+func (m *txModule) BestIndex(cst []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	return &IndexResult{Used: make([]bool, len(cst))}, nil
+}
+
+func (m *txModule) Disconnect() error { return nil }
+
+func (m *txModule) Destroy() error { return nil }
+
+func (m *txModule) Open() (VTabCursor, error) {
+	return &txCursor{m: m}, nil
+}
+
+func (m *txModule) Insert(id any, vals []any) (int64, error) {
+	m.work = append(m.work, vals[0].(int64))
+	return int64(len(m.work)), nil
+}
+
+func (m *txModule) Update(id any, vals []any) error {
+	return errors.New("not supported")
+}
+
+func (m *txModule) Delete(id any) error {
+	return errors.New("not supported")
+}
+
+func (m *txModule) Begin() error {
+	m.log = append(m.log, "begin")
+	m.work = append([]int64(nil), m.committed...)
+	m.saved = nil
+	return nil
+}
+
+func (m *txModule) Sync() error {
+	m.log = append(m.log, "sync")
+	if m.failSync {
+		return errors.New("sync failed")
+	}
+	return nil
+}
+
+func (m *txModule) Commit() error {
+	m.log = append(m.log, "commit")
+	m.committed = m.work
+	return nil
+}
+
+func (m *txModule) Rollback() error {
+	m.log = append(m.log, "rollback")
+	m.work = append([]int64(nil), m.committed...)
+	return nil
+}
+
+func (m *txModule) Savepoint(n int) error {
+	m.log = append(m.log, fmt.Sprint("savepoint ", n))
+	m.saved = append(m.saved[:min(n, len(m.saved))], append([]int64(nil), m.work...))
+	return nil
+}
+
+func (m *txModule) Release(n int) error {
+	m.log = append(m.log, fmt.Sprint("release ", n))
+	m.saved = m.saved[:min(n, len(m.saved))]
+	return nil
+}
+
+func (m *txModule) RollbackTo(n int) error {
+	m.log = append(m.log, fmt.Sprint("rollback to ", n))
+	if n < len(m.saved) {
+		m.work = append([]int64(nil), m.saved[n]...)
+		m.saved = m.saved[:n+1]
+	}
+	return nil
+}
+
+type txCursor struct {
+	m *txModule
+	i int
+}
+
+func (c *txCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	c.i = 0
+	return nil
+}
+
+func (c *txCursor) Next() error {
+	c.i++
+	return nil
+}
+
+func (c *txCursor) EOF() bool {
+	return c.i >= len(c.m.work)
+}
+
+func (c *txCursor) Column(ctx *SQLiteContext, col int) error {
+	ctx.ResultInt64(c.m.work[c.i])
+	return nil
+}
+
+func (c *txCursor) Rowid() (int64, error) {
+	return int64(c.i + 1), nil
+}
+
+func (c *txCursor) Close() error {
+	return nil
+}
+
+func TestVTabTransaction(t *testing.T) {
+	m := &txModule{}
+	sql.Register("sqlite3_TestVTabTransaction", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			return conn.CreateModule("txtest", m)
+		},
+	})
+	db, err := sql.Open("sqlite3_TestVTabTransaction", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	exec := func(query string) {
+		t.Helper()
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	check := func(expected string) {
+		t.Helper()
+		var s sql.NullString
+		if err := db.QueryRow("SELECT group_concat(v) FROM vt").Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		if s.String != expected {
+			t.Errorf("expected values %q, got %q", expected, s.String)
+		}
+		if c := fmt.Sprint(m.committed); c != "["+strings.ReplaceAll(expected, ",", " ")+"]" {
+			t.Errorf("expected committed values %q, got %s", expected, c)
+		}
+	}
+	contains := func(events ...string) {
+		t.Helper()
+		log := strings.Join(m.log, ", ")
+		if !strings.Contains(log, strings.Join(events, ", ")) {
+			t.Errorf("expected %q in the log %q", strings.Join(events, ", "), log)
+		}
+		m.log = nil
+	}
+
+	exec("CREATE VIRTUAL TABLE vt USING txtest")
+	exec("INSERT INTO vt VALUES (1)")
+	contains("begin", "sync", "commit")
+	check("1")
+
+	exec("BEGIN")
+	exec("INSERT INTO vt VALUES (2)")
+	exec("ROLLBACK")
+	contains("begin", "rollback")
+	check("1")
+
+	exec("BEGIN")
+	exec("INSERT INTO vt VALUES (2)")
+	exec("SAVEPOINT a")
+	exec("INSERT INTO vt VALUES (3)")
+	exec("ROLLBACK TO a")
+	exec("INSERT INTO vt VALUES (4)")
+	exec("RELEASE a")
+	exec("COMMIT")
+	contains("savepoint 0", "rollback to 0")
+	check("1,2,4")
+
+	m.failSync = true
+	if _, err := db.Exec("INSERT INTO vt VALUES (5)"); err == nil || !strings.Contains(err.Error(), "sync failed") {
+		t.Errorf("expected the sync error, got %v", err)
+	}
+	m.failSync = false
+	contains("sync", "rollback")
+	check("1,2,4")
+}
+
+// extModule is a one column table of the integers 1 to 10 implementing the
+// optional VTab interfaces.
+type extModule struct {
+	c         *SQLiteConn
+	ops       []Op
+	renamed   string
+	renameErr error
+	integrity error
+}
+
+func (m *extModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	if err := c.DeclareVTab("CREATE TABLE x(v INTEGER)"); err != nil {
+		return nil, err
+	}
+	_, err := c.exec(context.Background(), fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s"."%s_data"(x)`, args[1], args[2]), nil)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *extModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Create(c, args)
+}
+
+func (m *extModule) DestroyModule() {}
+
+func (m *extModule) ShadowName(suffix string) bool {
+	return suffix == "data"
+}
+
+func (m *extModule) BestIndex(cst []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	for _, c := range cst {
+		m.ops = append(m.ops, c.Op)
+	}
+	return &IndexResult{Used: make([]bool, len(cst))}, nil
+}
+
+func (m *extModule) Disconnect() error { return nil }
+
+func (m *extModule) Destroy() error { return nil }
+
+func (m *extModule) Open() (VTabCursor, error) {
+	return &extCursor{}, nil
+}
+
+func (m *extModule) FindFunction(nArg int, name string) (any, Op) {
+	switch {
+	case name == "near" && nArg == 2:
+		return func(a, b int64) bool { return a-b <= 1 && b-a <= 1 }, OpFUNCTION + 1
+	case name == "lower" && nArg == 1:
+		return func(v int64) string { return fmt.Sprint("lowered ", v) }, 0
+	}
+	return nil, 0
+}
+
+func (m *extModule) Rename(newName string) error {
+	if m.renameErr != nil {
+		return m.renameErr
+	}
+	m.renamed = newName
+	return nil
+}
+
+func (m *extModule) Integrity(schema, table string, quick bool) error {
+	return m.integrity
+}
+
+type extCursor struct {
+	v int64
+}
+
+func (c *extCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	c.v = 1
+	return nil
+}
+
+func (c *extCursor) Next() error {
+	c.v++
+	return nil
+}
+
+func (c *extCursor) EOF() bool {
+	return c.v > 10
+}
+
+func (c *extCursor) Column(ctx *SQLiteContext, col int) error {
+	ctx.ResultInt64(c.v)
+	return nil
+}
+
+func (c *extCursor) Rowid() (int64, error) {
+	return c.v, nil
+}
+
+func (c *extCursor) Close() error {
+	return nil
+}
+
+func TestVTabExtensions(t *testing.T) {
+	m := &extModule{}
+	sql.Register("sqlite3_TestVTabExtensions", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			if err := conn.OverloadFunction("near", 2); err != nil {
+				return err
+			}
+			return conn.CreateModule("exttest", m)
+		},
+	})
+	db, err := sql.Open("sqlite3_TestVTabExtensions", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE VIRTUAL TABLE vt USING exttest"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overloaded functions.
+	var got sql.NullString
+	if err := db.QueryRow("SELECT group_concat(v) FROM vt WHERE near(v, 5)").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String != "4,5,6" {
+		t.Errorf("expected 4,5,6, got %q", got.String)
+	}
+	found := false
+	for _, op := range m.ops {
+		found = found || op == OpFUNCTION+1
+	}
+	if !found {
+		t.Errorf("expected BestIndex to see the function constraint, got %v", m.ops)
+	}
+	if err := db.QueryRow("SELECT lower(v) FROM vt WHERE rowid = 3").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String != "lowered 3" {
+		t.Errorf("expected the overloaded lower, got %q", got.String)
+	}
+	if err := db.QueryRow("SELECT lower('ABC')").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String != "abc" {
+		t.Errorf("expected the global lower, got %q", got.String)
+	}
+	if _, err := db.Exec("SELECT near(1, 2)"); err == nil {
+		t.Error("expected the placeholder function to fail")
+	}
+
+	// Connections registering the same module share its xShadowName slot.
+	for i := 0; i < shadowNameSlots+1; i++ {
+		other, err := sql.Open("sqlite3_TestVTabExtensions", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if err := other.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Shadow tables.
+	var typ string
+	if err := db.QueryRow("SELECT type FROM pragma_table_list WHERE name = 'vt_data'").Scan(&typ); err != nil {
+		t.Fatal(err)
+	}
+	if typ != "shadow" {
+		t.Errorf("expected vt_data to be a shadow table, got %q", typ)
+	}
+
+	// Integrity checks.
+	if _, n, _ := Version(); n >= 3044000 {
+		var res string
+		if err := db.QueryRow("PRAGMA integrity_check").Scan(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res != "ok" {
+			t.Errorf("expected ok, got %q", res)
+		}
+		m.integrity = errors.New("row 3 is corrupt")
+		if err := db.QueryRow("PRAGMA integrity_check").Scan(&res); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(res, "row 3 is corrupt") {
+			t.Errorf("expected the problem to be reported, got %q", res)
+		}
+	}
+
+	// Renames.
+	m.renameErr = errors.New("no renames today")
+	if _, err := db.Exec("ALTER TABLE vt RENAME TO vt2"); err == nil || !strings.Contains(err.Error(), "no renames today") {
+		t.Errorf("expected the rename to fail, got %v", err)
+	}
+	m.renameErr = nil
+	if _, err := db.Exec("ALTER TABLE vt RENAME TO vt2"); err != nil {
+		t.Fatal(err)
+	}
+	if m.renamed != "vt2" {
+		t.Errorf("expected Rename to be called with vt2, got %q", m.renamed)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM vt2").Scan(&typ); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// planModule is a table of the integers 1 to 100 and their squares planned
+// with VTabBestIndexer.
+type planModule struct {
+	in        bool
+	rhs       []any
+	colUsed   uint64
+	distinct  int
+	collation string
+	filters   [][]any
+}
+
+func (m *planModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	if err := c.DeclareVTab("CREATE TABLE x(v INTEGER, w INTEGER)"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *planModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Create(c, args)
+}
+
+func (m *planModule) DestroyModule() {}
+
+func (m *planModule) BestIndex(cst []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	return nil, errors.New("BestIndex called instead of BestIndexInfo")
+}
+
+func (m *planModule) BestIndexInfo(ii *IndexInfo) (*IndexResult, error) {
+	res := &IndexResult{
+		Used: make([]bool, len(ii.Constraints)),
+		Omit: make([]bool, len(ii.Constraints)),
+	}
+	var ops []byte
+	m.in, m.rhs, m.collation = false, nil, ""
+	for i, c := range ii.Constraints {
+		if !c.Usable {
+			continue
+		}
+		if v, ok := ii.RHSValue(i); ok {
+			m.rhs = append(m.rhs, v)
+		}
+		switch {
+		case c.Op == OpEQ && c.Column == 0:
+			m.in = ii.In(i, true)
+			m.collation = ii.Collation(i)
+			res.Used[i], res.Omit[i] = true, true
+			ops = append(ops, '=')
+			if !m.in {
+				res.IdxFlags = IndexScanUnique
+			}
+		case c.Op == OpGT && c.Column == 0:
+			// Used but not omitted: Filter ignores it and SQLite checks
+			// it again.
+			res.Used[i] = true
+			ops = append(ops, '>')
+		}
+	}
+	m.colUsed = ii.ColUsed
+	m.distinct = ii.Distinct()
+	res.IdxStr = string(ops)
+	return res, nil
+}
+
+func (m *planModule) Disconnect() error { return nil }
+
+func (m *planModule) Destroy() error { return nil }
+
+func (m *planModule) Open() (VTabCursor, error) {
+	return &planCursor{m: m}, nil
+}
+
+type planCursor struct {
+	m    *planModule
+	rows []int64
+	i    int
+}
+
+func (c *planCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	c.m.filters = append(c.m.filters, vals)
+	c.rows, c.i = nil, 0
+	for i, op := range []byte(idxStr) {
+		if op != '=' {
+			continue
+		}
+		list, ok := vals[i].([]any)
+		if !ok {
+			list = []any{vals[i]}
+		}
+		for _, v := range list {
+			if n, ok := v.(int64); ok && n >= 1 && n <= 100 {
+				c.rows = append(c.rows, n)
+			}
+		}
+		sort.Slice(c.rows, func(i, j int) bool { return c.rows[i] < c.rows[j] })
+		return nil
+	}
+	for n := int64(1); n <= 100; n++ {
+		c.rows = append(c.rows, n)
+	}
+	return nil
+}
+
+func (c *planCursor) Next() error {
+	c.i++
+	return nil
+}
+
+func (c *planCursor) EOF() bool {
+	return c.i >= len(c.rows)
+}
+
+func (c *planCursor) Column(ctx *SQLiteContext, col int) error {
+	v := c.rows[c.i]
+	if col == 1 {
+		v *= v
+	}
+	ctx.ResultInt64(v)
+	return nil
+}
+
+func (c *planCursor) Rowid() (int64, error) {
+	return c.rows[c.i], nil
+}
+
+func (c *planCursor) Close() error {
+	return nil
+}
+
+func TestVTabBestIndexInfo(t *testing.T) {
+	m := &planModule{}
+	sql.Register("sqlite3_TestVTabBestIndexInfo", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			return conn.CreateModule("plantest", m)
+		},
+	})
+	db, err := sql.Open("sqlite3_TestVTabBestIndexInfo", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE VIRTUAL TABLE pt USING plantest"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(q string) string {
+		t.Helper()
+		var s sql.NullString
+		if err := db.QueryRow("SELECT group_concat(x) FROM (" + q + ")").Scan(&s); err != nil {
+			t.Fatal(q, err)
+		}
+		return s.String
+	}
+
+	// A whole IN list in one Filter call, and a constraint SQLite checks
+	// again.
+	m.filters = nil
+	if got := query("SELECT v AS x FROM pt WHERE v IN (7, 3, 5, 'a') AND v > 4"); got != "5,7" {
+		t.Errorf("expected 5,7, got %q", got)
+	}
+	if !m.in {
+		t.Error("expected the IN list to be processed at once")
+	}
+	if len(m.filters) != 1 || fmt.Sprint(m.filters[0]) != "[[3 5 7 a] 4]" {
+		t.Errorf("unexpected Filter arguments: %v", m.filters)
+	}
+	if fmt.Sprint(m.rhs) != "[4]" {
+		t.Errorf("expected the right-hand value 4, got %v", m.rhs)
+	}
+
+	if got := query("SELECT v AS x FROM pt WHERE v = 3 COLLATE nocase"); got != "3" {
+		t.Errorf("expected 3, got %q", got)
+	}
+	if !strings.EqualFold(m.collation, "nocase") {
+		t.Errorf("expected the nocase collation, got %q", m.collation)
+	}
+
+	// LIMIT and OFFSET are passed as constraints.
+	if got := query("SELECT v AS x FROM pt LIMIT 2 OFFSET 3"); got != "4,5" {
+		t.Errorf("expected 4,5, got %q", got)
+	}
+	// The order of the two constraints depends on the SQLite version.
+	if r := fmt.Sprint(m.rhs); r != "[2 3]" && r != "[3 2]" {
+		t.Errorf("expected the LIMIT and OFFSET values, got %v", m.rhs)
+	}
+
+	if got := query("SELECT w AS x FROM pt WHERE v = 9"); got != "81" {
+		t.Errorf("expected 81, got %q", got)
+	}
+	if m.colUsed != 3 {
+		t.Errorf("expected columns 0 and 1 to be used, got %b", m.colUsed)
+	}
+	if m.distinct != 0 {
+		t.Errorf("expected no distinct hint, got %d", m.distinct)
+	}
+	if got := query("SELECT DISTINCT w AS x FROM pt WHERE v = 10"); got != "100" {
+		t.Errorf("expected 100, got %q", got)
+	}
+	if m.colUsed != 3 || m.distinct == 0 {
+		t.Errorf("expected a distinct hint, got %d", m.distinct)
+	}
+}
+
+// conflictModule is a key-value table that honors the conflict resolution
+// of INSERT statements and computes an expensive column only when needed.
+type conflictModule struct {
+	c        *SQLiteConn
+	keys     []string
+	vals     []int64
+	modes    []int
+	computed int
+	skipped  int
+	unchange bool
+}
+
+func (m *conflictModule) Create(c *SQLiteConn, args []string) (VTab, error) {
+	if err := c.DeclareVTab("CREATE TABLE x(k TEXT, v INTEGER, big TEXT)"); err != nil {
+		return nil, err
+	}
+	if err := c.VTabConfig(SQLITE_VTAB_CONSTRAINT_SUPPORT, 1); err != nil {
+		return nil, err
+	}
+	for _, arg := range args[3:] {
+		if arg == "directonly" {
+			if err := c.VTabConfig(SQLITE_VTAB_DIRECTONLY); err != nil {
+				return nil, err
+			}
+		}
+	}
+	m.c = c
+	return m, nil
+}
+
+func (m *conflictModule) Connect(c *SQLiteConn, args []string) (VTab, error) {
+	return m.Create(c, args)
+}
+
+func (m *conflictModule) DestroyModule() {}
+
+func (m *conflictModule) BestIndex(cst []InfoConstraint, ob []InfoOrderBy) (*IndexResult, error) {
+	return &IndexResult{Used: make([]bool, len(cst))}, nil
+}
+
+func (m *conflictModule) Disconnect() error { return nil }
+
+func (m *conflictModule) Destroy() error { return nil }
+
+func (m *conflictModule) Open() (VTabCursor, error) {
+	return &conflictCursor{m: m}, nil
+}
+
+func (m *conflictModule) Insert(id any, vals []any) (int64, error) {
+	k := vals[0].(string)
+	mode := m.c.VTabOnConflict()
+	m.modes = append(m.modes, mode)
+	for i, key := range m.keys {
+		if key != k {
+			continue
+		}
+		switch mode {
+		case SQLITE_IGNORE:
+		case SQLITE_REPLACE:
+			m.vals[i] = vals[1].(int64)
+		default:
+			return 0, ErrConstraint
+		}
+		return int64(i + 1), nil
+	}
+	m.keys = append(m.keys, k)
+	m.vals = append(m.vals, vals[1].(int64))
+	return int64(len(m.keys)), nil
+}
+
+func (m *conflictModule) Update(id any, vals []any) error {
+	_, m.unchange = vals[2].(Unchanged)
+	m.vals[id.(int64)-1] = vals[1].(int64)
+	return nil
+}
+
+func (m *conflictModule) Delete(id any) error {
+	return errors.New("not supported")
+}
+
+type conflictCursor struct {
+	m *conflictModule
+	i int
+}
+
+func (c *conflictCursor) Filter(idxNum int, idxStr string, vals []any) error {
+	c.i = 0
+	return nil
+}
+
+func (c *conflictCursor) Next() error {
+	c.i++
+	return nil
+}
+
+func (c *conflictCursor) EOF() bool {
+	return c.i >= len(c.m.keys)
+}
+
+func (c *conflictCursor) Column(ctx *SQLiteContext, col int) error {
+	switch col {
+	case 0:
+		ctx.ResultText(c.m.keys[c.i])
+	case 1:
+		ctx.ResultInt64(c.m.vals[c.i])
+	case 2:
+		if ctx.NoChange() {
+			c.m.skipped++
+			return nil
+		}
+		c.m.computed++
+		ctx.ResultText(strings.Repeat(c.m.keys[c.i], 3))
+	}
+	return nil
+}
+
+func (c *conflictCursor) Rowid() (int64, error) {
+	return int64(c.i + 1), nil
+}
+
+func (c *conflictCursor) Close() error {
+	return nil
+}
+
+func TestVTabConflict(t *testing.T) {
+	m := &conflictModule{}
+	sql.Register("sqlite3_TestVTabConflict", &SQLiteDriver{
+		ConnectHook: func(conn *SQLiteConn) error {
+			return conn.CreateModule("kv", m)
+		},
+	})
+	db, err := sql.Open("sqlite3_TestVTabConflict", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE VIRTUAL TABLE kv USING kv"); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"INSERT INTO kv (k, v) VALUES ('a', 1), ('b', 2)",
+		"INSERT OR IGNORE INTO kv (k, v) VALUES ('a', 10)",
+		"INSERT OR REPLACE INTO kv (k, v) VALUES ('b', 20)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(q, err)
+		}
+	}
+	_, err = db.Exec("INSERT INTO kv (k, v) VALUES ('a', 100)")
+	var serr Error
+	if !errors.As(err, &serr) || serr.Code != ErrConstraint {
+		t.Errorf("expected a constraint error, got %v", err)
+	}
+	expected := []int{SQLITE_ABORT, SQLITE_ABORT, SQLITE_IGNORE, SQLITE_REPLACE, SQLITE_ABORT}
+	if !reflect.DeepEqual(m.modes, expected) {
+		t.Errorf("expected conflict modes %v, got %v", expected, m.modes)
+	}
+
+	var s string
+	if err := db.QueryRow("SELECT group_concat(k || v || big) FROM kv").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "a1aaa,b20bbb" {
+		t.Errorf("unexpected rows: %q", s)
+	}
+
+	m.computed, m.skipped = 0, 0
+	if _, err := db.Exec("UPDATE kv SET v = v + 1"); err != nil {
+		t.Fatal(err)
+	}
+	if m.computed != 0 || m.skipped != 2 || !m.unchange {
+		t.Errorf("expected the big column to be skipped, computed %d, skipped %d", m.computed, m.skipped)
+	}
+	if _, err := db.Exec("UPDATE kv SET big = 'x' WHERE k = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+	if m.unchange {
+		t.Error("expected the big column to be passed")
+	}
+
+	// A direct-only table cannot be used from a view.
+	if _, err := db.Exec("CREATE VIRTUAL TABLE d USING kv(directonly)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE VIEW dv AS SELECT * FROM d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM dv"); err == nil || !strings.Contains(err.Error(), "unsafe use") {
+		t.Errorf("expected unsafe use error, got %v", err)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(dc any) error {
+		c := dc.(*SQLiteConn)
+		if err := c.VTabConfig(SQLITE_VTAB_CONSTRAINT_SUPPORT); err == nil {
+			t.Error("expected error for a missing argument")
+		}
+		if err := c.VTabConfig(SQLITE_VTAB_INNOCUOUS); err == nil {
+			t.Error("expected error outside of Create")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
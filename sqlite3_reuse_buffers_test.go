@@ -0,0 +1,183 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReuseBuffers(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:?_reuse_buffers=1")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+		create table foo (s text, b blob, ts datetime);
+		insert into foo values ('first', x'0102', '2024-02-29 10:00:00');
+		insert into foo values ('second', x'', null);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select s, b, ts from foo order by rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var raws []sql.RawBytes
+	var strs []string
+	for rows.Next() {
+		var s sql.RawBytes
+		var b []byte
+		var ts sql.NullTime
+		if err := rows.Scan(&s, &b, &ts); err != nil {
+			t.Fatal(err)
+		}
+		raws = append(raws, s)
+		strs = append(strs, string(s))
+		if len(strs) == 1 {
+			if string(b) != "\x01\x02" || !ts.Valid || !ts.Time.Equal(time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected row %q %v", b, ts)
+			}
+		} else if b == nil || len(b) != 0 || ts.Valid {
+			t.Errorf("unexpected row %q %v", b, ts)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(strs) != 2 || strs[0] != "first" || strs[1] != "second" {
+		t.Fatalf("unexpected values %q", strs)
+	}
+	// The buffer is shared between rows.
+	if &raws[0][0] != &raws[1][0] {
+		t.Error("expected the RawBytes of both rows to share a buffer")
+	}
+
+	rows.Close()
+
+	// Scan into string and any copies.
+	var str string
+	if err := db.QueryRow("select s from foo where rowid = 2").Scan(&str); err != nil {
+		t.Fatal(err)
+	}
+	if str != "second" {
+		t.Errorf("expected \"second\", got %q", str)
+	}
+	var v any
+	if err := db.QueryRow("select s from foo where rowid = 1").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := v.([]byte); !ok || string(b) != "first" {
+		t.Errorf("expected []byte(\"first\"), got %#v", v)
+	}
+}
+
+// benchmarkDecode scans a 1000 row table and reports the allocations per
+// row alongside the usual per-query numbers.
+func benchmarkDecode(b *testing.B, dsn string, scan func(rows *sql.Rows) error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	const n = 1000
+	if _, err := db.Exec("create table foo (s text, b blob, ts datetime)"); err != nil {
+		b.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ts := time.Date(2024, time.February, 29, 10, 0, 0, 123456789, time.UTC)
+	for i := 0; i < n; i++ {
+		s := fmt.Sprintf("some text value number %d", i)
+		if _, err := tx.Exec("insert into foo values (?, ?, ?)", s, []byte(s), ts.Add(time.Duration(i)*time.Second)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	b.ReportAllocs()
+	b.ResetTimer()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("select s, b, ts from foo")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+		rows.Close()
+	}
+	runtime.ReadMemStats(&after)
+	b.StopTimer()
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*n), "allocs/row")
+}
+
+func BenchmarkDecode(b *testing.B) {
+	// The destinations are declared once so that only the allocations of
+	// the driver and database/sql are counted.
+	var raw, rawBlob sql.RawBytes
+	var str string
+	var blob []byte
+	var ts time.Time
+	scanRaw := func(rows *sql.Rows) error {
+		return rows.Scan(&raw, &rawBlob, &ts)
+	}
+	scanCopy := func(rows *sql.Rows) error {
+		return rows.Scan(&str, &blob, &ts)
+	}
+	b.Run("default/rawbytes", func(b *testing.B) {
+		benchmarkDecode(b, "file::memory:", scanRaw)
+	})
+	b.Run("default/copy", func(b *testing.B) {
+		benchmarkDecode(b, "file::memory:", scanCopy)
+	})
+	b.Run("reuse/rawbytes", func(b *testing.B) {
+		benchmarkDecode(b, "file::memory:?_reuse_buffers=1", scanRaw)
+	})
+	b.Run("reuse/copy", func(b *testing.B) {
+		benchmarkDecode(b, "file::memory:?_reuse_buffers=1", scanCopy)
+	})
+}
+
+func BenchmarkParseTime(b *testing.B) {
+	const s = "2024-02-29 10:00:00.123456789+09:00"
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parseTime(s, SQLiteTimestampFormats)
+		}
+	})
+	b.Run("layouts", func(b *testing.B) {
+		formats := append([]string{"02/01/2006"}, SQLiteTimestampFormats...)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parseTime(s, formats)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// HasNextResultSet implements driver.RowsNextResultSet. It reports whether
+// the query has statements after the current one.
+func (rc *SQLiteRows) HasNextResultSet() bool {
+	return rc.tail != ""
+}
+
+// NextResultSet implements driver.RowsNextResultSet. It closes the current
+// statement and runs the following statements of a multi-statement query up
+// to the next one that returns columns, which becomes the current result
+// set. Statements that return no columns are executed to completion on the
+// way. It returns io.EOF when no statement returning columns is left.
+//
+// Statements that NextResultSet never reaches, because the rows are closed
+// before it has walked the whole query, are executed by Close.
+func (rc *SQLiteRows) NextResultSet() error {
+	if rc.tail == "" || rc.s == nil {
+		return io.EOF
+	}
+	c := rc.s.c
+	tail, args, start := rc.tail, rc.args, rc.argStart
+	rc.tail = ""
+	if err := rc.close(); err != nil {
+		return err
+	}
+	next, err := c.queryFrom(rc.ctx, tail, args, start, true)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return io.EOF
+	}
+	rc.closemu.Lock()
+	rc.s, rc.nc, rc.cls, rc.colvals = next.s, next.nc, next.cls, next.colvals
+	rc.cols, rc.decltype, rc.coltypes = nil, nil, nil
+	rc.tail, rc.args, rc.argStart = next.tail, next.args, next.argStart
+	rc.closemu.Unlock()
+	return nil
+}
+
+// execRest executes the statements of tail, the rest of a multi-statement
+// query whose rows are closed, stepping those that return rows through all
+// of them.
+func (c *SQLiteConn) execRest(ctx context.Context, tail string, args []driver.NamedValue, start int) error {
+	for tail != "" {
+		rows, err := c.queryFrom(ctx, tail, args, start, true)
+		if err != nil {
+			return err
+		}
+		if rows == nil {
+			return nil
+		}
+		tail, start = rows.tail, rows.argStart
+		rows.tail = ""
+		dest := make([]driver.Value, rows.nc)
+		for {
+			if err = rows.Next(dest); err != nil {
+				break
+			}
+		}
+		if cerr := rows.close(); err == io.EOF {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScriptError is returned by ExecScript when a statement of the script
+// fails.
+type ScriptError struct {
+	// Offset is the byte offset in the script of the statement that
+	// failed.
+	Offset int
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("sqlite3: statement at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScript executes the statements of script in order and returns the
+// result of each one. Arguments are consumed by the statements in order, as
+// with Exec.
+//
+// Execution stops at the first statement that fails. The results of the
+// statements that ran before it are returned along with a *ScriptError
+// giving the offset of the failing statement. The script is not wrapped in
+// a transaction, so the changes of those statements are kept unless the
+// script manages its own transaction.
+func (c *SQLiteConn) ExecScript(ctx context.Context, script string, args []driver.NamedValue) ([]driver.Result, error) {
+	if len(c.interceptors) > 0 {
+		ch := newInterceptorChain(c.interceptors)
+		ictx, q, err := ch.beforeExec(ctx, script, args)
+		if err != nil {
+			ch.afterExec(execEvent(script, args, 0, nil, err))
+			return nil, err
+		}
+		start := time.Now()
+		results, err := c.execScript(ictx, q, args)
+		total := &SQLiteResult{}
+		for _, res := range results {
+			total.id = res.(*SQLiteResult).id
+			total.changes += res.(*SQLiteResult).changes
+		}
+		ch.afterExec(execEvent(q, args, time.Since(start), total, err))
+		return results, err
+	}
+	return c.execScript(ctx, script, args)
+}
+
+func (c *SQLiteConn) execScript(ctx context.Context, script string, args []driver.NamedValue) ([]driver.Result, error) {
+	var results []driver.Result
+	// The tail of a prepared statement is returned trimmed of white space,
+	// so the offset of the next statement is found from the end.
+	end := len(strings.TrimRightFunc(script, unicode.IsSpace))
+	offset := len(script) - len(strings.TrimLeftFunc(script, unicode.IsSpace))
+	start := 0
+	for offset < end {
+		s, err := c.prepare(ctx, script[offset:end])
+		if err != nil {
+			return results, &ScriptError{Offset: offset, Err: err}
+		}
+		ss := s.(*SQLiteStmt)
+		tail := ss.t
+		if ss.s != nil {
+			na := ss.NumInput()
+			if len(args)-start < na {
+				ss.Close()
+				err := fmt.Errorf("not enough args to execute query: want %d got %d", na, len(args)-start)
+				return results, &ScriptError{Offset: offset, Err: err}
+			}
+			res, err := ss.exec(ctx, stmtArgs(args, start, na))
+			ss.Close()
+			if err != nil {
+				return results, &ScriptError{Offset: offset, Err: err}
+			}
+			results = append(results, res)
+			start += na
+		} else {
+			ss.Close()
+		}
+		offset = end - len(tail)
+	}
+	return results, nil
+}
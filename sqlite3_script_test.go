@@ -0,0 +1,205 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNextResultSet(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("create table foo (id integer, name text)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`
+		insert into foo values (?, 'a'), (?, 'b');
+		select id from foo order by id;
+		update foo set name = upper(name);
+		-- a comment between statements
+		select name, id from foo where id > ? order by id;
+		delete from foo where id = ?;
+	`, 1, 2, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var sets [][]string
+	for {
+		var set []string
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		set = append(set, strings.Join(cols, ","))
+		for rows.Next() {
+			vals := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatal(err)
+			}
+			var parts []string
+			for _, v := range vals {
+				switch v := v.(type) {
+				case int64:
+					parts = append(parts, strconv.FormatInt(v, 10))
+				case string:
+					parts = append(parts, v)
+				}
+			}
+			set = append(set, strings.Join(parts, ","))
+		}
+		sets = append(sets, set)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"id", "1", "2"},
+		{"name,id", "B,2"},
+	}
+	if !reflect.DeepEqual(sets, expected) {
+		t.Errorf("expected %q, got %q", expected, sets)
+	}
+
+	// The trailing delete ran when the last result set was left.
+	var n int
+	if err := db.QueryRow("select count(*) from foo").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 row, got %d", n)
+	}
+
+	// A single statement has no further result sets.
+	rows, err = db.Query("select 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if rows.NextResultSet() {
+		t.Error("expected no further result set")
+	}
+	rows.Close()
+}
+
+func TestQueryCloseRunsRest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("create table foo (id integer)"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("select 1; insert into foo values (?); select 2; insert into foo values (?) returning id", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("select count(*) from foo").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows inserted by closing the rows, got %d", n)
+	}
+
+	// A failing statement after the first result set is reported by Close.
+	rows, err = db.Query("select 1; insert into nosuchtable values (1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Close(); err == nil || !strings.Contains(err.Error(), "nosuchtable") {
+		t.Errorf("expected an error for the missing table, got %v", err)
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	d := SQLiteDriver{}
+	conn, err := d.Open(":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer conn.Close()
+	c := conn.(*SQLiteConn)
+	ctx := context.Background()
+
+	script := `
+		create table foo (id integer primary key);
+		insert into foo values (?), (?);
+		-- nothing to run here
+		;
+		delete from foo where id = ?;
+	`
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: int64(2)}, {Ordinal: 3, Value: int64(1)}}
+	results, err := c.ExecScript(ctx, script, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]int64
+	for _, res := range results {
+		n, _ := res.RowsAffected()
+		id, _ := res.LastInsertId()
+		got = append(got, [2]int64{n, id})
+	}
+	expected := [][2]int64{{0, 0}, {2, 2}, {1, 2}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	script = "insert into foo values (10);\n  insert into foo values (2);\ninsert into foo values (11);"
+	results, err = c.ExecScript(ctx, script, nil)
+	var serr *ScriptError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected ScriptError, got %v", err)
+	}
+	if want := strings.Index(script, "insert into foo values (2)"); serr.Offset != want {
+		t.Errorf("expected offset %d, got %d", want, serr.Offset)
+	}
+	var sqliteErr Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != ErrConstraint {
+		t.Errorf("expected constraint error, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected 1 result, got %d", len(results))
+	}
+
+	// Syntax errors report the offset of the statement too.
+	script = "select 1; selec 2"
+	_, err = c.ExecScript(ctx, script, nil)
+	if !errors.As(err, &serr) || serr.Offset != 10 {
+		t.Errorf("expected ScriptError at offset 10, got %v", err)
+	}
+}
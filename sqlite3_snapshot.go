@@ -0,0 +1,77 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteSnapshot writes a consistent copy of the database schema, "main" if
+// empty, to w, in the format of a database file.
+//
+// The copy is made with VACUUM INTO a temporary file, which is then streamed
+// to w, so that unlike Serialize the database is never held in memory. The
+// copy sees the database as of the start of the VACUUM; other connections
+// may keep writing to it meanwhile.
+func (c *SQLiteConn) WriteSnapshot(ctx context.Context, w io.Writer, schema string) error {
+	if schema == "" {
+		schema = "main"
+	}
+	f, err := os.CreateTemp("", "go-sqlite3-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	query := `VACUUM "` + strings.ReplaceAll(schema, `"`, `""`) + `" INTO ?`
+	if _, err := c.exec(ctx, query, []driver.NamedValue{{Ordinal: 1, Value: f.Name()}}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, &contextReader{ctx: ctx, r: f})
+	return err
+}
+
+// RestoreSnapshot replaces the main database of the connection with the
+// database file read from r, such as one written by WriteSnapshot.
+//
+// The content of r is first copied to a temporary file, so that the
+// database is left untouched if r fails, then restored with BackupFrom.
+func (c *SQLiteConn) RestoreSnapshot(ctx context.Context, r io.Reader) error {
+	f, err := os.CreateTemp("", "go-sqlite3-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return c.BackupFrom(ctx, f.Name(), BackupOptions{})
+}
+
+// contextReader is a reader that fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		"CREATE TABLE t (v TEXT)",
+		"INSERT INTO t VALUES ('a'), ('b')",
+		`ATTACH ':memory:' AS "other ""db"""`,
+		`CREATE TABLE "other ""db""".u (v TEXT)`,
+		`INSERT INTO "other ""db""".u VALUES ('x')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(q, err)
+		}
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var main, other bytes.Buffer
+	err = conn.Raw(func(dc any) error {
+		c := dc.(*SQLiteConn)
+		if err := c.WriteSnapshot(ctx, &main, ""); err != nil {
+			return err
+		}
+		if err := c.WriteSnapshot(ctx, &other, `other "db"`); err != nil {
+			return err
+		}
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := c.WriteSnapshot(canceled, &bytes.Buffer{}, ""); err == nil {
+			t.Error("expected error with a canceled context")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(main.Bytes(), []byte("SQLite format 3\x00")) {
+		t.Fatal("expected a database file")
+	}
+
+	restored, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	restored.SetMaxOpenConns(1)
+	rconn, err := restored.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rconn.Close()
+	query := func(q string) string {
+		t.Helper()
+		var s string
+		if err := rconn.QueryRowContext(ctx, q).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	restore := func(r *bytes.Reader) error {
+		return rconn.Raw(func(dc any) error {
+			return dc.(*SQLiteConn).RestoreSnapshot(ctx, r)
+		})
+	}
+
+	if err := restore(bytes.NewReader(main.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if s := query("SELECT group_concat(v) FROM t"); s != "a,b" {
+		t.Errorf("expected a,b, got %q", s)
+	}
+	if err := restore(bytes.NewReader(other.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if s := query("SELECT group_concat(v) FROM u"); s != "x" {
+		t.Errorf("expected x, got %q", s)
+	}
+
+	// Invalid data leaves the database unchanged.
+	err = restore(bytes.NewReader([]byte(strings.Repeat("not a database", 100))))
+	var berr *BackupError
+	if !errors.As(err, &berr) {
+		t.Errorf("expected a backup error, got %v", err)
+	}
+	if s := query("SELECT group_concat(v) FROM u"); s != "x" {
+		t.Errorf("expected x, got %q", s)
+	}
+}
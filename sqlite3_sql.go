@@ -11,6 +11,8 @@ package sqlite3
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
+	"time"
 )
 
 // Ping implement Pinger.
@@ -24,30 +26,104 @@ func (c *SQLiteConn) Ping(ctx context.Context) error {
 
 // QueryContext implement QueryerContext.
 func (c *SQLiteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	return c.query(ctx, query, args)
+	if len(c.interceptors) == 0 {
+		return c.query(ctx, query, args)
+	}
+	ic := newInterceptorChain(c.interceptors)
+	ctx, query, err := ic.beforeQuery(ctx, query, args)
+	var rows driver.Rows
+	start := time.Now()
+	if err == nil {
+		rows, err = c.query(ctx, query, args)
+	}
+	ic.afterQuery(InterceptorEvent{Query: query, Args: args, Duration: time.Since(start), Err: err})
+	return rows, err
 }
 
 // ExecContext implement ExecerContext.
 func (c *SQLiteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	return c.exec(ctx, query, args)
+	if len(c.interceptors) == 0 {
+		return c.exec(ctx, query, args)
+	}
+	ic := newInterceptorChain(c.interceptors)
+	ctx, query, err := ic.beforeExec(ctx, query, args)
+	var res driver.Result
+	start := time.Now()
+	if err == nil {
+		res, err = c.exec(ctx, query, args)
+	}
+	ic.afterExec(execEvent(query, args, time.Since(start), res, err))
+	return res, err
 }
 
 // PrepareContext implement ConnPrepareContext.
 func (c *SQLiteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if len(c.interceptors) > 0 {
+		var err error
+		query, err = newInterceptorChain(c.interceptors).beforePrepare(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return c.prepare(ctx, query)
 }
 
 // BeginTx implement ConnBeginTx.
 func (c *SQLiteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	return c.begin(ctx)
+	if len(c.interceptors) == 0 {
+		return c.begin(ctx)
+	}
+	ic := newInterceptorChain(c.interceptors)
+	ctx, err := ic.beforeBegin(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx.(*SQLiteTx).ic = ic
+	return tx, nil
 }
 
+var errInterceptorRewrite = errors.New("sqlite3: interceptor cannot rewrite the query of a prepared statement")
+
 // QueryContext implement QueryerContext.
 func (s *SQLiteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	return s.query(ctx, args)
+	if len(s.c.interceptors) == 0 {
+		return s.query(ctx, args)
+	}
+	query := s.sql()
+	ic := newInterceptorChain(s.c.interceptors)
+	ctx, rewritten, err := ic.beforeQuery(ctx, query, args)
+	if err == nil && rewritten != query {
+		err = errInterceptorRewrite
+	}
+	var rows driver.Rows
+	start := time.Now()
+	if err == nil {
+		rows, err = s.query(ctx, args)
+	}
+	ic.afterQuery(InterceptorEvent{Query: query, Args: args, Duration: time.Since(start), Err: err})
+	return rows, err
 }
 
 // ExecContext implement ExecerContext.
 func (s *SQLiteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	return s.exec(ctx, args)
+	if len(s.c.interceptors) == 0 {
+		return s.exec(ctx, args)
+	}
+	query := s.sql()
+	ic := newInterceptorChain(s.c.interceptors)
+	ctx, rewritten, err := ic.beforeExec(ctx, query, args)
+	if err == nil && rewritten != query {
+		err = errInterceptorRewrite
+	}
+	var res driver.Result
+	start := time.Now()
+	if err == nil {
+		res, err = s.exec(ctx, args)
+	}
+	ic.afterExec(execEvent(query, args, time.Since(start), res, err))
+	return res, err
 }
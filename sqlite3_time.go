@@ -0,0 +1,274 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// timeFormat selects how time.Time values are stored, see _time_format.
+type timeFormat int
+
+const (
+	timeFormatDefault timeFormat = iota // SQLiteTimestampFormats[0] text
+	timeFormatRFC3339Nano
+	timeFormatUnix
+	timeFormatUnixMilli
+	timeFormatUnixNano
+	timeFormatJulian
+)
+
+func parseTimeFormat(val string) (timeFormat, error) {
+	switch strings.ToLower(val) {
+	case "default":
+		return timeFormatDefault, nil
+	case "rfc3339nano":
+		return timeFormatRFC3339Nano, nil
+	case "unix":
+		return timeFormatUnix, nil
+	case "unixmilli":
+		return timeFormatUnixMilli, nil
+	case "unixnano":
+		return timeFormatUnixNano, nil
+	case "julian":
+		return timeFormatJulian, nil
+	}
+	return 0, fmt.Errorf("Invalid _time_format: %v, expecting value of 'default rfc3339nano unix unixmilli unixnano julian'", val)
+}
+
+// timeEpoch is the unit of INTEGER values in time columns, see _time_epoch.
+// timeEpochAuto treats values larger than 1e12 in magnitude as milliseconds
+// and anything else as seconds.
+type timeEpoch int
+
+const (
+	timeEpochAuto timeEpoch = iota
+	timeEpochSecond
+	timeEpochMilli
+	timeEpochMicro
+	timeEpochNano
+)
+
+func parseTimeEpoch(val string) (timeEpoch, error) {
+	switch strings.ToLower(val) {
+	case "auto":
+		return timeEpochAuto, nil
+	case "s":
+		return timeEpochSecond, nil
+	case "ms":
+		return timeEpochMilli, nil
+	case "us":
+		return timeEpochMicro, nil
+	case "ns":
+		return timeEpochNano, nil
+	}
+	return 0, fmt.Errorf("Invalid _time_epoch: %v, expecting value of 'auto s ms us ns'", val)
+}
+
+// epoch returns the unit written by f, used as the default _time_epoch so
+// that values round trip.
+func (f timeFormat) epoch() timeEpoch {
+	switch f {
+	case timeFormatUnix:
+		return timeEpochSecond
+	case timeFormatUnixMilli:
+		return timeEpochMilli
+	case timeFormatUnixNano:
+		return timeEpochNano
+	}
+	return timeEpochAuto
+}
+
+// encode converts t to the value stored for format f. The default format
+// is left to bindValue.
+func (f timeFormat) encode(t time.Time) driver.Value {
+	switch f {
+	case timeFormatRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case timeFormatUnix:
+		return t.Unix()
+	case timeFormatUnixMilli:
+		return t.UnixMilli()
+	case timeFormatUnixNano:
+		return t.UnixNano()
+	case timeFormatJulian:
+		return timeToJulian(t)
+	}
+	return t
+}
+
+// decode converts an INTEGER value of a time column to a UTC time.
+func (e timeEpoch) decode(val int64) time.Time {
+	switch e {
+	case timeEpochSecond:
+		return time.Unix(val, 0).UTC()
+	case timeEpochMilli:
+		return time.UnixMilli(val).UTC()
+	case timeEpochMicro:
+		return time.UnixMicro(val).UTC()
+	case timeEpochNano:
+		return time.Unix(0, val).UTC()
+	}
+	// Assume a millisecond unix timestamp if it's 13 digits -- too
+	// large to be a reasonable timestamp in seconds.
+	if val > 1e12 || val < -1e12 {
+		return time.UnixMilli(val).UTC()
+	}
+	return time.Unix(val, 0).UTC()
+}
+
+// julianUnixEpoch is the Julian day number of 1970-01-01 00:00:00 UTC.
+const julianUnixEpoch = 2440587.5
+
+// timeToJulian returns the Julian day number of t, as stored by SQLite's
+// julianday() function.
+func timeToJulian(t time.Time) float64 {
+	return float64(t.UnixMilli())/86400000 + julianUnixEpoch
+}
+
+// julianToTime converts a Julian day number to a UTC time. Like SQLite, it
+// keeps millisecond precision.
+func julianToTime(jd float64) time.Time {
+	ms := math.Round((jd - julianUnixEpoch) * 86400000)
+	return time.UnixMilli(int64(ms)).UTC()
+}
+
+// defaultTimestampFormats is the initial value of SQLiteTimestampFormats.
+// parseTimestamp only stands in for it while SQLiteTimestampFormats still
+// holds these layouts.
+var defaultTimestampFormats = append([]string(nil), SQLiteTimestampFormats...)
+
+func isDefaultTimestampFormats(formats []string) bool {
+	if len(formats) != len(defaultTimestampFormats) {
+		return false
+	}
+	for i := range formats {
+		if formats[i] != defaultTimestampFormats[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTime parses the TEXT value of a time column, trying each of formats
+// in order. It returns the zero time if none of them match.
+func parseTime(s string, formats []string) time.Time {
+	s = strings.TrimSuffix(s, "Z")
+	if isDefaultTimestampFormats(formats) {
+		if t, ok := parseTimestamp(s); ok {
+			return t
+		}
+	}
+	for _, format := range formats {
+		if t, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseTimestamp is a fast path for the layouts of the default
+// SQLiteTimestampFormats: a date, optionally followed by ' ' or 'T' and
+// hh:mm, :ss, a fraction of a second and a -07:00 style offset. It returns
+// the same time as time.ParseInLocation with those layouts and reports
+// false for anything it does not handle, which the caller then parses the
+// slow way.
+func parseTimestamp(s string) (time.Time, bool) {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return time.Time{}, false
+	}
+	year, ok1 := atoiFixed(s[0:4])
+	month, ok2 := atoiFixed(s[5:7])
+	day, ok3 := atoiFixed(s[8:10])
+	if !ok1 || !ok2 || !ok3 || month < 1 || month > 12 || day < 1 || day > daysIn(time.Month(month), year) {
+		return time.Time{}, false
+	}
+	s = s[10:]
+	if s == "" {
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), true
+	}
+
+	if len(s) < 6 || (s[0] != ' ' && s[0] != 'T') || s[3] != ':' {
+		return time.Time{}, false
+	}
+	hour, ok1 := atoiFixed(s[1:3])
+	min, ok2 := atoiFixed(s[4:6])
+	if !ok1 || !ok2 || hour > 23 || min > 59 {
+		return time.Time{}, false
+	}
+	s = s[6:]
+	if s == "" {
+		return time.Date(year, time.Month(month), day, hour, min, 0, 0, time.UTC), true
+	}
+
+	if len(s) < 3 || s[0] != ':' {
+		return time.Time{}, false
+	}
+	sec, ok := atoiFixed(s[1:3])
+	if !ok || sec > 59 {
+		return time.Time{}, false
+	}
+	s = s[3:]
+
+	nsec := 0
+	if len(s) > 0 && s[0] == '.' {
+		i := 1
+		for ; i < len(s) && i <= 9 && s[i] >= '0' && s[i] <= '9'; i++ {
+			nsec = nsec*10 + int(s[i]-'0')
+		}
+		if i == 1 || (i < len(s) && s[i] >= '0' && s[i] <= '9') {
+			return time.Time{}, false
+		}
+		for j := i; j <= 9; j++ {
+			nsec *= 10
+		}
+		s = s[i:]
+	}
+	if s == "" {
+		return time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.UTC), true
+	}
+
+	if len(s) != 6 || (s[0] != '+' && s[0] != '-') || s[3] != ':' {
+		return time.Time{}, false
+	}
+	oh, ok1 := atoiFixed(s[1:3])
+	om, ok2 := atoiFixed(s[4:6])
+	if !ok1 || !ok2 || oh > 23 || om > 59 {
+		return time.Time{}, false
+	}
+	offset := (oh*60 + om) * 60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	t := time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.UTC).Add(-time.Duration(offset) * time.Second)
+	if offset == 0 {
+		return t, true
+	}
+	return t.In(time.FixedZone("", offset)), true
+}
+
+// atoiFixed parses a string made only of ASCII digits.
+func atoiFixed(s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+func daysIn(m time.Month, year int) int {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	ts := time.Date(2024, time.February, 29, 13, 14, 15, 123456789, time.UTC)
+	tests := []struct {
+		format   string
+		typ      string
+		expected time.Time
+	}{
+		{"default", "text", ts},
+		{"rfc3339nano", "text", ts},
+		{"unix", "integer", ts.Truncate(time.Second)},
+		{"unixmilli", "integer", ts.Truncate(time.Millisecond)},
+		{"unixnano", "integer", ts},
+		{"julian", "real", ts.Round(time.Millisecond)},
+	}
+	for _, tt := range tests {
+		db, err := sql.Open("sqlite3", "file::memory:?_time_format="+tt.format)
+		if err != nil {
+			t.Fatal("Failed to open database:", err)
+		}
+		defer db.Close()
+		if _, err := db.Exec("create table foo (ts datetime)"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("insert into foo values (?)", ts); err != nil {
+			t.Fatal(err)
+		}
+		var typ string
+		var got time.Time
+		if err := db.QueryRow("select typeof(ts), ts from foo").Scan(&typ, &got); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if typ != tt.typ {
+			t.Errorf("%s: expected storage class %s, got %s", tt.format, tt.typ, typ)
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.format, tt.expected, got)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", "file::memory:?_time_format=bogus")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err == nil {
+		t.Error("expected error for invalid _time_format")
+	}
+}
+
+func TestTimeEpoch(t *testing.T) {
+	ts := time.Date(1971, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		epoch string
+		value int64
+	}{
+		{"s", ts.Unix()},
+		{"ms", ts.UnixMilli()},
+		{"us", ts.UnixMicro()},
+		{"ns", ts.UnixNano()},
+	}
+	for _, tt := range tests {
+		db, err := sql.Open("sqlite3", "file::memory:?_time_epoch="+tt.epoch)
+		if err != nil {
+			t.Fatal("Failed to open database:", err)
+		}
+		defer db.Close()
+		var got time.Time
+		if _, err := db.Exec("create table foo (ts timestamp)"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("insert into foo values (?)", tt.value); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.QueryRow("select ts from foo").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(ts) {
+			t.Errorf("%s: expected %v, got %v", tt.epoch, ts, got)
+		}
+	}
+}
+
+func TestTimeJulianDay(t *testing.T) {
+	for _, julian := range []bool{false, true} {
+		dsn := ":memory:"
+		if julian {
+			dsn = "file::memory:?_time_format=julian"
+		}
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal("Failed to open database:", err)
+		}
+		defer db.Close()
+		if _, err := db.Exec("create table foo (d date); insert into foo values (julianday('2000-01-01 12:00:00.250'))"); err != nil {
+			t.Fatal(err)
+		}
+		var got any
+		if err := db.QueryRow("select d from foo").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !julian {
+			// Without the opt-in a REAL stays a number.
+			if f, ok := got.(float64); !ok || f != 2451545.0000028936 {
+				t.Errorf("expected the Julian day as float64, got %T %v", got, got)
+			}
+			continue
+		}
+		expected := time.Date(2000, time.January, 1, 12, 0, 0, 250e6, time.UTC)
+		if ts, ok := got.(time.Time); !ok || !ts.Equal(expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestTimeParseFormats(t *testing.T) {
+	sql.Register("sqlite3_TimeParseFormats", &SQLiteDriver{
+		TimeParseFormats: []string{"02/01/2006"},
+	})
+	db, err := sql.Open("sqlite3_TimeParseFormats", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("create table foo (a date, b date); insert into foo values ('29/02/2024', '2024-02-29')"); err != nil {
+		t.Fatal(err)
+	}
+	var a, b time.Time
+	if err := db.QueryRow("select a, b from foo").Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC); !a.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, a)
+	}
+	// The package formats are not consulted.
+	if !b.IsZero() {
+		t.Errorf("expected zero time, got %v", b)
+	}
+}
+
+func TestTimeParseDSN(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:?_time_parse=02/01/2006&_time_parse=2006-01-02")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("create table foo (a date, b date, c date); insert into foo values ('29/02/2024', '2024-02-29', '2024-02-29 12:00:00')"); err != nil {
+		t.Fatal(err)
+	}
+	var a, b, c time.Time
+	if err := db.QueryRow("select a, b, c from foo").Scan(&a, &b, &c); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	if !a.Equal(expected) || !b.Equal(expected) {
+		t.Errorf("expected %v, got %v and %v", expected, a, b)
+	}
+	// The package formats are not consulted.
+	if !c.IsZero() {
+		t.Errorf("expected zero time, got %v", c)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	inputs := []string{
+		"2012-11-04",
+		"2012-11-04 00:00",
+		"2012-11-04T23:59",
+		"2012-11-04 00:00:00",
+		"2006-01-02 15:04:05.1",
+		"2006-01-02T15:04:05.123456789",
+		"2006-01-02T15:04:05.1234567891",
+		"2006-01-02 15:04:05-07:00",
+		"2006-01-02 15:04:05.5+09:30",
+		"2006-01-02T05:51:05.123456789-09:13",
+		"2006-01-02 15:04:05+00:00",
+		"2006-01-02 15:04:05-00:00",
+		"2024-02-29 12:00:00",
+		"2023-02-29 12:00:00",
+		"0000-00-00 00:00:00",
+		"2006-01-02 24:00:00",
+		"2006-01-02 1:04:05",
+		"2006-01-02 15:04-07:00",
+		"2006-01-02 15:04:05.",
+		"2006-01-02 15:04:05,5",
+		"2006-01-02 15:04:05 -07:00",
+		"nonsense",
+		"",
+	}
+	for _, s := range inputs {
+		expected := time.Time{}
+		for _, format := range SQLiteTimestampFormats {
+			if tt, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+				expected = tt
+				break
+			}
+		}
+		got, ok := parseTimestamp(s)
+		if !ok {
+			got = parseTime(s, SQLiteTimestampFormats)
+		}
+		_, expectedOffset := expected.Zone()
+		_, gotOffset := got.Zone()
+		if !got.Equal(expected) || gotOffset != expectedOffset || got.Location().String() != expected.Location().String() {
+			t.Errorf("%q: expected %v, got %v (fast path %v)", s, expected, got, ok)
+		}
+	}
+}
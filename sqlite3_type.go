@@ -14,7 +14,9 @@ package sqlite3
 import "C"
 import (
 	"database/sql"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -23,25 +25,115 @@ func (rc *SQLiteRows) ColumnTypeDatabaseTypeName(i int) string {
 	return C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i)))
 }
 
-/*
-func (rc *SQLiteRows) ColumnTypeLength(index int) (length int64, ok bool) {
+// ColumnTypeLength implement RowsColumnTypeLength.
+//
+// The length is taken from the declared type of the column, e.g. 255 for
+// VARCHAR(255). TEXT and BLOB columns declared without a length report
+// math.MaxInt64.
+func (rc *SQLiteRows) ColumnTypeLength(i int) (length int64, ok bool) {
+	base, args := parseDeclType(C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i))))
+	switch databaseTypeConvSqlite(base) {
+	case SQLITE_TEXT, SQLITE_BLOB:
+		if len(args) == 1 {
+			return args[0], true
+		}
+		return math.MaxInt64, true
+	}
 	return 0, false
 }
 
-func (rc *SQLiteRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+// ColumnTypePrecisionScale implement RowsColumnTypePrecisionScale.
+//
+// Precision and scale are taken from the declared type of the column, e.g.
+// DECIMAL(10,2). SQLite itself does not enforce them.
+func (rc *SQLiteRows) ColumnTypePrecisionScale(i int) (precision, scale int64, ok bool) {
+	base, args := parseDeclType(C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i))))
+	if databaseTypeConvSqlite(base) != SQLITE_NUMERIC {
+		return 0, 0, false
+	}
+	switch len(args) {
+	case 1:
+		return args[0], 0, true
+	case 2:
+		return args[0], args[1], true
+	}
 	return 0, 0, false
 }
-*/
 
 // ColumnTypeNullable implement RowsColumnTypeNullable.
+//
+// Every column is reported as nullable, except for the result columns that
+// are taken directly from a NOT NULL table column, see ColumnOrigin, which
+// needs the sqlite_column_metadata tag. A NOT NULL column can still produce
+// NULL values on the optional side of an outer join.
 func (rc *SQLiteRows) ColumnTypeNullable(i int) (nullable, ok bool) {
-	return true, true
+	origin, ok := rc.ColumnOrigin(i)
+	if !ok {
+		return true, true
+	}
+	if origin.PrimaryKey && strings.EqualFold(origin.DeclType, "INTEGER") {
+		// INTEGER PRIMARY KEY is an alias for the rowid.
+		return false, true
+	}
+	return !origin.NotNull, true
 }
 
 // ColumnTypeScanType implement RowsColumnTypeScanType.
+//
+// Columns whose declared type was registered with RegisterColumnType report
+// the registered scan type.
 func (rc *SQLiteRows) ColumnTypeScanType(i int) reflect.Type {
 	//ct := C.sqlite3_column_type(rc.s.s, C.int(i))  // Always returns 5
-	return scanType(C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i))))
+	decltype := C.GoString(C.sqlite3_column_decltype(rc.s.s, C.int(i)))
+	if ct := rc.s.c.lookupColumnType(strings.ToLower(decltype)); ct != nil && ct.scanType != nil {
+		return ct.scanType
+	}
+	return scanType(decltype)
+}
+
+// ColumnOrigin describes the table column a result column is taken from.
+type ColumnOrigin struct {
+	Database      string
+	Table         string
+	Column        string
+	DeclType      string
+	Collation     string
+	NotNull       bool
+	PrimaryKey    bool
+	AutoIncrement bool
+}
+
+// ColumnOrigin returns the table column that is the origin of the i-th
+// result column. ok is false if the result column is an expression or a
+// subquery rather than a plain table column, and always false unless built
+// with the sqlite_column_metadata tag.
+//
+// See https://www.sqlite.org/c3ref/column_database_name.html and
+// https://www.sqlite.org/c3ref/table_column_metadata.html
+func (rc *SQLiteRows) ColumnOrigin(i int) (origin ColumnOrigin, ok bool) {
+	if rc.s == nil || rc.s.s == nil {
+		return origin, false
+	}
+	return rc.s.columnOrigin(i)
+}
+
+// parseDeclType splits a declared column type such as "VARCHAR(255)" or
+// "DECIMAL(10, 2)" into its upper-cased base name and numeric arguments.
+func parseDeclType(decl string) (base string, args []int64) {
+	decl = strings.TrimSpace(decl)
+	open := strings.IndexByte(decl, '(')
+	if open < 0 || !strings.HasSuffix(decl, ")") {
+		return strings.ToUpper(decl), nil
+	}
+	base = strings.ToUpper(strings.TrimSpace(decl[:open]))
+	for _, arg := range strings.Split(decl[open+1:len(decl)-1], ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+		if err != nil {
+			return base, nil
+		}
+		args = append(args, n)
+	}
+	return base, args
 }
 
 const (
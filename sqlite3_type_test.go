@@ -0,0 +1,93 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestColumnTypeMetadata(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE foo (
+		id integer primary key autoincrement,
+		name varchar(32) not null collate nocase,
+		body text,
+		price decimal(10, 2),
+		qty numeric(5),
+		n integer
+	)`)
+	if err != nil {
+		t.Fatal("Failed to create table:", err)
+	}
+
+	rows, err := db.Query(`SELECT id, name, body, price, qty, n, n + 1 FROM foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type meta struct {
+		length           int64
+		lengthOK         bool
+		precision, scale int64
+		decimalOK        bool
+	}
+	expected := []meta{
+		{0, false, 0, 0, false},
+		{32, true, 0, 0, false},
+		{math.MaxInt64, true, 0, 0, false},
+		{0, false, 10, 2, true},
+		{0, false, 5, 0, true},
+		{0, false, 0, 0, false},
+		{0, false, 0, 0, false},
+	}
+	for i, ct := range types {
+		var got meta
+		got.length, got.lengthOK = ct.Length()
+		got.precision, got.scale, got.decimalOK = ct.DecimalSize()
+		if got != expected[i] {
+			t.Errorf("column %s: expected %+v, got %+v", ct.Name(), expected[i], got)
+		}
+	}	// An expression may be NULL, with or without column metadata.
+	if nullable, ok := types[6].Nullable(); !nullable || !ok {
+		t.Errorf("expected the expression to be nullable, got %v %v", nullable, ok)
+	}
+}
+
+func TestParseDeclType(t *testing.T) {
+	tests := []struct {
+		decl string
+		base string
+		args []int64
+	}{
+		{"varchar(255)", "VARCHAR", []int64{255}},
+		{" DECIMAL ( 10 , 2 ) ", "DECIMAL", []int64{10, 2}},
+		{"text", "TEXT", nil},
+		{"char(x)", "CHAR", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		base, args := parseDeclType(tt.decl)
+		if base != tt.base || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("parseDeclType(%q) = %q, %v, want %q, %v", tt.decl, base, args, tt.base, tt.args)
+		}
+	}
+}
@@ -0,0 +1,803 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct goVFS goVFS;
+
+// goVFS is a VFS implemented in Go. The methods without a Go counterpart
+// are forwarded to the default VFS at the time it was registered.
+struct goVFS {
+	sqlite3_vfs base;
+	sqlite3_vfs *pDefault;
+};
+
+typedef struct goVFSFile goVFSFile;
+
+struct goVFSFile {
+	sqlite3_file base;
+};
+
+#define GO_VFS_DEFAULT(p) (((goVFS*)(p))->pDefault)
+#define GO_VFS_FILE(p) ((void*)(p))
+
+int goVFSOpen(void *pVFS, char *zName, int flags, int *pOutFlags, void *pFile, int *pShm);
+int goVFSDelete(void *pVFS, char *zName, int syncDir);
+int goVFSAccess(void *pVFS, char *zName, int flags, int *pResOut);
+int goVFSFullPathname(void *pVFS, char *zName, int nOut, char *zOut);
+
+int goVFSClose(void *pFile);
+int goVFSRead(void *pFile, void *zBuf, int iAmt, sqlite3_int64 iOfst);
+int goVFSWrite(void *pFile, void *zBuf, int iAmt, sqlite3_int64 iOfst);
+int goVFSTruncate(void *pFile, sqlite3_int64 size);
+int goVFSSync(void *pFile, int flags);
+int goVFSFileSize(void *pFile, sqlite3_int64 *pSize);
+int goVFSLock(void *pFile, int eLock);
+int goVFSUnlock(void *pFile, int eLock);
+int goVFSCheckReservedLock(void *pFile, int *pResOut);
+int goVFSSectorSize(void *pFile);
+int goVFSDeviceCharacteristics(void *pFile);
+int goVFSFileControl(void *pFile, int op, void *pArg);
+int goVFSShmMap(void *pFile, int iPg, int pgsz, int bExtend, void **pp);
+int goVFSShmLock(void *pFile, int offset, int n, int flags);
+void goVFSShmBarrier(void *pFile);
+int goVFSShmUnmap(void *pFile, int deleteFlag);
+
+static int cVFSClose(sqlite3_file *pFile) {
+	return goVFSClose(GO_VFS_FILE(pFile));
+}
+
+static int cVFSRead(sqlite3_file *pFile, void *zBuf, int iAmt, sqlite3_int64 iOfst) {
+	return goVFSRead(GO_VFS_FILE(pFile), zBuf, iAmt, iOfst);
+}
+
+static int cVFSWrite(sqlite3_file *pFile, const void *zBuf, int iAmt, sqlite3_int64 iOfst) {
+	return goVFSWrite(GO_VFS_FILE(pFile), (void*)zBuf, iAmt, iOfst);
+}
+
+static int cVFSTruncate(sqlite3_file *pFile, sqlite3_int64 size) {
+	return goVFSTruncate(GO_VFS_FILE(pFile), size);
+}
+
+static int cVFSSync(sqlite3_file *pFile, int flags) {
+	return goVFSSync(GO_VFS_FILE(pFile), flags);
+}
+
+static int cVFSFileSize(sqlite3_file *pFile, sqlite3_int64 *pSize) {
+	return goVFSFileSize(GO_VFS_FILE(pFile), pSize);
+}
+
+static int cVFSLock(sqlite3_file *pFile, int eLock) {
+	return goVFSLock(GO_VFS_FILE(pFile), eLock);
+}
+
+static int cVFSUnlock(sqlite3_file *pFile, int eLock) {
+	return goVFSUnlock(GO_VFS_FILE(pFile), eLock);
+}
+
+static int cVFSCheckReservedLock(sqlite3_file *pFile, int *pResOut) {
+	return goVFSCheckReservedLock(GO_VFS_FILE(pFile), pResOut);
+}
+
+static int cVFSFileControl(sqlite3_file *pFile, int op, void *pArg) {
+	return goVFSFileControl(GO_VFS_FILE(pFile), op, pArg);
+}
+
+static int cVFSSectorSize(sqlite3_file *pFile) {
+	return goVFSSectorSize(GO_VFS_FILE(pFile));
+}
+
+static int cVFSDeviceCharacteristics(sqlite3_file *pFile) {
+	return goVFSDeviceCharacteristics(GO_VFS_FILE(pFile));
+}
+
+static int cVFSShmMap(sqlite3_file *pFile, int iPg, int pgsz, int bExtend, void volatile **pp) {
+	return goVFSShmMap(GO_VFS_FILE(pFile), iPg, pgsz, bExtend, (void**)pp);
+}
+
+static int cVFSShmLock(sqlite3_file *pFile, int offset, int n, int flags) {
+	return goVFSShmLock(GO_VFS_FILE(pFile), offset, n, flags);
+}
+
+static void cVFSShmBarrier(sqlite3_file *pFile) {
+	goVFSShmBarrier(GO_VFS_FILE(pFile));
+}
+
+static int cVFSShmUnmap(sqlite3_file *pFile, int deleteFlag) {
+	return goVFSShmUnmap(GO_VFS_FILE(pFile), deleteFlag);
+}
+
+static const sqlite3_io_methods goVFSIOMethods = {
+	1,                         // iVersion
+	cVFSClose,                 // xClose
+	cVFSRead,                  // xRead
+	cVFSWrite,                 // xWrite
+	cVFSTruncate,              // xTruncate
+	cVFSSync,                  // xSync
+	cVFSFileSize,              // xFileSize
+	cVFSLock,                  // xLock
+	cVFSUnlock,                // xUnlock
+	cVFSCheckReservedLock,     // xCheckReservedLock
+	cVFSFileControl,           // xFileControl
+	cVFSSectorSize,            // xSectorSize
+	cVFSDeviceCharacteristics, // xDeviceCharacteristics
+};
+
+// goVFSShmIOMethods are the methods of the files that implement
+// FileSharedMemory, which can be used in WAL mode.
+static const sqlite3_io_methods goVFSShmIOMethods = {
+	2,                         // iVersion
+	cVFSClose,                 // xClose
+	cVFSRead,                  // xRead
+	cVFSWrite,                 // xWrite
+	cVFSTruncate,              // xTruncate
+	cVFSSync,                  // xSync
+	cVFSFileSize,              // xFileSize
+	cVFSLock,                  // xLock
+	cVFSUnlock,                // xUnlock
+	cVFSCheckReservedLock,     // xCheckReservedLock
+	cVFSFileControl,           // xFileControl
+	cVFSSectorSize,            // xSectorSize
+	cVFSDeviceCharacteristics, // xDeviceCharacteristics
+	cVFSShmMap,                // xShmMap
+	cVFSShmLock,               // xShmLock
+	cVFSShmBarrier,            // xShmBarrier
+	cVFSShmUnmap,              // xShmUnmap
+};
+
+static int cVFSOpen(sqlite3_vfs *pVfs, const char *zName, sqlite3_file *pFile, int flags, int *pOutFlags) {
+	goVFSFile *p = (goVFSFile*)pFile;
+	p->base.pMethods = 0;
+	int shm = 0;
+	int rc = goVFSOpen(pVfs->pAppData, (char*)zName, flags, pOutFlags, pFile, &shm);
+	if (rc == SQLITE_OK) {
+		p->base.pMethods = shm ? &goVFSShmIOMethods : &goVFSIOMethods;
+	}
+	return rc;
+}
+
+static int cVFSDelete(sqlite3_vfs *pVfs, const char *zName, int syncDir) {
+	return goVFSDelete(pVfs->pAppData, (char*)zName, syncDir);
+}
+
+static int cVFSAccess(sqlite3_vfs *pVfs, const char *zName, int flags, int *pResOut) {
+	return goVFSAccess(pVfs->pAppData, (char*)zName, flags, pResOut);
+}
+
+static int cVFSFullPathname(sqlite3_vfs *pVfs, const char *zName, int nOut, char *zOut) {
+	return goVFSFullPathname(pVfs->pAppData, (char*)zName, nOut, zOut);
+}
+
+static void *cVFSDlOpen(sqlite3_vfs *pVfs, const char *zFilename) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xDlOpen(d, zFilename);
+}
+
+static void cVFSDlError(sqlite3_vfs *pVfs, int nByte, char *zErrMsg) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	d->xDlError(d, nByte, zErrMsg);
+}
+
+static void (*cVFSDlSym(sqlite3_vfs *pVfs, void *pHandle, const char *zSymbol))(void) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xDlSym(d, pHandle, zSymbol);
+}
+
+static void cVFSDlClose(sqlite3_vfs *pVfs, void *pHandle) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	d->xDlClose(d, pHandle);
+}
+
+static int cVFSRandomness(sqlite3_vfs *pVfs, int nByte, char *zOut) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xRandomness(d, nByte, zOut);
+}
+
+static int cVFSSleep(sqlite3_vfs *pVfs, int microseconds) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xSleep(d, microseconds);
+}
+
+static int cVFSCurrentTime(sqlite3_vfs *pVfs, double *pTime) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xCurrentTime(d, pTime);
+}
+
+static int cVFSGetLastError(sqlite3_vfs *pVfs, int nByte, char *zErrMsg) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	return d->xGetLastError ? d->xGetLastError(d, nByte, zErrMsg) : 0;
+}
+
+static int cVFSCurrentTimeInt64(sqlite3_vfs *pVfs, sqlite3_int64 *pTime) {
+	sqlite3_vfs *d = GO_VFS_DEFAULT(pVfs);
+	if (d->iVersion >= 2 && d->xCurrentTimeInt64) {
+		return d->xCurrentTimeInt64(d, pTime);
+	}
+	double t;
+	int rc = d->xCurrentTime(d, &t);
+	*pTime = (sqlite3_int64)(t * 86400000.0);
+	return rc;
+}
+
+static int _sqlite3_register_go_vfs(const char *zName, void *handle) {
+	sqlite3_vfs *pDefault = sqlite3_vfs_find(0);
+	if (pDefault == 0) {
+		return SQLITE_ERROR;
+	}
+	goVFS *p = (goVFS*)sqlite3_malloc(sizeof(goVFS) + strlen(zName) + 1);
+	if (p == 0) {
+		return SQLITE_NOMEM;
+	}
+	memset(p, 0, sizeof(goVFS));
+	char *name = (char*)&p[1];
+	strcpy(name, zName);
+	p->pDefault = pDefault;
+	p->base.iVersion = 2;
+	p->base.szOsFile = sizeof(goVFSFile);
+	p->base.mxPathname = pDefault->mxPathname;
+	p->base.zName = name;
+	p->base.pAppData = handle;
+	p->base.xOpen = cVFSOpen;
+	p->base.xDelete = cVFSDelete;
+	p->base.xAccess = cVFSAccess;
+	p->base.xFullPathname = cVFSFullPathname;
+	p->base.xDlOpen = cVFSDlOpen;
+	p->base.xDlError = cVFSDlError;
+	p->base.xDlSym = cVFSDlSym;
+	p->base.xDlClose = cVFSDlClose;
+	p->base.xRandomness = cVFSRandomness;
+	p->base.xSleep = cVFSSleep;
+	p->base.xCurrentTime = cVFSCurrentTime;
+	p->base.xGetLastError = cVFSGetLastError;
+	p->base.xCurrentTimeInt64 = cVFSCurrentTimeInt64;
+	int rc = sqlite3_vfs_register(&p->base, 0);
+	if (rc != SQLITE_OK) {
+		sqlite3_free(p);
+	}
+	return rc;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"unsafe"
+)
+
+// Flags passed to VFS.Open.
+// See: https://www.sqlite.org/c3ref/c_open_autoproxy.html
+const (
+	SQLITE_OPEN_READONLY       = C.SQLITE_OPEN_READONLY
+	SQLITE_OPEN_READWRITE      = C.SQLITE_OPEN_READWRITE
+	SQLITE_OPEN_CREATE         = C.SQLITE_OPEN_CREATE
+	SQLITE_OPEN_DELETEONCLOSE  = C.SQLITE_OPEN_DELETEONCLOSE
+	SQLITE_OPEN_EXCLUSIVE      = C.SQLITE_OPEN_EXCLUSIVE
+	SQLITE_OPEN_MAIN_DB        = C.SQLITE_OPEN_MAIN_DB
+	SQLITE_OPEN_TEMP_DB        = C.SQLITE_OPEN_TEMP_DB
+	SQLITE_OPEN_TRANSIENT_DB   = C.SQLITE_OPEN_TRANSIENT_DB
+	SQLITE_OPEN_MAIN_JOURNAL   = C.SQLITE_OPEN_MAIN_JOURNAL
+	SQLITE_OPEN_TEMP_JOURNAL   = C.SQLITE_OPEN_TEMP_JOURNAL
+	SQLITE_OPEN_SUBJOURNAL     = C.SQLITE_OPEN_SUBJOURNAL
+	SQLITE_OPEN_SUPER_JOURNAL  = 0x00004000
+	SQLITE_OPEN_WAL            = C.SQLITE_OPEN_WAL
+	SQLITE_OPEN_FILE_TYPE_MASK = 0x0007ff00
+)
+
+// Flags passed to VFS.Access.
+const (
+	SQLITE_ACCESS_EXISTS    = C.SQLITE_ACCESS_EXISTS
+	SQLITE_ACCESS_READWRITE = C.SQLITE_ACCESS_READWRITE
+	SQLITE_ACCESS_READ      = C.SQLITE_ACCESS_READ
+)
+
+// Lock levels passed to File.Lock and File.Unlock.
+// See: https://www.sqlite.org/c3ref/c_lock_exclusive.html
+const (
+	SQLITE_LOCK_NONE      = C.SQLITE_LOCK_NONE
+	SQLITE_LOCK_SHARED    = C.SQLITE_LOCK_SHARED
+	SQLITE_LOCK_RESERVED  = C.SQLITE_LOCK_RESERVED
+	SQLITE_LOCK_PENDING   = C.SQLITE_LOCK_PENDING
+	SQLITE_LOCK_EXCLUSIVE = C.SQLITE_LOCK_EXCLUSIVE
+)
+
+// Flags passed to File.Sync.
+// See: https://www.sqlite.org/c3ref/c_sync_dataonly.html
+const (
+	SQLITE_SYNC_NORMAL   = C.SQLITE_SYNC_NORMAL
+	SQLITE_SYNC_FULL     = C.SQLITE_SYNC_FULL
+	SQLITE_SYNC_DATAONLY = C.SQLITE_SYNC_DATAONLY
+)
+
+// Device characteristics returned by File.DeviceCharacteristics.
+// See: https://www.sqlite.org/c3ref/c_iocap_atomic.html
+const (
+	SQLITE_IOCAP_ATOMIC                = C.SQLITE_IOCAP_ATOMIC
+	SQLITE_IOCAP_ATOMIC512             = C.SQLITE_IOCAP_ATOMIC512
+	SQLITE_IOCAP_ATOMIC1K              = C.SQLITE_IOCAP_ATOMIC1K
+	SQLITE_IOCAP_ATOMIC2K              = C.SQLITE_IOCAP_ATOMIC2K
+	SQLITE_IOCAP_ATOMIC4K              = C.SQLITE_IOCAP_ATOMIC4K
+	SQLITE_IOCAP_ATOMIC8K              = C.SQLITE_IOCAP_ATOMIC8K
+	SQLITE_IOCAP_ATOMIC16K             = C.SQLITE_IOCAP_ATOMIC16K
+	SQLITE_IOCAP_ATOMIC32K             = C.SQLITE_IOCAP_ATOMIC32K
+	SQLITE_IOCAP_ATOMIC64K             = C.SQLITE_IOCAP_ATOMIC64K
+	SQLITE_IOCAP_SAFE_APPEND           = C.SQLITE_IOCAP_SAFE_APPEND
+	SQLITE_IOCAP_SEQUENTIAL            = C.SQLITE_IOCAP_SEQUENTIAL
+	SQLITE_IOCAP_UNDELETABLE_WHEN_OPEN = C.SQLITE_IOCAP_UNDELETABLE_WHEN_OPEN
+	SQLITE_IOCAP_POWERSAFE_OVERWRITE   = C.SQLITE_IOCAP_POWERSAFE_OVERWRITE
+	SQLITE_IOCAP_IMMUTABLE             = C.SQLITE_IOCAP_IMMUTABLE
+	SQLITE_IOCAP_BATCH_ATOMIC          = 0x00004000
+)
+
+// Flags passed to FileSharedMemory.ShmLock.
+// See: https://www.sqlite.org/c3ref/c_shm_exclusive.html
+const (
+	SQLITE_SHM_UNLOCK    = C.SQLITE_SHM_UNLOCK
+	SQLITE_SHM_LOCK      = C.SQLITE_SHM_LOCK
+	SQLITE_SHM_SHARED    = C.SQLITE_SHM_SHARED
+	SQLITE_SHM_EXCLUSIVE = C.SQLITE_SHM_EXCLUSIVE
+)
+
+// VFS is a virtual file system implemented in Go, registered with
+// RegisterVFS and selected with the vfs parameter of the data source name,
+// for example "file:test.db?vfs=myvfs".
+//
+// The methods mirror those of sqlite3_vfs, and may be called concurrently
+// by several connections. An error wrapping an Error, ErrNo or
+// ErrNoExtended reports that code to SQLite; any other error reports the
+// I/O error code of the method, such as ErrIoErrDelete for Delete.
+// See: https://www.sqlite.org/c3ref/vfs.html
+type VFS interface {
+	// Open opens the file name with the SQLITE_OPEN_* flags and returns
+	// it along with the flags it was actually opened with, usually flags
+	// itself. name is empty for temporary files, which are then opened
+	// with SQLITE_OPEN_DELETEONCLOSE.
+	Open(name string, flags int) (File, int, error)
+	// Delete deletes the file name, which is synced to its directory if
+	// syncDir is true. Deleting a file that does not exist returns an
+	// error wrapping fs.ErrNotExist.
+	Delete(name string, syncDir bool) error
+	// Access reports whether the file name exists, or can be read and
+	// written, or read, depending on the SQLITE_ACCESS_* flag.
+	Access(name string, flag int) (bool, error)
+	// FullPathname returns the canonical form of name.
+	FullPathname(name string) (string, error)
+}
+
+// File is a file opened by a VFS. It mirrors sqlite3_io_methods. The
+// slices passed to ReadAt and WriteAt point into memory owned by SQLite,
+// and must not be retained after the call.
+// See: https://www.sqlite.org/c3ref/io_methods.html
+type File interface {
+	Close() error
+	// ReadAt reads len(p) bytes at off. A short read returns the bytes
+	// read and io.EOF; SQLite sees the rest of p as zeros.
+	ReadAt(p []byte, off int64) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Truncate(size int64) error
+	// Sync flushes the file with the SQLITE_SYNC_* flags.
+	Sync(flags int) error
+	FileSize() (int64, error)
+	// Lock raises the lock of the file to the SQLITE_LOCK_* level, and
+	// returns ErrBusy if another connection holds a conflicting lock.
+	Lock(level int) error
+	// Unlock lowers the lock of the file to the SQLITE_LOCK_* level.
+	Unlock(level int) error
+	// CheckReservedLock reports whether any connection holds a reserved
+	// or higher lock on the file.
+	CheckReservedLock() (bool, error)
+	SectorSize() int
+	// DeviceCharacteristics returns the SQLITE_IOCAP_* flags of the file.
+	DeviceCharacteristics() int
+}
+
+// Filename is the name of a file opened by SQLite, which also carries the
+// URI parameters of the database the file belongs to. It stays valid until
+// the file is closed.
+type Filename struct {
+	p *C.char
+}
+
+// String returns the name of the file, or "" for a temporary file.
+func (n *Filename) String() string {
+	if n == nil || n.p == nil {
+		return ""
+	}
+	return C.GoString(n.p)
+}
+
+// URIParameter returns the value of the URI parameter key of the database,
+// or "" if it was not given.
+func (n *Filename) URIParameter(key string) string {
+	if n == nil || n.p == nil {
+		return ""
+	}
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	v := C.sqlite3_uri_parameter(n.p, ckey)
+	if v == nil {
+		return ""
+	}
+	return C.GoString(v)
+}
+
+// Database returns the name of the database file that a journal or WAL
+// file belongs to, or the name of the file itself for a database.
+func (n *Filename) Database() string {
+	if n == nil || n.p == nil {
+		return ""
+	}
+	return C.GoString(C.sqlite3_filename_database(n.p))
+}
+
+// VFSFilenameOpener is a VFS that opens files with their Filename, to read
+// the URI parameters of the database or to hand the name on to the VFS
+// returned by FindVFS. SQLite then calls OpenFilename instead of Open.
+type VFSFilenameOpener interface {
+	VFS
+	OpenFilename(name *Filename, flags int) (File, int, error)
+}
+
+// VFSReserver is a VFS that stores data of its own at the end of the pages
+// of the databases. Connections opened with it in the vfs parameter ask
+// SQLite to reserve ReserveBytes bytes per page, which applies when the
+// database is created or vacuumed.
+type VFSReserver interface {
+	VFS
+	ReserveBytes() int
+}
+
+// FileController is a File that handles file controls, such as those sent
+// with SQLiteConn.FileControl. FileControl returns ErrNotFound for the
+// operations it does not know.
+// See: https://www.sqlite.org/c3ref/file_control.html
+type FileController interface {
+	File
+	FileControl(op int, arg unsafe.Pointer) error
+}
+
+// FileSharedMemory is a File that provides the shared memory used by
+// databases in WAL mode. The methods mirror the xShm methods of
+// sqlite3_io_methods. ShmMap must return memory allocated outside of Go,
+// with C.malloc or mmap for example, since SQLite keeps the pointer; the
+// memory must stay valid until ShmUnmap, and each call for a region must
+// return the same pointer.
+// See: https://www.sqlite.org/c3ref/io_methods.html
+type FileSharedMemory interface {
+	File
+	ShmMap(region, size int, extend bool) (unsafe.Pointer, error)
+	ShmLock(offset, n, flags int) error
+	ShmBarrier()
+	ShmUnmap(delete bool) error
+}
+
+// vfsEntry is the registration of a Go VFS. Registering a VFS again under
+// the same name replaces vfs for the files opened afterwards.
+type vfsEntry struct {
+	name string
+	vfs  VFS
+}
+
+var vfsRegistry = struct {
+	sync.RWMutex
+	entries map[string]*vfsEntry
+}{entries: map[string]*vfsEntry{}}
+
+// RegisterVFS registers vfs with SQLite under name. Registering another VFS
+// under the name of a Go VFS replaces it for the files opened afterwards;
+// the name of a VFS of SQLite itself, such as "unix", cannot be reused.
+func RegisterVFS(name string, vfs VFS) error {
+	if name == "" {
+		return errors.New("sqlite3: VFS name is empty")
+	}
+	if vfs == nil {
+		return errors.New("sqlite3: VFS is nil")
+	}
+	vfsRegistry.Lock()
+	defer vfsRegistry.Unlock()
+	if e, ok := vfsRegistry.entries[name]; ok {
+		e.vfs = vfs
+		return nil
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	if C.sqlite3_vfs_find(cname) != nil {
+		return fmt.Errorf("sqlite3: VFS %q already exists", name)
+	}
+	e := &vfsEntry{name: name, vfs: vfs}
+	handle := newHandle(nil, e)
+	if rv := C._sqlite3_register_go_vfs(cname, handle); rv != C.SQLITE_OK {
+		deleteHandle(handle)
+		return Error{Code: ErrNo(rv)}
+	}
+	vfsRegistry.entries[name] = e
+	return nil
+}
+
+func lookupVFS(pVFS unsafe.Pointer) VFS {
+	e := lookupHandle(pVFS).(*vfsEntry)
+	vfsRegistry.RLock()
+	defer vfsRegistry.RUnlock()
+	return e.vfs
+}
+
+// reserveVFSBytes asks SQLite to reserve the bytes needed by the VFS name,
+// the checksum VFS or a Go VFSReserver, in the pages of the main database.
+func (c *SQLiteConn) reserveVFSBytes(name string) error {
+	if name == CksumVFSName {
+		return c.SetFileControlInt("main", SQLITE_FCNTL_RESERVE_BYTES, CksumVFSReserveBytes)
+	}
+	vfsRegistry.RLock()
+	e, ok := vfsRegistry.entries[name]
+	var r VFSReserver
+	if ok {
+		r, ok = e.vfs.(VFSReserver)
+	}
+	vfsRegistry.RUnlock()
+	if !ok {
+		return nil
+	}
+	return c.SetFileControlInt("main", SQLITE_FCNTL_RESERVE_BYTES, r.ReserveBytes())
+}
+
+// vfsFiles holds the files open in Go VFSes by their sqlite3_file, apart
+// from the handles of callback.go so that opening and closing a file does
+// not copy those.
+var vfsFiles = struct {
+	sync.RWMutex
+	files map[unsafe.Pointer]File
+}{files: map[unsafe.Pointer]File{}}
+
+func lookupVFSFile(pFile unsafe.Pointer) File {
+	vfsFiles.RLock()
+	defer vfsFiles.RUnlock()
+	return vfsFiles.files[pFile]
+}
+
+func vfsResult(err error, def ErrNoExtended) C.int {
+	if err == nil {
+		return C.SQLITE_OK
+	}
+	return C.int(errorCode(err, int(def)))
+}
+
+//export goVFSOpen
+func goVFSOpen(pVFS unsafe.Pointer, zName *C.char, flags C.int, pOutFlags *C.int, pFile unsafe.Pointer, pShm *C.int) C.int {
+	var (
+		f   File
+		out int
+		err error
+	)
+	switch vfs := lookupVFS(pVFS).(type) {
+	case VFSFilenameOpener:
+		f, out, err = vfs.OpenFilename(&Filename{zName}, int(flags))
+	default:
+		var name string
+		if zName != nil {
+			name = C.GoString(zName)
+		}
+		f, out, err = vfs.Open(name, int(flags))
+	}
+	if err != nil {
+		return vfsResult(err, ErrNoExtended(ErrCantOpen))
+	}
+	if f == nil {
+		return C.SQLITE_CANTOPEN
+	}
+	if pOutFlags != nil {
+		*pOutFlags = C.int(out)
+	}
+	if _, ok := f.(FileSharedMemory); ok {
+		*pShm = 1
+	}
+	vfsFiles.Lock()
+	vfsFiles.files[pFile] = f
+	vfsFiles.Unlock()
+	return C.SQLITE_OK
+}
+
+//export goVFSDelete
+func goVFSDelete(pVFS unsafe.Pointer, zName *C.char, syncDir C.int) C.int {
+	err := lookupVFS(pVFS).Delete(C.GoString(zName), syncDir != 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return C.int(ErrIoErrDeleteNoent)
+	}
+	return vfsResult(err, ErrIoErrDelete)
+}
+
+//export goVFSAccess
+func goVFSAccess(pVFS unsafe.Pointer, zName *C.char, flags C.int, pResOut *C.int) C.int {
+	ok, err := lookupVFS(pVFS).Access(C.GoString(zName), int(flags))
+	*pResOut = 0
+	if ok {
+		*pResOut = 1
+	}
+	return vfsResult(err, ErrIoErrAccess)
+}
+
+//export goVFSFullPathname
+func goVFSFullPathname(pVFS unsafe.Pointer, zName *C.char, nOut C.int, zOut *C.char) C.int {
+	path, err := lookupVFS(pVFS).FullPathname(C.GoString(zName))
+	if err != nil {
+		return vfsResult(err, ErrNoExtended(ErrCantOpen))
+	}
+	if len(path) >= int(nOut) {
+		return C.SQLITE_CANTOPEN
+	}
+	out := unsafe.Slice((*byte)(unsafe.Pointer(zOut)), int(nOut))
+	out[copy(out, path)] = 0
+	return C.SQLITE_OK
+}
+
+//export goVFSClose
+func goVFSClose(pFile unsafe.Pointer) C.int {
+	err := lookupVFSFile(pFile).Close()
+	vfsFiles.Lock()
+	delete(vfsFiles.files, pFile)
+	vfsFiles.Unlock()
+	return vfsResult(err, ErrIoErrClose)
+}
+
+//export goVFSRead
+func goVFSRead(pFile unsafe.Pointer, zBuf unsafe.Pointer, iAmt C.int, iOfst C.sqlite3_int64) C.int {
+	p := unsafe.Slice((*byte)(zBuf), int(iAmt))
+	n, err := lookupVFSFile(pFile).ReadAt(p, int64(iOfst))
+	if n < len(p) && (err == nil || errors.Is(err, io.EOF)) {
+		clear(p[n:])
+		return C.int(ErrIoErrShortRead)
+	}
+	if n == len(p) && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return vfsResult(err, ErrIoErrRead)
+}
+
+//export goVFSWrite
+func goVFSWrite(pFile unsafe.Pointer, zBuf unsafe.Pointer, iAmt C.int, iOfst C.sqlite3_int64) C.int {
+	p := unsafe.Slice((*byte)(zBuf), int(iAmt))
+	n, err := lookupVFSFile(pFile).WriteAt(p, int64(iOfst))
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return vfsResult(err, ErrIoErrWrite)
+}
+
+//export goVFSTruncate
+func goVFSTruncate(pFile unsafe.Pointer, size C.sqlite3_int64) C.int {
+	return vfsResult(lookupVFSFile(pFile).Truncate(int64(size)), ErrIoErrTruncate)
+}
+
+//export goVFSSync
+func goVFSSync(pFile unsafe.Pointer, flags C.int) C.int {
+	return vfsResult(lookupVFSFile(pFile).Sync(int(flags)), ErrIoErrFsync)
+}
+
+//export goVFSFileSize
+func goVFSFileSize(pFile unsafe.Pointer, pSize *C.sqlite3_int64) C.int {
+	size, err := lookupVFSFile(pFile).FileSize()
+	*pSize = C.sqlite3_int64(size)
+	return vfsResult(err, ErrIoErrFstat)
+}
+
+//export goVFSLock
+func goVFSLock(pFile unsafe.Pointer, eLock C.int) C.int {
+	return vfsResult(lookupVFSFile(pFile).Lock(int(eLock)), ErrIoErrLock)
+}
+
+//export goVFSUnlock
+func goVFSUnlock(pFile unsafe.Pointer, eLock C.int) C.int {
+	return vfsResult(lookupVFSFile(pFile).Unlock(int(eLock)), ErrIoErrUnlock)
+}
+
+//export goVFSCheckReservedLock
+func goVFSCheckReservedLock(pFile unsafe.Pointer, pResOut *C.int) C.int {
+	ok, err := lookupVFSFile(pFile).CheckReservedLock()
+	*pResOut = 0
+	if ok {
+		*pResOut = 1
+	}
+	return vfsResult(err, ErrIoErrCheckReservedLock)
+}
+
+//export goVFSSectorSize
+func goVFSSectorSize(pFile unsafe.Pointer) C.int {
+	return C.int(lookupVFSFile(pFile).SectorSize())
+}
+
+//export goVFSDeviceCharacteristics
+func goVFSDeviceCharacteristics(pFile unsafe.Pointer) C.int {
+	return C.int(lookupVFSFile(pFile).DeviceCharacteristics())
+}
+
+//export goVFSFileControl
+func goVFSFileControl(pFile unsafe.Pointer, op C.int, pArg unsafe.Pointer) C.int {
+	f, ok := lookupVFSFile(pFile).(FileController)
+	if !ok {
+		return C.SQLITE_NOTFOUND
+	}
+	return vfsResult(f.FileControl(int(op), pArg), ErrNoExtended(ErrError))
+}
+
+//export goVFSShmMap
+func goVFSShmMap(pFile unsafe.Pointer, iPg, pgsz, bExtend C.int, pp *unsafe.Pointer) C.int {
+	p, err := lookupVFSFile(pFile).(FileSharedMemory).ShmMap(int(iPg), int(pgsz), bExtend != 0)
+	*pp = p
+	return vfsResult(err, ErrIoErrSHMMap)
+}
+
+//export goVFSShmLock
+func goVFSShmLock(pFile unsafe.Pointer, offset, n, flags C.int) C.int {
+	err := lookupVFSFile(pFile).(FileSharedMemory).ShmLock(int(offset), int(n), int(flags))
+	return vfsResult(err, ErrIoErrSHMLock)
+}
+
+//export goVFSShmBarrier
+func goVFSShmBarrier(pFile unsafe.Pointer) {
+	lookupVFSFile(pFile).(FileSharedMemory).ShmBarrier()
+}
+
+//export goVFSShmUnmap
+func goVFSShmUnmap(pFile unsafe.Pointer, deleteFlag C.int) C.int {
+	return vfsResult(lookupVFSFile(pFile).(FileSharedMemory).ShmUnmap(deleteFlag != 0), ErrIoErrSHMOpen)
+}
+
+// vfsTempFile is a temporary file kept in memory, for the Go VFSes whose
+// temporary files must not reach the disk.
+type vfsTempFile struct {
+	data []byte
+}
+
+func (f *vfsTempFile) Close() error {
+	f.data = nil
+	return nil
+}
+
+func (f *vfsTempFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *vfsTempFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *vfsTempFile) Truncate(size int64) error {
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	}
+	return nil
+}
+
+func (f *vfsTempFile) Sync(flags int) error             { return nil }
+func (f *vfsTempFile) FileSize() (int64, error)         { return int64(len(f.data)), nil }
+func (f *vfsTempFile) Lock(level int) error             { return nil }
+func (f *vfsTempFile) Unlock(level int) error           { return nil }
+func (f *vfsTempFile) CheckReservedLock() (bool, error) { return false, nil }
+func (f *vfsTempFile) SectorSize() int                  { return 512 }
+func (f *vfsTempFile) DeviceCharacteristics() int       { return SQLITE_IOCAP_SAFE_APPEND }
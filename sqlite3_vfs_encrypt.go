@@ -0,0 +1,588 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	encryptNonceSize = 12
+	encryptTagSize   = 16
+
+	// EncryptedVFSReserveBytes is the number of bytes at the end of every
+	// page in which an encrypting VFS stores the nonce and the
+	// authentication tag of the page.
+	EncryptedVFSReserveBytes = encryptNonceSize + encryptTagSize
+)
+
+// sqliteHeader starts the first page of every database.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// EncryptedVFSConfig configures an encrypting VFS.
+type EncryptedVFSConfig struct {
+	// Base is the name of the VFS that stores the encrypted files, or ""
+	// for the default VFS.
+	Base string
+	// Key returns the AES key of the database file name, when its data
+	// source name has no _key parameter.
+	Key func(name string) ([]byte, error)
+}
+
+// RegisterEncryptedVFS registers a VFS under name that encrypts the
+// databases it stores on top of the VFS config.Base.
+//
+// Every page is encrypted with AES-GCM, with a 16, 24 or 32 byte key given
+// in hexadecimal by the _key parameter of the data source name, or else
+// returned by config.Key:
+//
+//	file:secret.db?vfs=encrypted&_key=000102030405060708090a0b0c0d0e0f
+//
+// The random nonce and the tag of each page are kept in its last
+// EncryptedVFSReserveBytes bytes, which the connections opened with the VFS
+// reserve in new databases with SQLITE_FCNTL_RESERVE_BYTES. A database
+// created without them, such as an existing plain database, cannot be
+// opened with the VFS; use RekeyTo to make an encrypted copy of it.
+//
+// The pages in the rollback journal and the WAL are encrypted as well; the
+// first 100 bytes of the database, which describe its format, and the
+// headers of the journal and of the WAL frames are not. Temporary files
+// are kept in memory. Reading a page with the wrong key fails with
+// ErrNotADB for the first page and ErrCorrupt for the others, as does
+// reading a page that was damaged or zeroed.
+func RegisterEncryptedVFS(name string, config EncryptedVFSConfig) error {
+	base, err := FindVFS(config.Base)
+	if err != nil {
+		return err
+	}
+	return RegisterVFS(name, &encryptedVFS{
+		base: base.(VFSFilenameOpener),
+		key:  config.Key,
+		dbs:  map[string]*encryptedDB{},
+	})
+}
+
+// RekeyTo writes a copy of the main database of the connection to
+// destPath, encrypted with key by the encrypting VFS vfsName. Replacing the
+// database with the copy, once no connection uses it, changes its key, or
+// encrypts it if it was a plain database.
+//
+// The copy is made with BackupTo if the database already reserves
+// EncryptedVFSReserveBytes bytes per page, as an encrypted database does.
+// Otherwise it is made with VACUUM INTO, which reserves them, and destPath
+// must not exist; the reserved bytes requested for the database of the
+// connection are restored afterwards.
+func (c *SQLiteConn) RekeyTo(ctx context.Context, destPath, vfsName string, key []byte) error {
+	dsn := "file:" + uriPathEscaper.Replace(destPath) +
+		"?vfs=" + url.QueryEscape(vfsName) + "&_key=" + hex.EncodeToString(key)
+	n, err := c.requestedReserveBytes()
+	if err != nil {
+		return err
+	}
+	if n >= EncryptedVFSReserveBytes {
+		return c.BackupTo(ctx, dsn, BackupOptions{})
+	}
+	if err := c.SetFileControlInt("main", SQLITE_FCNTL_RESERVE_BYTES, EncryptedVFSReserveBytes); err != nil {
+		return err
+	}
+	_, err = c.exec(ctx, "VACUUM main INTO ?", []driver.NamedValue{{Ordinal: 1, Value: dsn}})
+	// Restore the request, which a later VACUUM of the database would
+	// follow.
+	if rerr := c.SetFileControlInt("main", SQLITE_FCNTL_RESERVE_BYTES, n); rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// uriPathEscaper escapes the characters of a path that have a meaning in a
+// URI filename.
+var uriPathEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// requestedReserveBytes returns the number of bytes reserved per page in
+// the main database, or the number requested for it if larger.
+func (c *SQLiteConn) requestedReserveBytes() (int, error) {
+	schema := C.CString("main")
+	defer C.free(unsafe.Pointer(schema))
+	n := C.int(-1)
+	if rv := C.sqlite3_file_control(c.db, schema, C.SQLITE_FCNTL_RESERVE_BYTES, unsafe.Pointer(&n)); rv != C.SQLITE_OK {
+		return 0, c.lastError()
+	}
+	return int(n), nil
+}
+
+type encryptedVFS struct {
+	base VFSFilenameOpener
+	key  func(name string) ([]byte, error)
+
+	mu  sync.Mutex
+	dbs map[string]*encryptedDB
+}
+
+// encryptedDB is shared by the files of a database, which all need its page
+// size.
+type encryptedDB struct {
+	name     string
+	pageSize atomic.Int64
+	refs     int
+}
+
+// Open implements VFS. SQLite opens the files with OpenFilename, which
+// has the _key parameter.
+func (v *encryptedVFS) Open(name string, flags int) (File, int, error) {
+	return nil, 0, ErrCantOpen
+}
+
+// OpenFilename implements VFSFilenameOpener.
+func (v *encryptedVFS) OpenFilename(name *Filename, flags int) (File, int, error) {
+	const encrypted = SQLITE_OPEN_MAIN_DB | SQLITE_OPEN_MAIN_JOURNAL | SQLITE_OPEN_WAL
+	const temporary = SQLITE_OPEN_TEMP_DB | SQLITE_OPEN_TEMP_JOURNAL | SQLITE_OPEN_SUBJOURNAL | SQLITE_OPEN_TRANSIENT_DB
+	switch {
+	case flags&temporary != 0 || name.String() == "":
+		return &vfsTempFile{}, flags, nil
+	case flags&encrypted == 0:
+		// Super-journals only hold the names of journals.
+		return v.base.OpenFilename(name, flags)
+	}
+	aead, err := v.cipher(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, out, err := v.base.OpenFilename(name, flags)
+	if err != nil {
+		return nil, 0, err
+	}
+	ef := &encryptedFile{
+		File: f,
+		vfs:  v,
+		db:   v.acquire(name.Database()),
+		aead: aead,
+		kind: flags & encrypted,
+	}
+	if _, ok := f.(FileSharedMemory); ok {
+		return encryptedFileShm{ef}, out, nil
+	}
+	return ef, out, nil
+}
+
+// Delete implements VFS.
+func (v *encryptedVFS) Delete(name string, syncDir bool) error {
+	return v.base.Delete(name, syncDir)
+}
+
+// Access implements VFS.
+func (v *encryptedVFS) Access(name string, flag int) (bool, error) {
+	return v.base.Access(name, flag)
+}
+
+// FullPathname implements VFS.
+func (v *encryptedVFS) FullPathname(name string) (string, error) {
+	return v.base.FullPathname(name)
+}
+
+// ReserveBytes implements VFSReserver.
+func (v *encryptedVFS) ReserveBytes() int {
+	return EncryptedVFSReserveBytes
+}
+
+func (v *encryptedVFS) cipher(name *Filename) (cipher.AEAD, error) {
+	var key []byte
+	if s := name.URIParameter("_key"); s != "" {
+		k, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite3: invalid _key: %v", err)
+		}
+		key = k
+	} else if v.key != nil {
+		k, err := v.key(name.Database())
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	}
+	if key == nil {
+		return nil, fmt.Errorf("sqlite3: no key for %q", name.Database())
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *encryptedVFS) acquire(name string) *encryptedDB {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	db, ok := v.dbs[name]
+	if !ok {
+		db = &encryptedDB{name: name}
+		v.dbs[name] = db
+	}
+	db.refs++
+	return db
+}
+
+func (v *encryptedVFS) release(db *encryptedDB) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if db.refs--; db.refs == 0 {
+		delete(v.dbs, db.name)
+	}
+}
+
+// encryptedFile is a database, journal or WAL file of an encrypting VFS.
+// kind is SQLITE_OPEN_MAIN_DB, SQLITE_OPEN_MAIN_JOURNAL or SQLITE_OPEN_WAL.
+type encryptedFile struct {
+	File
+	vfs  *encryptedVFS
+	db   *encryptedDB
+	aead cipher.AEAD
+	kind int
+	buf  []byte
+	ad   []byte
+}
+
+// encryptedFileShm is an encryptedFile whose base file provides shared
+// memory.
+type encryptedFileShm struct {
+	*encryptedFile
+}
+
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+// pageSize returns the page size of the database, or 0 if the database is
+// still empty.
+func (f *encryptedFile) pageSize() (int64, error) {
+	if ps := f.db.pageSize.Load(); ps != 0 {
+		return ps, nil
+	}
+	if f.kind != SQLITE_OPEN_MAIN_DB {
+		return 0, nil
+	}
+	var b [2]byte
+	n, err := f.File.ReadAt(b[:], 16)
+	if n < len(b) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return 0, err
+	}
+	ps := headerPageSize(b[:])
+	f.db.pageSize.Store(ps)
+	return ps, nil
+}
+
+// headerPageSize decodes the page size stored at offset 16 of a database.
+func headerPageSize(b []byte) int64 {
+	ps := int64(binary.BigEndian.Uint16(b))
+	if ps == 1 {
+		ps = 65536
+	}
+	if ps < 512 || ps&(ps-1) != 0 {
+		return 0
+	}
+	return ps
+}
+
+// page returns the offset of the page that holds the byte at off, or of the
+// next page if off is in the header of the WAL or of a frame.
+func (f *encryptedFile) page(off, ps int64) (start int64, ok bool) {
+	if f.kind == SQLITE_OPEN_MAIN_DB {
+		return off - off%ps, true
+	}
+	if off < walHeaderSize {
+		return walHeaderSize + walFrameHeaderSize, false
+	}
+	start = off - (off-walHeaderSize)%(walFrameHeaderSize+ps) + walFrameHeaderSize
+	return start, off >= start
+}
+
+// plain returns the number of bytes at the start of the page at off that
+// are not encrypted.
+func (f *encryptedFile) plain(off int64) int {
+	if f.kind == SQLITE_OPEN_MAIN_DB && off == 0 {
+		return 100
+	}
+	return 0
+}
+
+// journalPage reports whether a read or write of n bytes at off in the
+// rollback journal is a page: the journal headers are at multiples of the
+// sector size, and the pages follow a 4 byte page number in 8 + page size
+// records after them, so never start at a multiple of 512.
+func journalPage(n int, off, ps int64) bool {
+	return int64(n) == ps && off%512 != 0
+}
+
+func (f *encryptedFile) additionalData(plain []byte, off int64) []byte {
+	f.ad = binary.BigEndian.AppendUint64(f.ad[:0], uint64(off))
+	return append(f.ad, plain...)
+}
+
+func (f *encryptedFile) buffer(ps int64) []byte {
+	if int64(cap(f.buf)) < ps {
+		f.buf = make([]byte, ps)
+	}
+	return f.buf[:ps]
+}
+
+// decrypt decrypts the page b at off in place. A page of zeros is left as
+// it is if it was never written: the file holds nothing but zeros after it,
+// as when it was extended without writing. A page that was zeroed in the
+// middle of the file fails to decrypt like any other damaged page.
+func (f *encryptedFile) decrypt(b []byte, off int64) error {
+	if isZero(b) {
+		tail, err := f.zeroTail(off + int64(len(b)))
+		if err != nil {
+			return err
+		}
+		if tail {
+			return nil
+		}
+	}
+	hdr := f.plain(off)
+	end := len(b) - encryptNonceSize
+	_, err := f.aead.Open(b[hdr:hdr], b[end:], b[hdr:end], f.additionalData(b[:hdr], off))
+	if err != nil {
+		if f.kind == SQLITE_OPEN_MAIN_DB && off == 0 {
+			return ErrNotADB
+		}
+		return ErrCorrupt
+	}
+	clear(b[len(b)-EncryptedVFSReserveBytes:])
+	return nil
+}
+
+// zeroTail reports whether the file holds only zeros from off to its end.
+func (f *encryptedFile) zeroTail(off int64) (bool, error) {
+	b := make([]byte, 64<<10)
+	for {
+		n, err := f.File.ReadAt(b, off)
+		if !isZero(b[:n]) {
+			return false, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return true, nil
+			}
+			return false, err
+		}
+		if n == 0 {
+			return true, nil
+		}
+		off += int64(n)
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// encrypt encrypts the page src at off into dst, which may be src.
+func (f *encryptedFile) encrypt(dst, src []byte, off int64) error {
+	if bytes.HasPrefix(src, sqliteHeader) && src[20] < EncryptedVFSReserveBytes {
+		return fmt.Errorf("sqlite3: database reserves %d bytes per page, encryption needs %d", src[20], EncryptedVFSReserveBytes)
+	}
+	hdr := f.plain(off)
+	end := len(src) - EncryptedVFSReserveBytes
+	copy(dst, src[:end])
+	nonce := dst[len(dst)-encryptNonceSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	f.aead.Seal(dst[hdr:hdr], nonce, dst[hdr:end], f.additionalData(dst[:hdr], off))
+	return nil
+}
+
+// ReadAt implements File.
+func (f *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	ps, err := f.pageSize()
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.File.ReadAt(p, off)
+	if ps == 0 || (err != nil && !errors.Is(err, io.EOF)) {
+		return n, err
+	}
+	if f.kind == SQLITE_OPEN_MAIN_JOURNAL {
+		if journalPage(n, off, ps) {
+			if derr := f.decrypt(p, off); derr != nil {
+				return 0, derr
+			}
+		}
+		return n, err
+	}
+	end := off + int64(n)
+	for pos := off; pos < end; {
+		start, ok := f.page(pos, ps)
+		if !ok {
+			pos = start
+			continue
+		}
+		pend := start + ps
+		if start >= off && pend <= end {
+			if derr := f.decrypt(p[start-off:pend-off], start); derr != nil {
+				return 0, derr
+			}
+		} else {
+			// Only part of the page was asked for.
+			b := f.buffer(ps)
+			m, rerr := f.File.ReadAt(b, start)
+			if rerr != nil && !errors.Is(rerr, io.EOF) {
+				return 0, rerr
+			}
+			if int64(m) < ps {
+				clear(b)
+			} else if derr := f.decrypt(b, start); derr != nil {
+				return 0, derr
+			}
+			from, to := max(start, off), min(pend, end)
+			copy(p[from-off:to-off], b[from-start:to-start])
+		}
+		pos = pend
+	}
+	return n, err
+}
+
+// WriteAt implements File. A write of part of a page decrypts the page,
+// updates it and encrypts it again.
+func (f *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.kind == SQLITE_OPEN_MAIN_DB && off == 0 && len(p) >= 18 {
+		if ps := headerPageSize(p[16:18]); ps != 0 {
+			f.db.pageSize.Store(ps)
+		}
+	}
+	ps, err := f.pageSize()
+	if err != nil {
+		return 0, err
+	}
+	if ps == 0 {
+		if f.kind == SQLITE_OPEN_MAIN_DB {
+			return 0, errors.New("sqlite3: page size of the database is unknown")
+		}
+		return f.File.WriteAt(p, off)
+	}
+	if f.kind == SQLITE_OPEN_MAIN_JOURNAL {
+		if !journalPage(len(p), off, ps) {
+			return f.File.WriteAt(p, off)
+		}
+		b := f.buffer(ps)
+		if err := f.encrypt(b, p, off); err != nil {
+			return 0, err
+		}
+		if _, err := f.File.WriteAt(b, off); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	end := off + int64(len(p))
+	for pos := off; pos < end; {
+		start, ok := f.page(pos, ps)
+		if !ok {
+			to := min(start, end)
+			if _, err := f.File.WriteAt(p[pos-off:to-off], pos); err != nil {
+				return 0, err
+			}
+			pos = to
+			continue
+		}
+		pend := start + ps
+		b := f.buffer(ps)
+		src := b
+		if start >= off && pend <= end {
+			src = p[start-off : pend-off]
+		} else {
+			m, rerr := f.File.ReadAt(b, start)
+			if rerr != nil && !errors.Is(rerr, io.EOF) {
+				return 0, rerr
+			}
+			if int64(m) < ps {
+				clear(b)
+			} else if derr := f.decrypt(b, start); derr != nil {
+				return 0, derr
+			}
+			from, to := max(start, off), min(pend, end)
+			copy(b[from-start:to-start], p[from-off:to-off])
+		}
+		if err := f.encrypt(b, src, start); err != nil {
+			return 0, err
+		}
+		if _, err := f.File.WriteAt(b, start); err != nil {
+			return 0, err
+		}
+		pos = pend
+	}
+	return len(p), nil
+}
+
+// Close implements File.
+func (f *encryptedFile) Close() error {
+	f.vfs.release(f.db)
+	return f.File.Close()
+}
+
+// FileControl implements FileController.
+func (f *encryptedFile) FileControl(op int, arg unsafe.Pointer) error {
+	if c, ok := f.File.(FileController); ok {
+		return c.FileControl(op, arg)
+	}
+	return ErrNotFound
+}
+
+// ShmMap implements FileSharedMemory.
+func (f encryptedFileShm) ShmMap(region, size int, extend bool) (unsafe.Pointer, error) {
+	return f.File.(FileSharedMemory).ShmMap(region, size, extend)
+}
+
+// ShmLock implements FileSharedMemory.
+func (f encryptedFileShm) ShmLock(offset, n, flags int) error {
+	return f.File.(FileSharedMemory).ShmLock(offset, n, flags)
+}
+
+// ShmBarrier implements FileSharedMemory.
+func (f encryptedFileShm) ShmBarrier() {
+	f.File.(FileSharedMemory).ShmBarrier()
+}
+
+// ShmUnmap implements FileSharedMemory.
+func (f encryptedFileShm) ShmUnmap(delete bool) error {
+	return f.File.(FileSharedMemory).ShmUnmap(delete)
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedVFS(t *testing.T) {
+	if err := RegisterEncryptedVFS("enctest", EncryptedVFSConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	callbackKey := bytes.Repeat([]byte{7}, 32)
+	err := RegisterEncryptedVFS("enctest-callback", EncryptedVFSConfig{
+		Key: func(name string) ([]byte, error) { return callbackKey, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	key := hex.EncodeToString(bytes.Repeat([]byte{1}, 16))
+	secret := []byte("the secret ingredient")
+	open := func(name, params string) *sql.DB {
+		t.Helper()
+		db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, name)+"?"+params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	fill := func(db *sql.DB) {
+		t.Helper()
+		_, err := db.Exec(`CREATE TABLE t (v TEXT);
+			WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 500)
+			INSERT INTO t SELECT ? || n FROM s`, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE t SET v = v || '!' WHERE rowid % 2 = 0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(db *sql.DB) {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM t WHERE v LIKE ? || '%'", secret).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 500 {
+			t.Errorf("expected 500 rows, got %d", n)
+		}
+		var ok string
+		if err := db.QueryRow("PRAGMA integrity_check").Scan(&ok); err != nil || ok != "ok" {
+			t.Errorf("integrity check: %v %v", ok, err)
+		}
+	}
+	checkFile := func(name string) {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) == 0 || bytes.Contains(b, secret) {
+			t.Errorf("%s is empty or holds data in the clear", name)
+		}
+	}
+
+	db := open("rollback.db", "vfs=enctest&_key="+key)
+	fill(db)
+	check(db)
+	db.Close()
+	checkFile("rollback.db")
+	b, err := os.ReadFile(filepath.Join(dir, "rollback.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, sqliteHeader) || b[20] != EncryptedVFSReserveBytes {
+		t.Errorf("unexpected header %q", b[:21])
+	}
+	check(open("rollback.db", "vfs=enctest&_key="+key))
+
+	var serr Error
+	wrong := hex.EncodeToString(bytes.Repeat([]byte{2}, 16))
+	err = open("rollback.db", "vfs=enctest&_key="+wrong).QueryRow("SELECT count(*) FROM t").Err()
+	if !errors.As(err, &serr) || serr.Code != ErrNotADB {
+		t.Errorf("expected not a database error with the wrong key, got %v", err)
+	}
+	err = open("rollback.db", "vfs=enctest").Ping()
+	if !errors.As(err, &serr) || serr.Code != ErrCantOpen {
+		t.Errorf("expected cannot open error without a key, got %v", err)
+	}
+
+	// A page zeroed in the middle of the file is damaged, not unwritten:
+	// here the last overflow page of a blob, which SQLite would read back
+	// as zeros.
+	db = open("blob.db", "vfs=enctest&_key="+key)
+	blob := bytes.Repeat([]byte{0xa5}, 3*4096)
+	if _, err := db.Exec("PRAGMA page_size = 4096; CREATE TABLE b (x BLOB); INSERT INTO b VALUES (?)", blob); err != nil {
+		t.Fatal(err)
+	}
+	fill(db)
+	db.Close()
+	b, err = os.ReadFile(filepath.Join(dir, "blob.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Page 2 is the root of b, pages 3 to 5 hold the rest of the blob.
+	clear(b[4*4096 : 5*4096])
+	if err := os.WriteFile(filepath.Join(dir, "zeroed.db"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	err = open("zeroed.db", "vfs=enctest&_key="+key).QueryRow("SELECT x FROM b").Scan(&got)
+	if !errors.As(err, &serr) || serr.Code != ErrCorrupt {
+		t.Errorf("expected a corrupt error for a zeroed page, got %v", err)
+	}
+	// Zeros after the last page are not.
+	b, err = os.ReadFile(filepath.Join(dir, "blob.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "extended.db"), append(b, make([]byte, 3*4096)...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db = open("extended.db", "vfs=enctest&_key="+key)
+	if err := db.QueryRow("SELECT x FROM b").Scan(&got); err != nil || !bytes.Equal(got, blob) {
+		t.Errorf("expected the blob back, got %d bytes %v", len(got), err)
+	}
+	check(db)
+
+	// The journal is encrypted too: keep it with journal_mode=PERSIST.
+	db = open("persist.db", "vfs=enctest-callback&_journal_mode=PERSIST")
+	fill(db)
+	check(db)
+	checkFile("persist.db")
+	checkFile("persist.db-journal")
+
+	// A hot journal left by a crash is decrypted to roll the database back.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"PRAGMA cache_size = 1", "BEGIN", "UPDATE t SET v = 'lost'"} {
+		if _, err := conn.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, suffix := range []string{"", "-journal"} {
+		b, err := os.ReadFile(filepath.Join(dir, "persist.db"+suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "crashed.db"+suffix), b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	check(open("crashed.db", "vfs=enctest-callback"))
+
+	// So are the frames of the WAL, which stays in place while a
+	// connection is open.
+	db = open("wal.db", "vfs=enctest&_journal_mode=WAL&_key="+key)
+	db.SetMaxOpenConns(1)
+	fill(db)
+	check(db)
+	checkFile("wal.db-wal")
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+	checkFile("wal.db")
+	check(db)
+
+	// RekeyTo changes the key of an encrypted database, and encrypts a
+	// plain one.
+	plain := open("plain.db", "")
+	plain.SetMaxOpenConns(1)
+	fill(plain)
+	newKey := bytes.Repeat([]byte{3}, 32)
+	for _, tt := range []struct {
+		db   *sql.DB
+		dest string
+	}{
+		{db, "rekeyed.db"},
+		{plain, "encrypted.db"},
+	} {
+		conn, err := tt.db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = conn.Raw(func(dc any) error {
+			return dc.(*SQLiteConn).RekeyTo(ctx, filepath.Join(dir, tt.dest), "enctest", newKey)
+		})
+		conn.Close()
+		if err != nil {
+			t.Fatal(tt.dest, err)
+		}
+		checkFile(tt.dest)
+		check(open(tt.dest, "vfs=enctest&_key="+hex.EncodeToString(newKey)))
+	}
+
+	// RekeyTo leaves the reserved bytes requested for the source database,
+	// which a later VACUUM applies, as they were.
+	conn, err = plain.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Raw(func(dc any) error {
+		c := dc.(*SQLiteConn)
+		if err := c.SetFileControlInt("main", SQLITE_FCNTL_RESERVE_BYTES, 8); err != nil {
+			return err
+		}
+		return c.RekeyTo(ctx, filepath.Join(dir, "reserved.db"), "enctest", newKey)
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(filepath.Join(dir, "plain.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[20] != 8 {
+		t.Errorf("expected 8 reserved bytes in the plain database, got %d", b[20])
+	}
+}
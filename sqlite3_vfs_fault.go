@@ -0,0 +1,477 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+// FaultOp is an operation of the files of a FaultVFS.
+type FaultOp int
+
+// Operations of a FaultVFS.
+const (
+	FaultOpen FaultOp = iota + 1
+	FaultClose
+	FaultDelete
+	FaultRead
+	FaultWrite
+	FaultTruncate
+	FaultSync
+	FaultLock
+	FaultUnlock
+)
+
+var faultOpNames = map[FaultOp]string{
+	FaultOpen:     "open",
+	FaultClose:    "close",
+	FaultDelete:   "delete",
+	FaultRead:     "read",
+	FaultWrite:    "write",
+	FaultTruncate: "truncate",
+	FaultSync:     "sync",
+	FaultLock:     "lock",
+	FaultUnlock:   "unlock",
+}
+
+func (op FaultOp) String() string {
+	if s, ok := faultOpNames[op]; ok {
+		return s
+	}
+	return fmt.Sprintf("FaultOp(%d)", int(op))
+}
+
+// faultOpErrors are the errors of the operations failed without an error
+// of their own.
+var faultOpErrors = map[FaultOp]error{
+	FaultOpen:     ErrCantOpen,
+	FaultClose:    ErrIoErrClose,
+	FaultDelete:   ErrIoErrDelete,
+	FaultRead:     ErrIoErrRead,
+	FaultWrite:    ErrIoErrWrite,
+	FaultTruncate: ErrIoErrTruncate,
+	FaultSync:     ErrIoErrFsync,
+	FaultLock:     ErrIoErrLock,
+	FaultUnlock:   ErrIoErrUnlock,
+}
+
+// FaultEvent is an operation recorded in the log of a FaultVFS.
+type FaultEvent struct {
+	Op   FaultOp
+	Name string // file name, "" for temporary files
+	// Offset and Size are the range of a read or write, and Offset the
+	// size of a truncate.
+	Offset int64
+	Size   int
+	// Flags are the SQLITE_OPEN_* flags of an open, the SQLITE_SYNC_*
+	// flags of a sync, or the SQLITE_LOCK_* level of a lock or unlock.
+	Flags int
+	Err   error
+}
+
+func (e FaultEvent) String() string {
+	s := e.Op.String() + " " + e.Name
+	switch e.Op {
+	case FaultRead, FaultWrite:
+		s += fmt.Sprintf(" %d@%d", e.Size, e.Offset)
+	case FaultTruncate:
+		s += fmt.Sprintf(" %d", e.Offset)
+	case FaultOpen, FaultSync, FaultLock, FaultUnlock:
+		s += fmt.Sprintf(" %#x", e.Flags)
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// FaultVFS is a VFS for tests that stores its files through another VFS,
+// records the operations on them and fails them on demand, so that the
+// handling of I/O errors and crashes can be exercised. Register it with
+// RegisterVFS.
+//
+// The changes made to a file since it was last synced are kept, so that
+// PowerLoss can undo them. A FaultVFS is meant for small test databases.
+type FaultVFS struct {
+	base VFSFilenameOpener
+
+	mu     sync.Mutex
+	faults []*fault
+	budget int64
+	log    []FaultEvent
+	// epoch is incremented by PowerLoss, which fails the files opened
+	// before it.
+	epoch    int
+	unsynced map[string]*faultUndo
+}
+
+type fault struct {
+	op  FaultOp
+	n   int
+	err error
+}
+
+// faultUndo holds the changes to a file since it was last synced.
+type faultUndo struct {
+	flags   int
+	changes []faultChange
+}
+
+// faultChange is undone by writing data at off and truncating the file to
+// size.
+type faultChange struct {
+	off  int64
+	data []byte
+	size int64
+}
+
+// NewFaultVFS returns a FaultVFS storing its files through the VFS base,
+// or the default VFS if base is empty.
+func NewFaultVFS(base string) (*FaultVFS, error) {
+	vfs, err := FindVFS(base)
+	if err != nil {
+		return nil, err
+	}
+	return &FaultVFS{
+		base:     vfs.(VFSFilenameOpener),
+		budget:   -1,
+		unsynced: map[string]*faultUndo{},
+	}, nil
+}
+
+// FailNth makes the nth next op fail with err, counting from 1; the I/O
+// error code of the operation, such as ErrIoErrWrite, if err is nil.
+// Each call adds a fault which fires once; the faults of an op all count
+// it from the time they are added.
+func (v *FaultVFS) FailNth(op FaultOp, n int, err error) {
+	if err == nil {
+		err = faultOpErrors[op]
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.faults = append(v.faults, &fault{op: op, n: n, err: err})
+}
+
+// SetWriteBudget makes the writes fail with ErrFull once n more bytes have
+// been written to the files, as if the disk were full. A negative n removes
+// the limit.
+func (v *FaultVFS) SetWriteBudget(n int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.budget = n
+}
+
+// PowerLoss emulates a power loss: the changes made to the files since they
+// were last synced are undone, and the files opened so far fail every
+// operation but Close, so that no connection can clean up after itself.
+// Opening the databases again sees them as they would be after a reboot;
+// the shared memory of WAL mode is left as it is.
+func (v *FaultVFS) PowerLoss() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.epoch++
+	var errs []error
+	for name, u := range v.unsynced {
+		if err := v.undo(name, u); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	clear(v.unsynced)
+	return errors.Join(errs...)
+}
+
+func (v *FaultVFS) undo(name string, u *faultUndo) error {
+	flags := u.flags&SQLITE_OPEN_FILE_TYPE_MASK | SQLITE_OPEN_READWRITE
+	f, _, err := v.base.Open(name, flags)
+	if err != nil {
+		return err
+	}
+	for i := len(u.changes) - 1; i >= 0 && err == nil; i-- {
+		c := u.changes[i]
+		if len(c.data) > 0 {
+			_, err = f.WriteAt(c.data, c.off)
+		}
+		if err == nil {
+			err = f.Truncate(c.size)
+		}
+	}
+	if err == nil {
+		err = f.Sync(SQLITE_SYNC_FULL)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Log returns the operations recorded since the FaultVFS was created or
+// Reset.
+func (v *FaultVFS) Log() []FaultEvent {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]FaultEvent(nil), v.log...)
+}
+
+// Reset removes the pending faults, the write budget and the log.
+func (v *FaultVFS) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.faults = nil
+	v.budget = -1
+	v.log = nil
+}
+
+// record logs e, and returns the error of a fault injected into it.
+func (v *FaultVFS) record(e FaultEvent) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.recordLocked(e)
+}
+
+func (v *FaultVFS) recordLocked(e FaultEvent) error {
+	// Every pending fault of the op counts it; the first one due fires,
+	// and any other one due fires on the next op.
+	faults := v.faults[:0]
+	for _, f := range v.faults {
+		if f.op == e.Op {
+			if f.n--; f.n <= 0 && e.Err == nil {
+				e.Err = f.err
+				continue
+			}
+		}
+		faults = append(faults, f)
+	}
+	clear(v.faults[len(faults):])
+	v.faults = faults
+	if e.Err == nil && e.Op == FaultWrite && v.budget >= 0 {
+		if int64(e.Size) > v.budget {
+			e.Err = ErrFull
+			v.budget = 0
+		} else {
+			v.budget -= int64(e.Size)
+		}
+	}
+	v.log = append(v.log, e)
+	return e.Err
+}
+
+// Open implements VFS.
+func (v *FaultVFS) Open(name string, flags int) (File, int, error) {
+	return v.open(name, flags, func() (File, int, error) { return v.base.Open(name, flags) })
+}
+
+// OpenFilename implements VFSFilenameOpener.
+func (v *FaultVFS) OpenFilename(name *Filename, flags int) (File, int, error) {
+	return v.open(name.String(), flags, func() (File, int, error) { return v.base.OpenFilename(name, flags) })
+}
+
+func (v *FaultVFS) open(name string, flags int, open func() (File, int, error)) (File, int, error) {
+	if err := v.record(FaultEvent{Op: FaultOpen, Name: name, Flags: flags}); err != nil {
+		return nil, 0, err
+	}
+	f, out, err := open()
+	if err != nil {
+		return nil, 0, err
+	}
+	v.mu.Lock()
+	ff := &faultFile{File: f, vfs: v, name: name, flags: flags, epoch: v.epoch}
+	v.mu.Unlock()
+	if _, ok := f.(FileSharedMemory); ok {
+		return faultFileShm{ff}, out, nil
+	}
+	return ff, out, nil
+}
+
+// Delete implements VFS.
+func (v *FaultVFS) Delete(name string, syncDir bool) error {
+	if err := v.record(FaultEvent{Op: FaultDelete, Name: name}); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	delete(v.unsynced, name)
+	v.mu.Unlock()
+	return v.base.Delete(name, syncDir)
+}
+
+// Access implements VFS.
+func (v *FaultVFS) Access(name string, flag int) (bool, error) {
+	return v.base.Access(name, flag)
+}
+
+// FullPathname implements VFS.
+func (v *FaultVFS) FullPathname(name string) (string, error) {
+	return v.base.FullPathname(name)
+}
+
+// faultFile is a file opened by a FaultVFS.
+type faultFile struct {
+	File
+	vfs   *FaultVFS
+	name  string
+	flags int
+	epoch int
+}
+
+// faultFileShm is a faultFile whose base file provides shared memory.
+type faultFileShm struct {
+	*faultFile
+}
+
+// record logs e, and returns the error of a fault injected into it, or
+// ErrIoErr if the file did not survive a power loss.
+func (f *faultFile) record(e FaultEvent) error {
+	e.Name = f.name
+	v := f.vfs
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if f.epoch != v.epoch && e.Op != FaultClose {
+		e.Err = ErrIoErr
+		v.log = append(v.log, e)
+		return e.Err
+	}
+	return v.recordLocked(e)
+}
+
+// save keeps the range of the file that a write or truncate is about to
+// change, until the file is synced.
+func (f *faultFile) save(off, n int64) error {
+	if f.name == "" {
+		return nil
+	}
+	size, err := f.File.FileSize()
+	if err != nil {
+		return err
+	}
+	c := faultChange{off: off, size: size}
+	if off < size {
+		c.data = make([]byte, min(n, size-off))
+		m, err := f.File.ReadAt(c.data, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		c.data = c.data[:m]
+	}
+	v := f.vfs
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	u, ok := v.unsynced[f.name]
+	if !ok {
+		u = &faultUndo{flags: f.flags}
+		v.unsynced[f.name] = u
+	}
+	u.changes = append(u.changes, c)
+	return nil
+}
+
+// Close implements File.
+func (f *faultFile) Close() error {
+	err := f.record(FaultEvent{Op: FaultClose})
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadAt implements File.
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.record(FaultEvent{Op: FaultRead, Offset: off, Size: len(p)}); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+// WriteAt implements File.
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.record(FaultEvent{Op: FaultWrite, Offset: off, Size: len(p)}); err != nil {
+		return 0, err
+	}
+	if err := f.save(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// Truncate implements File.
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.record(FaultEvent{Op: FaultTruncate, Offset: size}); err != nil {
+		return err
+	}
+	cur, err := f.File.FileSize()
+	if err != nil {
+		return err
+	}
+	if size < cur {
+		if err := f.save(size, cur-size); err != nil {
+			return err
+		}
+	}
+	return f.File.Truncate(size)
+}
+
+// Sync implements File.
+func (f *faultFile) Sync(flags int) error {
+	if err := f.record(FaultEvent{Op: FaultSync, Flags: flags}); err != nil {
+		return err
+	}
+	if err := f.File.Sync(flags); err != nil {
+		return err
+	}
+	f.vfs.mu.Lock()
+	delete(f.vfs.unsynced, f.name)
+	f.vfs.mu.Unlock()
+	return nil
+}
+
+// Lock implements File.
+func (f *faultFile) Lock(level int) error {
+	if err := f.record(FaultEvent{Op: FaultLock, Flags: level}); err != nil {
+		return err
+	}
+	return f.File.Lock(level)
+}
+
+// Unlock implements File.
+func (f *faultFile) Unlock(level int) error {
+	if err := f.record(FaultEvent{Op: FaultUnlock, Flags: level}); err != nil {
+		return err
+	}
+	return f.File.Unlock(level)
+}
+
+// FileControl implements FileController.
+func (f *faultFile) FileControl(op int, arg unsafe.Pointer) error {
+	if c, ok := f.File.(FileController); ok {
+		return c.FileControl(op, arg)
+	}
+	return ErrNotFound
+}
+
+// ShmMap implements FileSharedMemory.
+func (f faultFileShm) ShmMap(region, size int, extend bool) (unsafe.Pointer, error) {
+	return f.File.(FileSharedMemory).ShmMap(region, size, extend)
+}
+
+// ShmLock implements FileSharedMemory.
+func (f faultFileShm) ShmLock(offset, n, flags int) error {
+	return f.File.(FileSharedMemory).ShmLock(offset, n, flags)
+}
+
+// ShmBarrier implements FileSharedMemory.
+func (f faultFileShm) ShmBarrier() {
+	f.File.(FileSharedMemory).ShmBarrier()
+}
+
+// ShmUnmap implements FileSharedMemory.
+func (f faultFileShm) ShmUnmap(delete bool) error {
+	return f.File.(FileSharedMemory).ShmUnmap(delete)
+}
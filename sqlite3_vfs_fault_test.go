@@ -0,0 +1,140 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFaultVFSFailNth(t *testing.T) {
+	vfs, err := NewFaultVFS("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vfs.FailNth(FaultWrite, 1, nil)
+	vfs.FailNth(FaultWrite, 3, nil)
+	var failed []int
+	for i := 1; i <= 5; i++ {
+		if err := vfs.record(FaultEvent{Op: FaultWrite}); err != nil {
+			failed = append(failed, i)
+		}
+		if err := vfs.record(FaultEvent{Op: FaultRead}); err != nil {
+			t.Errorf("read %d: unexpected error %v", i, err)
+		}
+	}
+	if !reflect.DeepEqual(failed, []int{1, 3}) {
+		t.Errorf("expected writes 1 and 3 to fail, got %v", failed)
+	}
+}
+
+func TestFaultVFS(t *testing.T) {
+	vfs, err := NewFaultVFS("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterVFS("faulttest", vfs); err != nil {
+		t.Fatal(err)
+	}
+	dsn := "file:" + filepath.Join(t.TempDir(), "fault.db") + "?vfs=faulttest&_busy_timeout=0"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE t (v INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range vfs.Log() {
+		ops = append(ops, e.Op.String())
+	}
+	if log := strings.Join(ops, " "); !strings.Contains(log, "write") || !strings.Contains(log, "sync") {
+		t.Errorf("expected writes and syncs in the log, got %s", log)
+	}
+
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM t").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	var serr Error
+	for _, tt := range []struct {
+		inject func()
+		code   ErrNo
+		ext    ErrNoExtended
+	}{
+		{func() { vfs.FailNth(FaultWrite, 1, nil) }, ErrIoErr, ErrIoErrWrite},
+		{func() { vfs.FailNth(FaultSync, 1, nil) }, ErrIoErr, ErrIoErrFsync},
+		{func() { vfs.FailNth(FaultLock, 2, ErrBusy) }, ErrBusy, ErrNoExtended(ErrBusy)},
+		{func() { vfs.SetWriteBudget(100) }, ErrFull, ErrNoExtended(ErrFull)},
+	} {
+		tt.inject()
+		_, err := db.Exec("INSERT INTO t VALUES (2)")
+		vfs.Reset()
+		if !errors.As(err, &serr) || serr.Code != tt.code || serr.ExtendedCode != tt.ext {
+			t.Errorf("expected %v (%d), got %v", tt.code, tt.ext, err)
+			continue
+		}
+		if n := count(); n != 1 {
+			t.Errorf("expected the failed insert to be rolled back, got %d rows", n)
+		}
+	}
+
+	// A power loss drops the writes that were not synced: those of a
+	// transaction committed with synchronous=OFF, and those of a large
+	// transaction spilled to the database, which its journal then undoes.
+	ctx := context.Background()
+	for _, stmts := range [][]string{
+		{"PRAGMA synchronous = OFF", "INSERT INTO t VALUES (3)"},
+		{"PRAGMA cache_size = 2", "BEGIN", `WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 1000)
+			INSERT INTO t SELECT n FROM s`},
+	} {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range stmts {
+			if _, err := conn.ExecContext(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := vfs.PowerLoss(); err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(&n); !errors.As(err, &serr) || serr.Code != ErrIoErr {
+			t.Errorf("expected the connection to fail after the power loss, got %v", err)
+		}
+		conn.Close()
+		db.Close()
+
+		db, err = sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if n := count(); n != 1 {
+			t.Errorf("%s: expected the writes to be lost, got %d rows", stmts[0], n)
+		}
+		var ok string
+		if err := db.QueryRow("PRAGMA integrity_check").Scan(&ok); err != nil || ok != "ok" {
+			t.Errorf("integrity check: %v %v", ok, err)
+		}
+	}
+}
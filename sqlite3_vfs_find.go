@@ -0,0 +1,349 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+/*
+#ifndef USE_LIBSQLITE3
+#include "sqlite3-binding.h"
+#else
+#include <sqlite3.h>
+#endif
+#include <stdlib.h>
+
+static int _sqlite3_vfs_open(sqlite3_vfs *pVfs, const char *zName, sqlite3_file *pFile, int flags, int *pOutFlags) {
+	return pVfs->xOpen(pVfs, zName, pFile, flags, pOutFlags);
+}
+
+static int _sqlite3_vfs_delete(sqlite3_vfs *pVfs, const char *zName, int syncDir) {
+	return pVfs->xDelete(pVfs, zName, syncDir);
+}
+
+static int _sqlite3_vfs_access(sqlite3_vfs *pVfs, const char *zName, int flags, int *pResOut) {
+	return pVfs->xAccess(pVfs, zName, flags, pResOut);
+}
+
+static int _sqlite3_vfs_full_pathname(sqlite3_vfs *pVfs, const char *zName, int nOut, char *zOut) {
+	return pVfs->xFullPathname(pVfs, zName, nOut, zOut);
+}
+
+static int _sqlite3_file_close(sqlite3_file *f) {
+	return f->pMethods ? f->pMethods->xClose(f) : SQLITE_OK;
+}
+
+static int _sqlite3_file_read(sqlite3_file *f, void *p, int n, sqlite3_int64 off) {
+	return f->pMethods->xRead(f, p, n, off);
+}
+
+static int _sqlite3_file_write(sqlite3_file *f, const void *p, int n, sqlite3_int64 off) {
+	return f->pMethods->xWrite(f, p, n, off);
+}
+
+static int _sqlite3_file_truncate(sqlite3_file *f, sqlite3_int64 size) {
+	return f->pMethods->xTruncate(f, size);
+}
+
+static int _sqlite3_file_sync(sqlite3_file *f, int flags) {
+	return f->pMethods->xSync(f, flags);
+}
+
+static int _sqlite3_file_size(sqlite3_file *f, sqlite3_int64 *pSize) {
+	return f->pMethods->xFileSize(f, pSize);
+}
+
+static int _sqlite3_file_lock(sqlite3_file *f, int eLock) {
+	return f->pMethods->xLock(f, eLock);
+}
+
+static int _sqlite3_file_unlock(sqlite3_file *f, int eLock) {
+	return f->pMethods->xUnlock(f, eLock);
+}
+
+static int _sqlite3_file_check_reserved_lock(sqlite3_file *f, int *pResOut) {
+	return f->pMethods->xCheckReservedLock(f, pResOut);
+}
+
+static int _sqlite3_file_control(sqlite3_file *f, int op, void *pArg) {
+	return f->pMethods->xFileControl(f, op, pArg);
+}
+
+static int _sqlite3_file_sector_size(sqlite3_file *f) {
+	return f->pMethods->xSectorSize ? f->pMethods->xSectorSize(f) : 0;
+}
+
+static int _sqlite3_file_device_characteristics(sqlite3_file *f) {
+	return f->pMethods->xDeviceCharacteristics ? f->pMethods->xDeviceCharacteristics(f) : 0;
+}
+
+static int _sqlite3_file_has_shm(sqlite3_file *f) {
+	return f->pMethods->iVersion >= 2 && f->pMethods->xShmMap != 0;
+}
+
+static int _sqlite3_file_shm_map(sqlite3_file *f, int iPg, int pgsz, int bExtend, void **pp) {
+	return f->pMethods->xShmMap(f, iPg, pgsz, bExtend, (void volatile**)pp);
+}
+
+static int _sqlite3_file_shm_lock(sqlite3_file *f, int offset, int n, int flags) {
+	return f->pMethods->xShmLock(f, offset, n, flags);
+}
+
+static void _sqlite3_file_shm_barrier(sqlite3_file *f) {
+	f->pMethods->xShmBarrier(f);
+}
+
+static int _sqlite3_file_shm_unmap(sqlite3_file *f, int deleteFlag) {
+	return f->pMethods->xShmUnmap(f, deleteFlag);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// FindVFS returns the VFS registered with SQLite under name, or the default
+// VFS if name is empty, so that a Go VFS can store its files through it.
+//
+// The returned VFS is a VFSFilenameOpener, and a Go VFS wrapping it should
+// pass on the Filename it is given: VFSes such as "unix" read the URI
+// parameters of the database through it. Its files implement
+// FileController, and FileSharedMemory if the VFS supports WAL mode.
+func FindVFS(name string) (VFS, error) {
+	var cname *C.char
+	if name != "" {
+		cname = C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	p := C.sqlite3_vfs_find(cname)
+	if p == nil {
+		return nil, fmt.Errorf("sqlite3: no such VFS: %q", name)
+	}
+	return &cVFS{p}, nil
+}
+
+// cVFS is a VFS implemented in C.
+type cVFS struct {
+	p *C.sqlite3_vfs
+}
+
+// cFile is a file opened by a cVFS. name is set if the file was opened with
+// Open, and freed with the file.
+type cFile struct {
+	f    *C.sqlite3_file
+	name *C.char
+}
+
+// cFileShm is a cFile whose methods include the shared memory ones.
+type cFileShm struct {
+	*cFile
+}
+
+func cVFSError(rv C.int) error {
+	if rv == C.SQLITE_OK {
+		return nil
+	}
+	return Error{Code: ErrNo(rv & ErrNoMask), ExtendedCode: ErrNoExtended(rv)}
+}
+
+// Open implements VFS. The name is turned into a database filename without
+// URI parameters.
+func (v *cVFS) Open(name string, flags int) (File, int, error) {
+	if name == "" {
+		return v.open(nil, nil, flags)
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	fname := C.sqlite3_create_filename(cname, cname, cname, 0, nil)
+	if fname == nil {
+		return nil, 0, ErrNomem
+	}
+	return v.open(fname, fname, flags)
+}
+
+// OpenFilename implements VFSFilenameOpener.
+func (v *cVFS) OpenFilename(name *Filename, flags int) (File, int, error) {
+	return v.open(name.p, nil, flags)
+}
+
+func (v *cVFS) open(zName, owned *C.char, flags int) (File, int, error) {
+	f := (*C.sqlite3_file)(C.sqlite3_malloc(v.p.szOsFile))
+	if f == nil {
+		C.sqlite3_free_filename(owned)
+		return nil, 0, ErrNomem
+	}
+	f.pMethods = nil
+	var out C.int
+	rv := C._sqlite3_vfs_open(v.p, zName, f, C.int(flags), &out)
+	if rv != C.SQLITE_OK {
+		// A file that failed to open may still need to be closed.
+		C._sqlite3_file_close(f)
+		C.sqlite3_free(unsafe.Pointer(f))
+		C.sqlite3_free_filename(owned)
+		return nil, 0, cVFSError(rv)
+	}
+	file := &cFile{f: f, name: owned}
+	if C._sqlite3_file_has_shm(f) != 0 {
+		return cFileShm{file}, int(out), nil
+	}
+	return file, int(out), nil
+}
+
+// Delete implements VFS.
+func (v *cVFS) Delete(name string, syncDir bool) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var sync C.int
+	if syncDir {
+		sync = 1
+	}
+	return cVFSError(C._sqlite3_vfs_delete(v.p, cname, sync))
+}
+
+// Access implements VFS.
+func (v *cVFS) Access(name string, flag int) (bool, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var res C.int
+	rv := C._sqlite3_vfs_access(v.p, cname, C.int(flag), &res)
+	return res != 0, cVFSError(rv)
+}
+
+// FullPathname implements VFS.
+func (v *cVFS) FullPathname(name string) (string, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	n := v.p.mxPathname + 1
+	out := (*C.char)(C.malloc(C.size_t(n)))
+	defer C.free(unsafe.Pointer(out))
+	if rv := C._sqlite3_vfs_full_pathname(v.p, cname, n, out); rv != C.SQLITE_OK {
+		return "", cVFSError(rv)
+	}
+	return C.GoString(out), nil
+}
+
+// Close implements File.
+func (f *cFile) Close() error {
+	rv := C._sqlite3_file_close(f.f)
+	C.sqlite3_free(unsafe.Pointer(f.f))
+	C.sqlite3_free_filename(f.name)
+	f.f, f.name = nil, nil
+	return cVFSError(rv)
+}
+
+// ReadAt implements File.
+func (f *cFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rv := C._sqlite3_file_read(f.f, unsafe.Pointer(&p[0]), C.int(len(p)), C.sqlite3_int64(off))
+	if rv == C.int(ErrIoErrShortRead) {
+		// SQLite zeroed the rest of p; report how much of it is data.
+		size, err := f.FileSize()
+		if err != nil {
+			return 0, err
+		}
+		return int(min(max(size-off, 0), int64(len(p)))), io.EOF
+	}
+	if rv != C.SQLITE_OK {
+		return 0, cVFSError(rv)
+	}
+	return len(p), nil
+}
+
+// WriteAt implements File.
+func (f *cFile) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rv := C._sqlite3_file_write(f.f, unsafe.Pointer(&p[0]), C.int(len(p)), C.sqlite3_int64(off))
+	if rv != C.SQLITE_OK {
+		return 0, cVFSError(rv)
+	}
+	return len(p), nil
+}
+
+// Truncate implements File.
+func (f *cFile) Truncate(size int64) error {
+	return cVFSError(C._sqlite3_file_truncate(f.f, C.sqlite3_int64(size)))
+}
+
+// Sync implements File.
+func (f *cFile) Sync(flags int) error {
+	return cVFSError(C._sqlite3_file_sync(f.f, C.int(flags)))
+}
+
+// FileSize implements File.
+func (f *cFile) FileSize() (int64, error) {
+	var size C.sqlite3_int64
+	rv := C._sqlite3_file_size(f.f, &size)
+	return int64(size), cVFSError(rv)
+}
+
+// Lock implements File.
+func (f *cFile) Lock(level int) error {
+	return cVFSError(C._sqlite3_file_lock(f.f, C.int(level)))
+}
+
+// Unlock implements File.
+func (f *cFile) Unlock(level int) error {
+	return cVFSError(C._sqlite3_file_unlock(f.f, C.int(level)))
+}
+
+// CheckReservedLock implements File.
+func (f *cFile) CheckReservedLock() (bool, error) {
+	var res C.int
+	rv := C._sqlite3_file_check_reserved_lock(f.f, &res)
+	return res != 0, cVFSError(rv)
+}
+
+// SectorSize implements File.
+func (f *cFile) SectorSize() int {
+	return int(C._sqlite3_file_sector_size(f.f))
+}
+
+// DeviceCharacteristics implements File.
+func (f *cFile) DeviceCharacteristics() int {
+	return int(C._sqlite3_file_device_characteristics(f.f))
+}
+
+// FileControl implements FileController.
+func (f *cFile) FileControl(op int, arg unsafe.Pointer) error {
+	return cVFSError(C._sqlite3_file_control(f.f, C.int(op), arg))
+}
+
+// ShmMap implements FileSharedMemory.
+func (f cFileShm) ShmMap(region, size int, extend bool) (unsafe.Pointer, error) {
+	var p unsafe.Pointer
+	var ext C.int
+	if extend {
+		ext = 1
+	}
+	rv := C._sqlite3_file_shm_map(f.f, C.int(region), C.int(size), ext, &p)
+	return p, cVFSError(rv)
+}
+
+// ShmLock implements FileSharedMemory.
+func (f cFileShm) ShmLock(offset, n, flags int) error {
+	return cVFSError(C._sqlite3_file_shm_lock(f.f, C.int(offset), C.int(n), C.int(flags)))
+}
+
+// ShmBarrier implements FileSharedMemory.
+func (f cFileShm) ShmBarrier() {
+	C._sqlite3_file_shm_barrier(f.f)
+}
+
+// ShmUnmap implements FileSharedMemory.
+func (f cFileShm) ShmUnmap(delete bool) error {
+	var del C.int
+	if delete {
+		del = 1
+	}
+	return cVFSError(C._sqlite3_file_shm_unmap(f.f, del))
+}
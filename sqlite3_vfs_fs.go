@@ -0,0 +1,245 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// GoFSVFSName is the name of the read-only VFS that opens the databases of
+// RegisterFS and RegisterReaderAt.
+const GoFSVFSName = "gofs"
+
+var goFS = struct {
+	sync.RWMutex
+	once    sync.Once
+	err     error
+	fss     map[string]fs.FS
+	readers map[string]*io.SectionReader
+}{
+	fss:     map[string]fs.FS{},
+	readers: map[string]*io.SectionReader{},
+}
+
+// RegisterFS makes the databases in fsys available under name to the
+// "gofs" VFS, which opens them with the fs parameter of the data source
+// name:
+//
+//	file:data.db?vfs=gofs&fs=name
+//
+// opens data.db of fsys. The databases are read-only and immutable: SQLite
+// neither locks them nor looks for a journal, so fsys must not change while
+// they are open. Temporary files are kept in memory.
+//
+// Files of fsys that implement io.ReaderAt, such as those of embed.FS, or
+// io.Seeker are read in place; others, such as compressed entries of a zip
+// archive, are read into memory when opened. Registering a nil fsys removes
+// name.
+func RegisterFS(name string, fsys fs.FS) error {
+	if err := registerGoFS(); err != nil {
+		return err
+	}
+	goFS.Lock()
+	defer goFS.Unlock()
+	if fsys == nil {
+		delete(goFS.fss, name)
+	} else {
+		goFS.fss[name] = fsys
+	}
+	return nil
+}
+
+// RegisterReaderAt makes the database of size bytes read from r available
+// under name to the "gofs" VFS, which opens it when given name without the
+// fs parameter:
+//
+//	file:name?vfs=gofs
+//
+// The database is read-only and immutable, like those of RegisterFS.
+// Registering a nil r removes name.
+func RegisterReaderAt(name string, r io.ReaderAt, size int64) error {
+	if err := registerGoFS(); err != nil {
+		return err
+	}
+	goFS.Lock()
+	defer goFS.Unlock()
+	if r == nil {
+		delete(goFS.readers, name)
+	} else {
+		goFS.readers[name] = io.NewSectionReader(r, 0, size)
+	}
+	return nil
+}
+
+func registerGoFS() error {
+	goFS.once.Do(func() {
+		goFS.err = RegisterVFS(GoFSVFSName, goFSVFS{})
+	})
+	return goFS.err
+}
+
+// goFSVFS is the "gofs" VFS.
+type goFSVFS struct{}
+
+// Open implements VFS. SQLite opens the files with OpenFilename, which has
+// the fs parameter.
+func (goFSVFS) Open(name string, flags int) (File, int, error) {
+	return nil, 0, ErrCantOpen
+}
+
+// OpenFilename implements VFSFilenameOpener.
+func (goFSVFS) OpenFilename(name *Filename, flags int) (File, int, error) {
+	const temporary = SQLITE_OPEN_TEMP_DB | SQLITE_OPEN_TEMP_JOURNAL | SQLITE_OPEN_SUBJOURNAL | SQLITE_OPEN_TRANSIENT_DB
+	if flags&temporary != 0 || name.String() == "" {
+		return &vfsTempFile{}, flags, nil
+	}
+	if flags&SQLITE_OPEN_MAIN_DB == 0 {
+		return nil, 0, ErrCantOpen
+	}
+	out := flags&^(SQLITE_OPEN_READWRITE|SQLITE_OPEN_CREATE) | SQLITE_OPEN_READONLY
+	fsName := name.URIParameter("fs")
+	if fsName == "" {
+		goFS.RLock()
+		r, ok := goFS.readers[name.String()]
+		goFS.RUnlock()
+		if !ok {
+			return nil, 0, fs.ErrNotExist
+		}
+		return &goFSFile{r: r, size: r.Size()}, out, nil
+	}
+	goFS.RLock()
+	fsys, ok := goFS.fss[fsName]
+	goFS.RUnlock()
+	if !ok {
+		return nil, 0, fmt.Errorf("sqlite3: no such fs: %q", fsName)
+	}
+	f, err := fsys.Open(goFSPath(name.String()))
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := newGoFSFile(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return file, out, nil
+}
+
+// goFSPath turns the name of a database into a path of an fs.FS.
+func goFSPath(name string) string {
+	return strings.TrimPrefix(name, "/")
+}
+
+// Delete implements VFS.
+func (goFSVFS) Delete(name string, syncDir bool) error {
+	return ErrReadonly
+}
+
+// Access implements VFS. Only the databases exist.
+func (goFSVFS) Access(name string, flag int) (bool, error) {
+	return false, nil
+}
+
+// FullPathname implements VFS. The names are paths of an fs.FS, or names of
+// RegisterReaderAt, and are left as they are.
+func (goFSVFS) FullPathname(name string) (string, error) {
+	return name, nil
+}
+
+// goFSFile is a database opened by the "gofs" VFS.
+type goFSFile struct {
+	r    io.ReaderAt
+	size int64
+	f    fs.File
+}
+
+func newGoFSFile(f fs.File) (*goFSFile, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file := &goFSFile{f: f, size: fi.Size()}
+	switch r := f.(type) {
+	case io.ReaderAt:
+		file.r = r
+	case io.ReadSeeker:
+		file.r = &seekReaderAt{r: r}
+	default:
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(b)) != file.size {
+			return nil, fmt.Errorf("sqlite3: read %d bytes of %d", len(b), file.size)
+		}
+		file.r = bytes.NewReader(b)
+	}
+	return file, nil
+}
+
+// seekReaderAt reads at an offset from a reader that can only seek.
+type seekReaderAt struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.r, p)
+}
+
+func (f *goFSFile) Close() error {
+	if f.f != nil {
+		return f.f.Close()
+	}
+	return nil
+}
+
+func (f *goFSFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	if rest := f.size - off; int64(len(p)) > rest {
+		n, err := f.r.ReadAt(p[:rest], off)
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return n, err
+	}
+	n, err := f.r.ReadAt(p, off)
+	if n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *goFSFile) WriteAt(p []byte, off int64) (int, error) { return 0, ErrReadonly }
+func (f *goFSFile) Truncate(size int64) error                { return ErrReadonly }
+func (f *goFSFile) Sync(flags int) error                     { return nil }
+func (f *goFSFile) FileSize() (int64, error)                 { return f.size, nil }
+func (f *goFSFile) Lock(level int) error                     { return nil }
+func (f *goFSFile) Unlock(level int) error                   { return nil }
+func (f *goFSFile) CheckReservedLock() (bool, error)         { return false, nil }
+func (f *goFSFile) SectorSize() int                          { return 512 }
+
+// DeviceCharacteristics implements File. SQLite reads an immutable file
+// without locks, journal or change detection.
+func (f *goFSFile) DeviceCharacteristics() int {
+	return SQLITE_IOCAP_IMMUTABLE
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRegisterFS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ref.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE t (v TEXT);
+		WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 1000)
+		INSERT INTO t SELECT 'row ' || n FROM s`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, err := zw.Create("dir/ref.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterFS("maptest", fstest.MapFS{"ref.db": {Data: data}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterFS("ziptest", zr); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterReaderAt("readertest", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dsn := range []string{
+		"file:ref.db?vfs=gofs&fs=maptest",
+		"file:/dir/ref.db?vfs=gofs&fs=ziptest",
+		"file:readertest?vfs=gofs",
+	} {
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+		var n int
+		var last string
+		if err := db.QueryRow("SELECT count(*), max(v) FROM t").Scan(&n, &last); err != nil {
+			t.Fatal(dsn, err)
+		}
+		if n != 1000 || last != "row 999" {
+			t.Errorf("%s: unexpected result %d %q", dsn, n, last)
+		}
+		// Temporary tables live in memory.
+		if _, err := db.Exec("CREATE TEMP TABLE x AS SELECT * FROM t ORDER BY v DESC"); err != nil {
+			t.Fatal(dsn, err)
+		}
+		_, err = db.Exec("INSERT INTO t VALUES ('new')")
+		var serr Error
+		if !errors.As(err, &serr) || serr.Code != ErrReadonly {
+			t.Errorf("%s: expected read-only error, got %v", dsn, err)
+		}
+	}
+
+	missing, err := sql.Open("sqlite3", "file:missing.db?vfs=gofs&fs=maptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer missing.Close()
+	var serr Error
+	if err := missing.Ping(); !errors.As(err, &serr) || serr.Code != ErrCantOpen {
+		t.Errorf("expected cannot open error, got %v", err)
+	}
+
+	if err := RegisterFS("maptest", nil); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := sql.Open("sqlite3", "file:ref.db?vfs=gofs&fs=maptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removed.Close()
+	if err := removed.Ping(); err == nil {
+		t.Error("expected error opening a removed fs")
+	}
+}
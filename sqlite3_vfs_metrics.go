@@ -0,0 +1,318 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// LatencyBounds are the upper bounds of the buckets of a LatencyHistogram.
+var LatencyBounds = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// LatencyHistogram counts the durations of an operation. Buckets[i] counts
+// those up to LatencyBounds[i], and the last bucket the longer ones.
+type LatencyHistogram struct {
+	Count   int64
+	Total   time.Duration
+	Max     time.Duration
+	Buckets [len(LatencyBounds) + 1]int64
+}
+
+func (h *LatencyHistogram) observe(d time.Duration) {
+	h.Count++
+	h.Total += d
+	h.Max = max(h.Max, d)
+	i := sort.Search(len(LatencyBounds), func(i int) bool { return d <= LatencyBounds[i] })
+	h.Buckets[i]++
+}
+
+// Mean returns the mean duration, or 0 if there is none.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// FileMetrics are the I/O metrics of a kind of file of a database.
+type FileMetrics struct {
+	Opens        int64
+	Reads        int64
+	BytesRead    int64
+	Writes       int64
+	BytesWritten int64
+	Truncates    int64
+	Syncs        int64
+	Locks        int64 // calls to raise the lock
+	Unlocks      int64 // calls to lower the lock
+
+	ReadLatency  LatencyHistogram
+	WriteLatency LatencyHistogram
+	SyncLatency  LatencyHistogram
+	LockLatency  LatencyHistogram
+}
+
+// DatabaseMetrics are the I/O metrics of a database, by kind of file.
+type DatabaseMetrics struct {
+	Main    FileMetrics
+	Journal FileMetrics // rollback journals and super-journals
+	WAL     FileMetrics
+	Temp    FileMetrics // temporary databases, journals and statement journals
+}
+
+// MetricsVFS is a VFS that stores its files through another VFS, and
+// counts the operations on them and measures how long they take. Register
+// it with RegisterVFS and select it with the vfs parameter of the data
+// source name.
+//
+// The metrics are kept by database file name, as given to the VFS. The
+// temporary files, which belong to no database file, are counted under "".
+type MetricsVFS struct {
+	base VFSFilenameOpener
+
+	mu  sync.Mutex
+	dbs map[string]*metricsDB
+}
+
+type metricsDB struct {
+	mu sync.Mutex
+	m  DatabaseMetrics
+}
+
+// NewMetricsVFS returns a MetricsVFS storing its files through the VFS
+// base, or the default VFS if base is empty.
+func NewMetricsVFS(base string) (*MetricsVFS, error) {
+	vfs, err := FindVFS(base)
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsVFS{
+		base: vfs.(VFSFilenameOpener),
+		dbs:  map[string]*metricsDB{},
+	}, nil
+}
+
+// Databases returns the names of the databases with metrics.
+func (v *MetricsVFS) Databases() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := make([]string, 0, len(v.dbs))
+	for name := range v.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metrics returns the metrics of the database name.
+func (v *MetricsVFS) Metrics(name string) DatabaseMetrics {
+	v.mu.Lock()
+	db, ok := v.dbs[name]
+	v.mu.Unlock()
+	if !ok {
+		return DatabaseMetrics{}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.m
+}
+
+// Reset sets the metrics of all databases back to zero.
+func (v *MetricsVFS) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, db := range v.dbs {
+		db.mu.Lock()
+		db.m = DatabaseMetrics{}
+		db.mu.Unlock()
+	}
+}
+
+func (v *MetricsVFS) db(name string) *metricsDB {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	db, ok := v.dbs[name]
+	if !ok {
+		db = &metricsDB{}
+		v.dbs[name] = db
+	}
+	return db
+}
+
+// Open implements VFS.
+func (v *MetricsVFS) Open(name string, flags int) (File, int, error) {
+	return v.open(name, flags, func() (File, int, error) { return v.base.Open(name, flags) })
+}
+
+// OpenFilename implements VFSFilenameOpener.
+func (v *MetricsVFS) OpenFilename(name *Filename, flags int) (File, int, error) {
+	return v.open(name.Database(), flags, func() (File, int, error) { return v.base.OpenFilename(name, flags) })
+}
+
+func (v *MetricsVFS) open(dbName string, flags int, open func() (File, int, error)) (File, int, error) {
+	f, out, err := open()
+	if err != nil {
+		return nil, 0, err
+	}
+	if flags&(SQLITE_OPEN_TEMP_DB|SQLITE_OPEN_TEMP_JOURNAL|SQLITE_OPEN_SUBJOURNAL|SQLITE_OPEN_TRANSIENT_DB) != 0 {
+		dbName = ""
+	}
+	db := v.db(dbName)
+	mf := &metricsFile{File: f, db: db}
+	switch {
+	case flags&SQLITE_OPEN_MAIN_DB != 0:
+		mf.m = &db.m.Main
+	case flags&(SQLITE_OPEN_MAIN_JOURNAL|SQLITE_OPEN_SUPER_JOURNAL) != 0:
+		mf.m = &db.m.Journal
+	case flags&SQLITE_OPEN_WAL != 0:
+		mf.m = &db.m.WAL
+	default:
+		mf.m = &db.m.Temp
+	}
+	mf.count(func(m *FileMetrics) { m.Opens++ })
+	if _, ok := f.(FileSharedMemory); ok {
+		return metricsFileShm{mf}, out, nil
+	}
+	return mf, out, nil
+}
+
+// Delete implements VFS.
+func (v *MetricsVFS) Delete(name string, syncDir bool) error {
+	return v.base.Delete(name, syncDir)
+}
+
+// Access implements VFS.
+func (v *MetricsVFS) Access(name string, flag int) (bool, error) {
+	return v.base.Access(name, flag)
+}
+
+// FullPathname implements VFS.
+func (v *MetricsVFS) FullPathname(name string) (string, error) {
+	return v.base.FullPathname(name)
+}
+
+// metricsFile is a file opened by a MetricsVFS; m points into the metrics
+// of db.
+type metricsFile struct {
+	File
+	db *metricsDB
+	m  *FileMetrics
+}
+
+// metricsFileShm is a metricsFile whose base file provides shared memory.
+type metricsFileShm struct {
+	*metricsFile
+}
+
+func (f *metricsFile) count(update func(m *FileMetrics)) {
+	f.db.mu.Lock()
+	update(f.m)
+	f.db.mu.Unlock()
+}
+
+// ReadAt implements File.
+func (f *metricsFile) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := f.File.ReadAt(p, off)
+	d := time.Since(start)
+	f.count(func(m *FileMetrics) {
+		m.Reads++
+		m.BytesRead += int64(n)
+		m.ReadLatency.observe(d)
+	})
+	return n, err
+}
+
+// WriteAt implements File.
+func (f *metricsFile) WriteAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := f.File.WriteAt(p, off)
+	d := time.Since(start)
+	f.count(func(m *FileMetrics) {
+		m.Writes++
+		m.BytesWritten += int64(n)
+		m.WriteLatency.observe(d)
+	})
+	return n, err
+}
+
+// Truncate implements File.
+func (f *metricsFile) Truncate(size int64) error {
+	f.count(func(m *FileMetrics) { m.Truncates++ })
+	return f.File.Truncate(size)
+}
+
+// Sync implements File.
+func (f *metricsFile) Sync(flags int) error {
+	start := time.Now()
+	err := f.File.Sync(flags)
+	d := time.Since(start)
+	f.count(func(m *FileMetrics) {
+		m.Syncs++
+		m.SyncLatency.observe(d)
+	})
+	return err
+}
+
+// Lock implements File.
+func (f *metricsFile) Lock(level int) error {
+	start := time.Now()
+	err := f.File.Lock(level)
+	d := time.Since(start)
+	f.count(func(m *FileMetrics) {
+		m.Locks++
+		m.LockLatency.observe(d)
+	})
+	return err
+}
+
+// Unlock implements File.
+func (f *metricsFile) Unlock(level int) error {
+	f.count(func(m *FileMetrics) { m.Unlocks++ })
+	return f.File.Unlock(level)
+}
+
+// FileControl implements FileController.
+func (f *metricsFile) FileControl(op int, arg unsafe.Pointer) error {
+	if c, ok := f.File.(FileController); ok {
+		return c.FileControl(op, arg)
+	}
+	return ErrNotFound
+}
+
+// ShmMap implements FileSharedMemory.
+func (f metricsFileShm) ShmMap(region, size int, extend bool) (unsafe.Pointer, error) {
+	return f.File.(FileSharedMemory).ShmMap(region, size, extend)
+}
+
+// ShmLock implements FileSharedMemory.
+func (f metricsFileShm) ShmLock(offset, n, flags int) error {
+	return f.File.(FileSharedMemory).ShmLock(offset, n, flags)
+}
+
+// ShmBarrier implements FileSharedMemory.
+func (f metricsFileShm) ShmBarrier() {
+	f.File.(FileSharedMemory).ShmBarrier()
+}
+
+// ShmUnmap implements FileSharedMemory.
+func (f metricsFileShm) ShmUnmap(delete bool) error {
+	return f.File.(FileSharedMemory).ShmUnmap(delete)
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricsVFS(t *testing.T) {
+	vfs, err := NewMetricsVFS("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterVFS("metricstest", vfs); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	rollback := filepath.Join(dir, "rollback.db")
+	wal := filepath.Join(dir, "wal.db")
+	for _, dsn := range []string{
+		"file:" + rollback + "?vfs=metricstest",
+		"file:" + wal + "?vfs=metricstest&_journal_mode=WAL",
+	} {
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`CREATE TABLE t (v TEXT);
+			INSERT INTO t VALUES ('a'), ('b');
+			PRAGMA temp_store = FILE;
+			PRAGMA temp.cache_size = 2;
+			CREATE TEMP TABLE x AS
+				WITH RECURSIVE s(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM s WHERE n < 1000)
+				SELECT randomblob(100) FROM s;`)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dbs := vfs.Databases(); len(dbs) != 3 || dbs[0] != "" {
+		t.Errorf("expected the two databases and the temporary files, got %q", dbs)
+	}
+	m := vfs.Metrics(rollback)
+	if m.Main.Reads == 0 || m.Main.Writes == 0 || m.Main.BytesWritten < 4096 || m.Main.Syncs == 0 || m.Main.Locks == 0 {
+		t.Errorf("unexpected main database metrics: %+v", m.Main)
+	}
+	if m.Journal.Opens == 0 || m.Journal.Writes == 0 || m.WAL.Opens != 0 {
+		t.Errorf("unexpected journal metrics: %+v %+v", m.Journal, m.WAL)
+	}
+	if m.Main.ReadLatency.Count != m.Main.Reads || m.Main.ReadLatency.Mean() > m.Main.ReadLatency.Max {
+		t.Errorf("unexpected read latency: %+v", m.Main.ReadLatency)
+	}
+	var buckets int64
+	for _, n := range m.Main.SyncLatency.Buckets {
+		buckets += n
+	}
+	if buckets != m.Main.Syncs {
+		t.Errorf("expected %d syncs in the buckets, got %d", m.Main.Syncs, buckets)
+	}
+	if m := vfs.Metrics(wal); m.WAL.Writes == 0 || m.WAL.Opens == 0 {
+		t.Errorf("unexpected WAL metrics: %+v", m.WAL)
+	}
+	if m := vfs.Metrics(""); m.Temp.Opens == 0 {
+		t.Errorf("unexpected temporary file metrics: %+v", m.Temp)
+	}
+
+	vfs.Reset()
+	if m := vfs.Metrics(rollback); m != (DatabaseMetrics{}) {
+		t.Errorf("expected the metrics to be reset, got %+v", m)
+	}
+}
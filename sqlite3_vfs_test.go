@@ -0,0 +1,308 @@
+// Copyright (C) 2019 Yasuhiro Matsumoto <mattn.jp@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memVFS keeps its files in memory, with the locking rules of SQLite.
+type memVFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	log   []string
+	// full, if set, fails writes to the main database with ErrFull.
+	full bool
+}
+
+type memData struct {
+	data      []byte
+	shared    int
+	reserved  bool
+	pending   bool
+	exclusive bool
+}
+
+type memFile struct {
+	vfs   *memVFS
+	name  string
+	d     *memData
+	level int
+	flags int
+}
+
+func newMemVFS() *memVFS {
+	return &memVFS{files: map[string]*memData{}}
+}
+
+func (v *memVFS) Open(name string, flags int) (File, int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if name == "" {
+		name = fmt.Sprintf("temp-%d", len(v.log))
+	}
+	v.log = append(v.log, "open "+name)
+	d, ok := v.files[name]
+	if !ok {
+		if flags&SQLITE_OPEN_CREATE == 0 {
+			return nil, 0, fs.ErrNotExist
+		}
+		d = &memData{}
+		v.files[name] = d
+	}
+	return &memFile{vfs: v, name: name, d: d, flags: flags}, flags, nil
+}
+
+func (v *memVFS) Delete(name string, syncDir bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.log = append(v.log, "delete "+name)
+	if _, ok := v.files[name]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(v.files, name)
+	return nil
+}
+
+func (v *memVFS) Access(name string, flag int) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.files[name]
+	return ok, nil
+}
+
+func (v *memVFS) FullPathname(name string) (string, error) {
+	return "/" + strings.TrimPrefix(name, "/"), nil
+}
+
+func (f *memFile) Close() error {
+	f.Unlock(SQLITE_LOCK_NONE)
+	if f.flags&SQLITE_OPEN_DELETEONCLOSE != 0 {
+		f.vfs.Delete(f.name, false)
+	}
+	return nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	if off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	if f.vfs.full && f.flags&SQLITE_OPEN_MAIN_DB != 0 {
+		return 0, ErrFull
+	}
+	if end := off + int64(len(p)); end > int64(len(f.d.data)) {
+		f.d.data = append(f.d.data, make([]byte, end-int64(len(f.d.data)))...)
+	}
+	return copy(f.d.data[off:], p), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	if size < int64(len(f.d.data)) {
+		f.d.data = f.d.data[:size]
+	}
+	return nil
+}
+
+func (f *memFile) Sync(flags int) error {
+	return nil
+}
+
+func (f *memFile) FileSize() (int64, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	return int64(len(f.d.data)), nil
+}
+
+func (f *memFile) Lock(level int) error {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	d := f.d
+	switch {
+	case level <= f.level:
+	case level == SQLITE_LOCK_SHARED:
+		if d.pending || d.exclusive {
+			return ErrBusy
+		}
+		d.shared++
+	case level == SQLITE_LOCK_RESERVED:
+		if d.reserved {
+			return ErrBusy
+		}
+		d.reserved = true
+	default:
+		if f.level < SQLITE_LOCK_PENDING {
+			if d.pending {
+				return ErrBusy
+			}
+			d.pending = true
+			f.level = SQLITE_LOCK_PENDING
+		}
+		if level == SQLITE_LOCK_EXCLUSIVE {
+			if d.shared > 1 {
+				return ErrBusy
+			}
+			d.exclusive = true
+		}
+	}
+	if level > f.level {
+		f.level = level
+	}
+	return nil
+}
+
+func (f *memFile) Unlock(level int) error {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	d := f.d
+	if f.level >= SQLITE_LOCK_RESERVED && level < SQLITE_LOCK_RESERVED {
+		d.reserved = false
+		if f.level >= SQLITE_LOCK_PENDING {
+			d.pending, d.exclusive = false, false
+		}
+	}
+	if f.level >= SQLITE_LOCK_SHARED && level == SQLITE_LOCK_NONE {
+		d.shared--
+	}
+	if level < f.level {
+		f.level = level
+	}
+	return nil
+}
+
+func (f *memFile) CheckReservedLock() (bool, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+	return f.d.reserved || f.d.pending || f.d.exclusive, nil
+}
+
+func (f *memFile) SectorSize() int {
+	return 512
+}
+
+func (f *memFile) DeviceCharacteristics() int {
+	return SQLITE_IOCAP_SAFE_APPEND
+}
+
+func TestRegisterVFS(t *testing.T) {
+	vfs := newMemVFS()
+	if err := RegisterVFS("memtest", vfs); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterVFS("memtest", vfs); err != nil {
+		t.Fatal("expected the VFS to be replaced:", err)
+	}
+	if err := RegisterVFS("unix", vfs); err == nil {
+		t.Error("expected error reusing the name of a built-in VFS")
+	}
+
+	db, err := sql.Open("sqlite3", "file:test.db?vfs=memtest&_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (v TEXT); INSERT INTO t VALUES ('a'), ('b')"); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := db.QueryRow("SELECT group_concat(v) FROM t").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "a,b" {
+		t.Errorf("expected a,b, got %q", s)
+	}
+
+	vfs.mu.Lock()
+	data := vfs.files["/test.db"]
+	_, journal := vfs.files["/test.db-journal"]
+	log := strings.Join(vfs.log, ", ")
+	vfs.mu.Unlock()
+	if data == nil || !strings.HasPrefix(string(data.data), "SQLite format 3\x00") {
+		t.Fatal("expected the database to be stored in the VFS")
+	}
+	if journal || !strings.Contains(log, "delete /test.db-journal") {
+		t.Errorf("expected the journal to be deleted, got %s", log)
+	}
+
+	// A second connection sees the data and the locks of the first.
+	ctx := context.Background()
+	c1, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	c2, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if _, err := c1.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.ExecContext(ctx, "INSERT INTO t VALUES ('c')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c2.ExecContext(ctx, "INSERT INTO t VALUES ('d')")
+	var serr Error
+	if !errors.As(err, &serr) || serr.Code != ErrBusy {
+		t.Errorf("expected a busy error, got %v", err)
+	}
+	if _, err := c1.ExecContext(ctx, "COMMIT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.QueryRowContext(ctx, "SELECT group_concat(v) FROM t").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "a,b,c" {
+		t.Errorf("expected a,b,c, got %q", s)
+	}
+
+	// Error codes returned by the VFS are reported to the caller.
+	vfs.mu.Lock()
+	vfs.full = true
+	vfs.mu.Unlock()
+	_, err = c2.ExecContext(ctx, "INSERT INTO t VALUES ('e')")
+	if !errors.As(err, &serr) || serr.Code != ErrFull {
+		t.Errorf("expected a full error, got %v", err)
+	}
+	vfs.mu.Lock()
+	vfs.full = false
+	vfs.mu.Unlock()
+
+	missing, err := sql.Open("sqlite3", "file:missing.db?vfs=memtest&mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer missing.Close()
+	err = missing.Ping()
+	if !errors.As(err, &serr) || serr.Code != ErrCantOpen {
+		t.Errorf("expected a cannot open error, got %v", err)
+	}
+}
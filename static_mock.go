@@ -9,9 +9,11 @@
 package sqlite3
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"reflect"
 )
 
 var errorMsg = errors.New("Binary was compiled with 'CGO_ENABLED=0', go-sqlite3 requires cgo to work. This is a stub")
@@ -22,10 +24,13 @@ func init() {
 
 type (
 	SQLiteDriver struct {
-		Extensions  []string
-		ConnectHook func(*SQLiteConn) error
+		Extensions       []string
+		ConnectHook      func(*SQLiteConn) error
+		Interceptors     []Interceptor
+		TimeParseFormats []string
 	}
-	SQLiteConn struct{}
+	SQLiteConn    struct{}
+	ColumnDecoder func(value any) (any, error)
 )
 
 func (SQLiteDriver) Open(s string) (driver.Conn, error)                        { return nil, errorMsg }
@@ -36,3 +41,13 @@ func (c *SQLiteConn) RegisterCommitHook(func() int)                            {
 func (c *SQLiteConn) RegisterFunc(string, any, bool) error                     { return errorMsg }
 func (c *SQLiteConn) RegisterRollbackHook(func())                              {}
 func (c *SQLiteConn) RegisterUpdateHook(func(int, string, string, int64))      {}
+func (c *SQLiteConn) RegisterColumnType(string, ColumnDecoder, reflect.Type)   {}
+func (c *SQLiteConn) AddCommitHook(func() int) func()                          { return func() {} }
+func (c *SQLiteConn) AddRollbackHook(func()) func()                            { return func() {} }
+func (c *SQLiteConn) AddUpdateHook(func(int, string, string, int64)) func()    { return func() {} }
+func (c *SQLiteConn) ExecBatch(context.Context, string, [][]driver.Value) (driver.Result, error) {
+	return nil, errorMsg
+}
+func (c *SQLiteConn) ExecScript(context.Context, string, []driver.NamedValue) ([]driver.Result, error) {
+	return nil, errorMsg
+}